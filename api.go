@@ -0,0 +1,350 @@
+package blog
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/montebo/security"
+)
+
+// maxEntryBody is the largest request body accepted by an APIHandler.
+const maxEntryBody = 4 << 20
+
+// An APIHandler serves a JSON API for blog entries:
+//
+//	GET    /api/blog/entries          a page of entries, most recent first
+//	POST   /api/blog/entries          creates an entry
+//	GET    /api/blog/entries/{uuid}   a single entry
+//	PUT    /api/blog/entries/{uuid}   replaces an entry
+//	PATCH  /api/blog/entries/{uuid}   changes the fields present in the body
+//	DELETE /api/blog/entries/{uuid}   deletes an entry
+//	GET    /api/blog/slugs/{slug}     the entry with a slug, or a 301
+//	                                  redirect if the slug has changed
+//	GET    /api/blog/tags/{tag}       a page of entries with a tag
+//	GET    /api/blog/search?q=...     a page of entries matching a search
+//	                                  query, most relevant first
+//
+// Entry lists accept "limit", "cursor", "author", "before" and "after"
+// query parameters, and return the cursor of the next page as "next".
+// Search results accept "limit" and "cursor", and each hit has a score and
+// a highlighted snippet of the entry.
+// Editors see every entry, authors also see their own hidden entries, and
+// other sessions only see public entries. Errors are reported as RFC 7807
+// problem details.
+type APIHandler struct {
+	// Manager supplies the blog entries.
+	Manager BlogManager
+
+	// Prefix is the path the API is mounted at, "/api/blog" by default.
+	Prefix string
+
+	// Session returns the session of the person making a request.
+	Session func(r *http.Request) (security.Session, error)
+}
+
+// An EntryPage is the JSON document returned for a list of entries.
+type EntryPage struct {
+	Entries []Entry `json:"entries"`
+	Next    string  `json:"next,omitempty"`
+}
+
+// A Problem is the JSON document describing an API error.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// Fields describes each invalid field of an entry that could not be
+	// saved.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// NewAPIHandler returns an APIHandler mounted at /api/blog.
+func NewAPIHandler(bm BlogManager, session func(r *http.Request) (security.Session, error)) *APIHandler {
+	return &APIHandler{
+		Manager: bm,
+		Prefix:  "/api/blog",
+		Session: session,
+	}
+}
+
+func (h *APIHandler) prefix() string {
+	if h.Prefix == "" {
+		return "/api/blog"
+	}
+	return strings.TrimSuffix(h.Prefix, "/")
+}
+
+func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := h.prefix()
+	if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		h.problem(w, http.StatusNotFound, "")
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+
+	session, err := h.Session(r)
+	if err != nil || session == nil {
+		h.problem(w, http.StatusInternalServerError, "")
+		return
+	}
+	r = r.WithContext(ShowHidden(r.Context()))
+
+	switch {
+	case len(parts) == 1 && parts[0] == "entries":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.list(w, r, session, ListOptions{})
+		case http.MethodPost:
+			h.create(w, r, session)
+		default:
+			h.notAllowed(w, "GET, HEAD, POST")
+		}
+	case len(parts) == 2 && parts[0] == "entries":
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			e, err := h.Manager.GetEntryContext(r.Context(), parts[1], session)
+			h.entry(w, r, e, err)
+		case http.MethodPut, http.MethodPatch:
+			h.update(w, r, session, parts[1], r.Method == http.MethodPatch)
+		case http.MethodDelete:
+			if err := h.Manager.DeleteEntryContext(r.Context(), parts[1], session); err != nil {
+				h.fail(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			h.notAllowed(w, "GET, HEAD, PUT, PATCH, DELETE")
+		}
+	case r.Method != http.MethodGet && r.Method != http.MethodHead:
+		h.notAllowed(w, "GET, HEAD")
+	case len(parts) == 2 && parts[0] == "slugs":
+		e, moved, err := h.Manager.ResolveSlugContext(r.Context(), parts[1], session)
+		if err == nil && moved != "" {
+			redirect(w, r, h.prefix()+"/slugs/"+url.PathEscape(moved))
+			return
+		}
+		h.entry(w, r, e, err)
+	case len(parts) == 2 && parts[0] == "tags":
+		h.list(w, r, session, ListOptions{Tag: parts[1]})
+	case len(parts) == 1 && parts[0] == "search":
+		h.search(w, r, session)
+	default:
+		h.problem(w, http.StatusNotFound, "")
+	}
+}
+
+func (h *APIHandler) list(w http.ResponseWriter, r *http.Request, session security.Session, options ListOptions) {
+	q := r.URL.Query()
+	options.Cursor = q.Get("cursor")
+	options.Author = q.Get("author")
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			h.problem(w, http.StatusBadRequest, "Invalid limit "+v)
+			return
+		}
+		options.Limit = limit
+	}
+	for name, t := range map[string]**time.Time{"before": &options.Before, "after": &options.After} {
+		if v := q.Get(name); v != "" {
+			value, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				h.problem(w, http.StatusBadRequest, "Invalid "+name+" date "+v)
+				return
+			}
+			*t = &value
+		}
+	}
+
+	items, next, err := h.Manager.ListEntriesContext(r.Context(), options, session)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	h.write(w, r, http.StatusOK, &EntryPage{Entries: nonNil(items), Next: next})
+}
+
+func (h *APIHandler) search(w http.ResponseWriter, r *http.Request, session security.Session) {
+	q := r.URL.Query()
+	options := SearchOptions{Cursor: q.Get("cursor")}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			h.problem(w, http.StatusBadRequest, "Invalid limit "+v)
+			return
+		}
+		options.Limit = limit
+	}
+
+	results, err := h.Manager.SearchContext(r.Context(), q.Get("q"), options, session)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	h.write(w, r, http.StatusOK, results)
+}
+
+func (h *APIHandler) entry(w http.ResponseWriter, r *http.Request, e Entry, err error) {
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	h.write(w, r, http.StatusOK, e)
+}
+
+func (h *APIHandler) create(w http.ResponseWriter, r *http.Request, session security.Session) {
+	e := h.Manager.NewEntry()
+	if !h.decode(w, r, e) {
+		return
+	}
+	if err := h.Manager.AddEntryContext(r.Context(), e, session); err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	saved, err := h.Manager.GetEntryContext(r.Context(), e.Uuid(), session)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.Header().Set("Location", h.prefix()+"/entries/"+url.PathEscape(e.Uuid()))
+	h.write(w, r, http.StatusCreated, saved)
+}
+
+// update replaces an entry with the request body, or with patch set changes
+// only the fields present in the body. A body replacing an entry without a
+// status keeps the status of the entry. The body is read into a copy of
+// the entry, so a request that fails leaves the entry that was read as it
+// was.
+func (h *APIHandler) update(w http.ResponseWriter, r *http.Request, session security.Session, uuid string, patch bool) {
+	current, err := h.Manager.GetEntryContext(r.Context(), uuid, session)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	e := cloneEntry(current)
+	if !patch {
+		e = &GaeEntry{uuid: uuid, status: current.Status()}
+	}
+	if !h.decode(w, r, e) {
+		return
+	}
+	if e.Uuid() != uuid {
+		h.problem(w, http.StatusBadRequest, "Entry uuid can not be changed")
+		return
+	}
+	if err := h.Manager.UpdateEntryContext(r.Context(), e, session); err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	saved, err := h.Manager.GetEntryContext(r.Context(), uuid, session)
+	h.entry(w, r, saved, err)
+}
+
+// decode reads an entry from the request body, writing a problem response
+// if the body is not a valid entry. The body must be sent as
+// application/json or application/merge-patch+json.
+func (h *APIHandler) decode(w http.ResponseWriter, r *http.Request, e Entry) bool {
+	if t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || (t != "application/json" && t != "application/merge-patch+json") {
+		h.problem(w, http.StatusUnsupportedMediaType, "Entries must be sent as application/json")
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEntryBody))
+	if err != nil {
+		h.problem(w, http.StatusRequestEntityTooLarge, "")
+		return false
+	}
+	if err := json.Unmarshal(body, e); err != nil {
+		h.problem(w, http.StatusBadRequest, "Invalid entry. "+err.Error())
+		return false
+	}
+	return true
+}
+
+// fail writes the problem response describing an error returned by the
+// blog manager.
+func (h *APIHandler) fail(w http.ResponseWriter, err error) {
+	var unauthenticated *security.ErrUnauthenticated
+	var validation *ErrValidation
+	var conflict *ErrSlugConflict
+	var forbidden *ErrForbidden
+
+	switch {
+	case errors.As(err, &unauthenticated):
+		h.problem(w, http.StatusUnauthorized, "")
+	case errors.As(err, &forbidden):
+		h.problem(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, ErrDeleted):
+		h.problem(w, http.StatusGone, err.Error())
+	case errors.Is(err, ErrNotFound):
+		h.problem(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalidCursor):
+		h.problem(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, &validation):
+		h.write(w, nil, http.StatusUnprocessableEntity, &Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(http.StatusUnprocessableEntity),
+			Status: http.StatusUnprocessableEntity,
+			Detail: err.Error(),
+			Fields: validation.Fields,
+		})
+	case errors.As(err, &conflict):
+		h.problem(w, http.StatusConflict, err.Error())
+	default:
+		h.problem(w, http.StatusInternalServerError, "")
+	}
+}
+
+func (h *APIHandler) notAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	h.problem(w, http.StatusMethodNotAllowed, "")
+}
+
+func (h *APIHandler) problem(w http.ResponseWriter, status int, detail string) {
+	h.write(w, nil, status, &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+func (h *APIHandler) write(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.problem(w, http.StatusInternalServerError, "")
+		return
+	}
+	if _, ok := v.(*Problem); ok {
+		w.Header().Set("Content-Type", "application/problem+json")
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r == nil || r.Method != http.MethodHead {
+		w.Write(b)
+	}
+}
+
+// nonNil returns an empty list in place of nil, so that it is written as
+// an empty JSON array.
+func nonNil(items []Entry) []Entry {
+	if items == nil {
+		return []Entry{}
+	}
+	return items
+}
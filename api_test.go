@@ -0,0 +1,218 @@
+package blog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/montebo/security"
+)
+
+func TestGaeEntryJSON(t *testing.T) {
+	e := &GaeEntry{}
+	e.SetTitle("A title")
+	e.SetText("Some *text*")
+	e.SetTags([]string{"a", "b"})
+	e.SetDate(*StringToDatePointer("2001/2/3"))
+	e.SetAuthor(&testPerson{uuid: "p1", firstName: "Jane", lastName: "Li"})
+	e.SetStatus(StatusPublished)
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	for _, want := range []string{`"uuid":"` + e.Uuid() + `"`, `"slug":"a-title"`, `"author":"p1"`, `"author_name":"Jane Li"`, `"format":"markdown"`, `"status":"published"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("Marshal() = %s, missing %s", b, want)
+		}
+	}
+
+	var decoded GaeEntry
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if decoded.Uuid() != e.Uuid() || decoded.Title() != e.Title() || decoded.AuthorUUID() != "p1" || !decoded.Date().Equal(*e.Date()) ||
+		strings.Join(decoded.Tags(), "|") != "a|b" || decoded.Status() != StatusPublished || decoded.Html() != e.Html() {
+		t.Errorf("Unmarshal() = %+v, want %+v", decoded, e)
+	}
+
+	if err := json.Unmarshal([]byte(`{"title":"Changed","text":"Plain"}`), &decoded); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if decoded.Title() != "Changed" || decoded.Slug() != "a-title" || decoded.AuthorUUID() != "p1" || decoded.Html() != "<p>Plain</p>\n" {
+		t.Errorf("Unmarshal() of a partial document = %+v", decoded)
+	}
+}
+
+func TestAPIHandler(t *testing.T) {
+	am := newTestAccessManager()
+	bm := NewMemoryBlogManager(am)
+	editor := &testSession{site: "api.com", personUuid: "p1", authenticated: true, roles: []string{RoleEditor}}
+	am.addPerson("p1", "Jane", "Li")
+
+	var session security.Session = editor
+	h := NewAPIHandler(bm, func(r *http.Request) (security.Session, error) {
+		return session, nil
+	})
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, v interface{}) {
+		t.Helper()
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+		}
+	}
+
+	w := do("POST", "/api/blog/entries", `{"title":"First post","text":"Hello","date":"2001-01-01T00:00:00Z","tags":["news"],"author":"p1","status":"published"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST returned %d %s", w.Code, w.Body.String())
+	}
+	var first GaeEntry
+	decode(w, &first)
+	if w.Header().Get("Location") != "/api/blog/entries/"+first.Uuid() || first.Slug() != "first-post" || first.AuthorUUID() != "p1" {
+		t.Errorf("POST returned %s %s", w.Header().Get("Location"), w.Body.String())
+	}
+	if w := do("POST", "/api/blog/entries", `{"title":"Draft post","text":"Hidden","date":"2002-01-01T00:00:00Z"}`); w.Code != http.StatusCreated {
+		t.Fatalf("POST returned %d %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/api/blog/entries", `{"text":"No title"}`); w.Code != http.StatusUnprocessableEntity || w.Header().Get("Content-Type") != "application/problem+json" || !strings.Contains(w.Body.String(), `"fields":{"Title":`) {
+		t.Errorf("POST of an invalid entry returned %d %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/api/blog/entries", `{"title":`); w.Code != http.StatusBadRequest {
+		t.Errorf("POST of invalid JSON returned %d", w.Code)
+	}
+
+	w = do("PATCH", "/api/blog/entries/"+first.Uuid(), `{"description":"Changed"}`)
+	var patched GaeEntry
+	decode(w, &patched)
+	if w.Code != http.StatusOK || patched.Description() != "Changed" || patched.Title() != "First post" {
+		t.Errorf("PATCH returned %d %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", "/api/blog/entries/"+first.Uuid(), `{"uuid":"other","title":"x","text":"y"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT changing the uuid returned %d", w.Code)
+	}
+	if w := do("PUT", "/api/blog/entries/missing", `{"title":"x","text":"y"}`); w.Code != http.StatusNotFound {
+		t.Errorf("PUT of a missing entry returned %d", w.Code)
+	}
+
+	// Requests that fail leave the entry unchanged.
+	if w := do("PATCH", "/api/blog/entries/"+first.Uuid(), `{"uuid":"other","title":"Moved"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("PATCH changing the uuid returned %d", w.Code)
+	}
+	if w := do("PATCH", "/api/blog/entries/"+first.Uuid(), `{"title":""}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PATCH of an invalid entry returned %d", w.Code)
+	}
+	if e, err := bm.GetEntry(first.Uuid(), editor); err != nil || e.Title() != "First post" || e.Uuid() != first.Uuid() {
+		t.Errorf("PATCH requests that failed changed the entry: %v", err)
+	}
+
+	// PUT without a status keeps the status of the entry.
+	w = do("PUT", "/api/blog/entries/"+first.Uuid(), `{"title":"First post","text":"Hello again","date":"2001-01-01T00:00:00Z","tags":["news"],"author":"p1"}`)
+	var replaced GaeEntry
+	decode(w, &replaced)
+	if w.Code != http.StatusOK || replaced.Text() != "Hello again" || replaced.Status() != StatusPublished {
+		t.Errorf("PUT without a status returned %d %s", w.Code, w.Body.String())
+	}
+	w = do("PUT", "/api/blog/entries/"+first.Uuid(), `{"title":"First post","text":"Hello","date":"2001-01-01T00:00:00Z","tags":["news"],"author":"p1","status":"archived"}`)
+	replaced = GaeEntry{}
+	decode(w, &replaced)
+	if w.Code != http.StatusOK || replaced.Status() != StatusArchived {
+		t.Errorf("PUT with a status returned %d %s", w.Code, w.Body.String())
+	}
+	w = do("PATCH", "/api/blog/entries/"+first.Uuid(), `{"status":"published"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("PATCH of the status returned %d %s", w.Code, w.Body.String())
+	}
+
+	var page struct{ Next string }
+	w = do("GET", "/api/blog/entries?limit=1", "")
+	if decode(w, &page); page.Next == "" {
+		t.Errorf("GET ?limit=1 returned %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "Draft post") {
+		t.Errorf("editors should see draft entries: %s", w.Body.String())
+	}
+	if w := do("GET", "/api/blog/entries?cursor=bad", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("GET with an invalid cursor returned %d", w.Code)
+	}
+	if w := do("GET", "/api/blog/slugs/first-post", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), first.Uuid()) {
+		t.Errorf("GET slug returned %d %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/api/blog/tags/news", ""); !strings.Contains(w.Body.String(), "First post") {
+		t.Errorf("GET tag returned %s", w.Body.String())
+	}
+	if w := do("GET", "/api/blog/search?q=first", ""); !strings.Contains(w.Body.String(), "First post") {
+		t.Errorf("GET search returned %s", w.Body.String())
+	}
+	if w := do("GET", "/api/blog/search?q=post&limit=1", ""); !strings.Contains(w.Body.String(), `"total":`) || !strings.Contains(w.Body.String(), `"next":"1"`) {
+		t.Errorf("GET search page returned %s", w.Body.String())
+	}
+	if w := do("GET", "/api/blog/search?q=post&cursor=bad", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("GET search with an invalid cursor returned %d", w.Code)
+	}
+
+	session = &testSession{site: "api.com"}
+	w = do("GET", "/api/blog/entries", "")
+	if !strings.Contains(w.Body.String(), "First post") || strings.Contains(w.Body.String(), "Draft post") {
+		t.Errorf("anonymous sessions should only see public entries: %s", w.Body.String())
+	}
+	if w := do("GET", "/api/blog/slugs/draft-post", ""); w.Code != http.StatusNotFound {
+		t.Errorf("anonymous GET of a draft returned %d", w.Code)
+	}
+	if w := do("DELETE", "/api/blog/entries/"+first.Uuid(), ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous DELETE returned %d", w.Code)
+	}
+
+	session = &testSession{site: "api.com", personUuid: "p2", authenticated: true, roles: []string{RoleAuthor}}
+	if w := do("PATCH", "/api/blog/entries/"+first.Uuid(), `{"description":"Not mine"}`); w.Code != http.StatusForbidden {
+		t.Errorf("PATCH of another person's entry by an author returned %d %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/api/blog/entries/"+first.Uuid(), ""); w.Code != http.StatusForbidden {
+		t.Errorf("DELETE of another person's entry by an author returned %d", w.Code)
+	}
+
+	session = editor
+	if w := do("DELETE", "/api/blog/entries/"+first.Uuid(), ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE returned %d", w.Code)
+	}
+	if w := do("DELETE", "/api/blog/entries/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of a missing entry returned %d", w.Code)
+	}
+	if w := do("GET", "/api/blog/entries/"+first.Uuid(), ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":true`) {
+		t.Errorf("GET of a deleted entry by an editor returned %d %s", w.Code, w.Body.String())
+	}
+	session = &testSession{site: "api.com"}
+	if w := do("GET", "/api/blog/entries/"+first.Uuid(), ""); w.Code != http.StatusGone {
+		t.Errorf("anonymous GET of a deleted entry returned %d", w.Code)
+	}
+	session = editor
+	for _, method := range []string{"POST", "PUT", "PATCH"} {
+		target := "/api/blog/entries"
+		if method != "POST" {
+			target += "/" + first.Uuid()
+		}
+		for _, contentType := range []string{"", "text/plain", "application/jsonp"} {
+			r := httptest.NewRequest(method, target, strings.NewReader(`{"title":"Typed"}`))
+			if contentType != "" {
+				r.Header.Set("Content-Type", contentType)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusUnsupportedMediaType {
+				t.Errorf("%s with content type %q returned %d", method, contentType, w.Code)
+			}
+		}
+	}
+	if w := do("POST", "/api/blog/search", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST search returned %d", w.Code)
+	}
+}
@@ -1,6 +1,8 @@
 package blog
 
 import (
+	"context"
+	"sort"
 	"time"
 
 	"gitlab.com/montebo/security"
@@ -18,12 +20,17 @@ type Entry interface {
 	Author() security.Person
 	AuthorUUID() string
 	Text() string
+	Format() string
+	Language() string
 	Html() string
 	Deleted() bool
+	DeletedAt() *time.Time
+	Status() string
 	Created() *time.Time
 	Updated() *time.Time
 
 	SetTitle(title string)
+	SetSlug(slug string)
 	SetDescription(description string)
 	SetCover(cover string)
 	SetThumbnail(thumbnail string)
@@ -31,29 +38,139 @@ type Entry interface {
 	SetDate(date time.Time)
 	SetAuthor(author security.Person)
 	SetText(text string)
+	SetFormat(format string)
+	SetLanguage(language string)
 	SetDeleted(deleted bool)
+	SetStatus(status string)
 
 	SearchTags() []string
 
+	// setDate replaces the date, which may be nil.
+	setDate(date *time.Time)
 	setCreated(created time.Time)
 	setUpdated(updated time.Time)
+	setDeletedAt(deletedAt *time.Time)
+
+	// explicitSlug reports whether the slug was chosen rather than derived
+	// from the title, and setSlug replaces a derived slug that is already
+	// in use.
+	explicitSlug() bool
+	setSlug(slug string)
 }
 
 type BlogManager interface {
+	// The read methods only return public entries, which are published,
+	// not deleted and dated in the past, unless called with a context from
+	// ShowHidden. A deleted entry read by uuid or slug is reported with
+	// ErrDeleted.
 	GetEntry(uuid string, session security.Session) (Entry, error)
 	GetEntryCached(uuid string, session security.Session) (Entry, error)
 	GetEntryBySlug(slug string, session security.Session) (Entry, error)
 	GetEntryBySlugCached(slug string, session security.Session) (Entry, error)
+
+	// ResolveSlug returns the entry with a slug. If the slug belonged to an
+	// entry that has since been given a new slug, the entry is returned
+	// along with the new slug, so that old links can be redirected.
+	ResolveSlug(slug string, session security.Session) (Entry, string, error)
+
 	GetEntries(session security.Session) ([]Entry, error)
 	GetRecentEntries(limit int, session security.Session) ([]Entry, error)
 	GetFutureEntries(session security.Session) ([]Entry, error)
 	GetEntriesByTag(tag string, limit int, session security.Session) ([]Entry, error)
 	GetEntriesByAuthor(personUuid string, session security.Session) ([]Entry, error)
+	GetEntriesByStatus(status string, session security.Session) ([]Entry, error)
+	ListEntries(options ListOptions, session security.Session) ([]Entry, string, error)
+
+	// Search returns a page of the entries matching a search query, most
+	// relevant first, and SearchEntries returns all of them. Entries match
+	// a query that has every word, or another form of it, in their title,
+	// tags, description or text. Words ending in "*" match any word they
+	// are a prefix of, words in double quotes must appear in that order,
+	// and OR separates alternative queries. Entries are indexed in their
+	// own language, and query words match entries in any language.
+	Search(query string, options SearchOptions, session security.Session) (*SearchResults, error)
 	SearchEntries(query string, session security.Session) ([]Entry, error)
 
 	AddEntry(entry Entry, session security.Session) error
 	UpdateEntry(event Entry, session security.Session) error
+
+	// DeleteEntry moves an entry to the trash, and RestoreEntry moves it
+	// back. GetDeletedEntries returns the entries in the trash that the
+	// session may change, most recently deleted first. PurgeEntry
+	// permanently removes an entry that is in the trash.
 	DeleteEntry(uuid string, session security.Session) error
+	RestoreEntry(uuid string, session security.Session) error
+	GetDeletedEntries(session security.Session) ([]Entry, error)
+	PurgeEntry(uuid string, session security.Session) error
+
+	// GetRevisions returns the revisions of an entry, newest first.
+	// RestoreRevision copies the content of a revision onto the entry and
+	// saves it as a new revision. It leaves the status and slug of the
+	// entry as they are, so that restoring content never publishes or
+	// moves an entry.
+	GetRevisions(uuid string, session security.Session) ([]*Revision, error)
+	GetRevision(uuid string, revision int, session security.Session) (*Revision, error)
+	RestoreRevision(uuid string, revision int, session security.Session) error
+
+	// The Context variants of the methods above stop waiting on the
+	// database and return the context error when ctx is cancelled or its
+	// deadline passes. The methods above call them with a default context.
+	GetEntryContext(ctx context.Context, uuid string, session security.Session) (Entry, error)
+	GetEntryCachedContext(ctx context.Context, uuid string, session security.Session) (Entry, error)
+	GetEntryBySlugContext(ctx context.Context, slug string, session security.Session) (Entry, error)
+	GetEntryBySlugCachedContext(ctx context.Context, slug string, session security.Session) (Entry, error)
+	ResolveSlugContext(ctx context.Context, slug string, session security.Session) (Entry, string, error)
+	GetEntriesContext(ctx context.Context, session security.Session) ([]Entry, error)
+	GetRecentEntriesContext(ctx context.Context, limit int, session security.Session) ([]Entry, error)
+	GetFutureEntriesContext(ctx context.Context, session security.Session) ([]Entry, error)
+	GetEntriesByTagContext(ctx context.Context, tag string, limit int, session security.Session) ([]Entry, error)
+	GetEntriesByAuthorContext(ctx context.Context, personUuid string, session security.Session) ([]Entry, error)
+	GetEntriesByStatusContext(ctx context.Context, status string, session security.Session) ([]Entry, error)
+	ListEntriesContext(ctx context.Context, options ListOptions, session security.Session) ([]Entry, string, error)
+	SearchContext(ctx context.Context, query string, options SearchOptions, session security.Session) (*SearchResults, error)
+	SearchEntriesContext(ctx context.Context, query string, session security.Session) ([]Entry, error)
+	AddEntryContext(ctx context.Context, entry Entry, session security.Session) error
+	UpdateEntryContext(ctx context.Context, entry Entry, session security.Session) error
+	DeleteEntryContext(ctx context.Context, uuid string, session security.Session) error
+	RestoreEntryContext(ctx context.Context, uuid string, session security.Session) error
+	GetDeletedEntriesContext(ctx context.Context, session security.Session) ([]Entry, error)
+	PurgeEntryContext(ctx context.Context, uuid string, session security.Session) error
+	GetRevisionsContext(ctx context.Context, uuid string, session security.Session) ([]*Revision, error)
+	GetRevisionContext(ctx context.Context, uuid string, revision int, session security.Session) (*Revision, error)
+	RestoreRevisionContext(ctx context.Context, uuid string, revision int, session security.Session) error
 
 	NewEntry() Entry
+	AccessManager() security.AccessManager
+}
+
+// entryTime returns the time an entry is ordered by: its publication date,
+// or its creation time when it has no publication date.
+func entryTime(e Entry) time.Time {
+	if e.Date() != nil {
+		return *e.Date()
+	}
+	if e.Created() != nil {
+		return *e.Created()
+	}
+	return time.Time{}
+}
+
+// sortEntries orders entries most recent first.
+func sortEntries(items []Entry) {
+	sort.Slice(items, func(i, j int) bool {
+		ti, tj := entryTime(items[i]), entryTime(items[j])
+		if ti.Equal(tj) {
+			return items[i].Uuid() < items[j].Uuid()
+		}
+		return tj.Before(ti)
+	})
+}
+
+func containsString(items []string, value string) bool {
+	for _, i := range items {
+		if i == value {
+			return true
+		}
+	}
+	return false
 }
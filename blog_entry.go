@@ -1,6 +1,7 @@
 package blog
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -21,12 +22,41 @@ type GaeEntry struct {
 	date        *time.Time
 	authorUuid  string
 	text        string
+	format      string
+	language    string
 	created     *time.Time
 	updated     *time.Time
 	deleted     bool
+	deletedAt   *time.Time
+	status      string
 
-	html   string
-	author security.Person
+	html         string
+	author       security.Person
+	slugExplicit bool
+}
+
+// clone returns a copy of the entry that shares nothing with it, so that
+// changes to either do not show in the other.
+func (e *GaeEntry) clone() *GaeEntry {
+	c := *e
+	if e.tags != nil {
+		c.tags = append([]string{}, e.tags...)
+	}
+	for _, t := range []**time.Time{&c.date, &c.created, &c.updated, &c.deletedAt} {
+		if *t != nil {
+			copy := **t
+			*t = &copy
+		}
+	}
+	return &c
+}
+
+// cloneEntry returns a copy of an entry that shares nothing with it.
+func cloneEntry(entry Entry) Entry {
+	if e, ok := entry.(*GaeEntry); ok {
+		return e.clone()
+	}
+	return entry
 }
 
 func (e *GaeEntry) Uuid() string {
@@ -54,6 +84,26 @@ func (e *GaeEntry) Slug() string {
 	return e.slug
 }
 
+// SetSlug chooses the slug of an entry. An empty slug restores the slug
+// derived from the title. The slug is checked when the entry is saved.
+func (e *GaeEntry) SetSlug(slug string) {
+	if slug == "" {
+		e.slug = security.Slugify(e.title)
+		e.slugExplicit = false
+		return
+	}
+	e.slug = slug
+	e.slugExplicit = true
+}
+
+func (e *GaeEntry) explicitSlug() bool {
+	return e.slugExplicit
+}
+
+func (e *GaeEntry) setSlug(slug string) {
+	e.slug = slug
+}
+
 func (e *GaeEntry) Description() string {
 	return e.description
 }
@@ -86,6 +136,10 @@ func (e *GaeEntry) SetDate(date time.Time) {
 	e.date = &date
 }
 
+func (e *GaeEntry) setDate(date *time.Time) {
+	e.date = date
+}
+
 func (e *GaeEntry) Author() security.Person {
 	return e.author
 }
@@ -106,6 +160,9 @@ func (e *GaeEntry) Text() string {
 }
 
 func (e *GaeEntry) SetText(text string) {
+	if text != e.text {
+		e.html = ""
+	}
 	e.text = text
 }
 
@@ -117,8 +174,43 @@ func (e *GaeEntry) SetCover(cover string) {
 	e.cover = cover
 }
 
+// Format returns the content format of the entry text. Entries without a
+// format are written in Markdown.
+func (e *GaeEntry) Format() string {
+	if e.format == "" {
+		return FormatMarkdown
+	}
+	return e.format
+}
+
+func (e *GaeEntry) SetFormat(format string) {
+	if format != e.Format() {
+		e.html = ""
+	}
+	e.format = format
+}
+
+// Language returns the BCP 47 tag of the language the entry is written
+// in, such as "en" or "zh-Hant", or an empty string if it is not known.
+// It selects how the entry is indexed for search.
+func (e *GaeEntry) Language() string {
+	return e.language
+}
+
+func (e *GaeEntry) SetLanguage(language string) {
+	e.language = language
+}
+
+// Html returns the entry text rendered to sanitized HTML according to its
+// format. The rendered HTML is stored with the entry, so it is only rendered
+// again after the text or format changes. Markdown entries saved before
+// rendering was introduced stored the raw text as their HTML, so these are
+// rendered again as well.
 func (e *GaeEntry) Html() string {
-	return e.text
+	if e.text != "" && (e.html == "" || (e.html == e.text && e.Format() == FormatMarkdown)) {
+		e.html = Render(e.Format(), e.text)
+	}
+	return e.html
 }
 
 func (e *GaeEntry) Deleted() bool {
@@ -129,6 +221,26 @@ func (e *GaeEntry) SetDeleted(deleted bool) {
 	e.deleted = deleted
 }
 
+// DeletedAt returns the time the entry was moved to the trash, or nil if
+// it is not deleted.
+func (e *GaeEntry) DeletedAt() *time.Time {
+	return e.deletedAt
+}
+
+func (e *GaeEntry) setDeletedAt(deletedAt *time.Time) {
+	e.deletedAt = deletedAt
+}
+
+// Status returns the workflow state of the entry. A scheduled entry whose
+// date has passed is published.
+func (e *GaeEntry) Status() string {
+	return effectiveStatus(e.status, e.date)
+}
+
+func (e *GaeEntry) SetStatus(status string) {
+	e.status = status
+}
+
 func (e *GaeEntry) Created() *time.Time {
 	return e.created
 }
@@ -197,11 +309,33 @@ func (e *GaeEntry) Load(ps []datastore.Property) error {
 		case "Text":
 			e.text = i.Value.(string)
 			break
+		case "Html":
+			e.html = i.Value.(string)
+			break
+		case "Format":
+			e.format = i.Value.(string)
+			break
+		case "Language":
+			e.language = i.Value.(string)
+			break
 		case "Deleted":
 			e.deleted = i.Value.(bool)
 			break
+		case "DeletedAt":
+			if i.Value != nil {
+				t := i.Value.(time.Time)
+				e.deletedAt = &t
+			}
+			break
+		case "Status":
+			e.status = i.Value.(string)
+			break
 		}
 	}
+	if e.status == "" {
+		// Entries saved before statuses were introduced were public
+		e.status = StatusPublished
+	}
 	return nil
 }
 
@@ -235,6 +369,21 @@ func (e *GaeEntry) Save() ([]datastore.Property, error) {
 			Value:   e.text,
 			NoIndex: true,
 		},
+		{
+			Name:    "Html",
+			Value:   e.Html(),
+			NoIndex: true,
+		},
+		{
+			Name:    "Format",
+			Value:   e.Format(),
+			NoIndex: true,
+		},
+		{
+			Name:    "Language",
+			Value:   e.language,
+			NoIndex: true,
+		},
 		{
 			Name:  "Author",
 			Value: e.authorUuid,
@@ -243,6 +392,10 @@ func (e *GaeEntry) Save() ([]datastore.Property, error) {
 			Name:  "Deleted",
 			Value: e.deleted,
 		},
+		{
+			Name:  "Status",
+			Value: e.Status(),
+		},
 	}
 
 	if len(e.tags) > 0 {
@@ -250,19 +403,22 @@ func (e *GaeEntry) Save() ([]datastore.Property, error) {
 	}
 
 	if e.date != nil {
-		props = append(props, datastore.Property{Name: "Date", Value: e.date})
+		props = append(props, datastore.Property{Name: "Date", Value: *e.date})
 	}
 
-	now := time.Now()
+	// ListTime orders entries with and without a date together.
+	props = append(props, datastore.Property{Name: "ListTime", Value: entryTime(e)})
 
 	if e.created != nil {
-		e.created = &now
-		props = append(props, datastore.Property{Name: "Created", Value: e.created})
+		props = append(props, datastore.Property{Name: "Created", Value: *e.created})
 	}
 
 	if e.updated != nil {
-		e.setUpdated(now)
-		props = append(props, datastore.Property{Name: "Updated", Value: e.updated})
+		props = append(props, datastore.Property{Name: "Updated", Value: *e.updated})
+	}
+
+	if e.deletedAt != nil {
+		props = append(props, datastore.Property{Name: "DeletedAt", Value: *e.deletedAt})
 	}
 
 	props = append(props, datastore.Property{Name: "SearchTags", Value: e.SearchTagsI()})
@@ -279,17 +435,17 @@ func (e *GaeEntry) SearchTagsI() []interface{} {
 	return tags[:]
 }
 
+// SearchTags returns the terms of the title in the language of the entry,
+// its tags, the year it is dated and the names of its author.
 func (e *GaeEntry) SearchTags() []string {
 	var tags []string
 
-	for _, r := range strings.Fields(strings.ToLower(e.Title())) {
-		if r != "" {
-			tags = append(tags, r)
-		}
+	for _, t := range analyzerFor(e.Language()).tokenize(e.Title()) {
+		tags = append(tags, t.term)
 	}
 
 	for _, tag := range e.Tags() {
-		tag = strings.ToLower(strings.ReplaceAll(tag, " ", "-"))
+		tag = tagKey(tag)
 		if tag != "" {
 			tags = append(tags, tag)
 			tags = append(tags, "tag:"+tag)
@@ -301,13 +457,104 @@ func (e *GaeEntry) SearchTags() []string {
 	}
 
 	if e.Author() != nil {
-		if e.Author().FirstName() != "" {
-			tags = append(tags, strings.ToLower(e.Author().FirstName()))
-		}
-		if e.Author().LastName() != "" {
-			tags = append(tags, strings.ToLower(e.Author().LastName()))
+		for _, t := range words(e.Author().FirstName() + " " + e.Author().LastName()) {
+			tags = append(tags, t.term)
 		}
 	}
 
 	return tags[:]
 }
+
+// gaeEntryJSON is the JSON representation of an entry. The author is
+// identified by uuid, and the author name and rendered html are only
+// written, never read.
+type gaeEntryJSON struct {
+	Uuid        string     `json:"uuid"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Description string     `json:"description,omitempty"`
+	Thumbnail   string     `json:"thumbnail,omitempty"`
+	Cover       string     `json:"cover,omitempty"`
+	Tags        []string   `json:"tags"`
+	Date        *time.Time `json:"date"`
+	Author      string     `json:"author,omitempty"`
+	AuthorName  string     `json:"author_name,omitempty"`
+	Text        string     `json:"text"`
+	Format      string     `json:"format"`
+	Language    string     `json:"language,omitempty"`
+	Html        string     `json:"html,omitempty"`
+	Status      string     `json:"status"`
+	Deleted     bool       `json:"deleted"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Created     *time.Time `json:"created,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+}
+
+func (e *GaeEntry) toJSON() gaeEntryJSON {
+	return gaeEntryJSON{
+		Uuid:        e.uuid,
+		Title:       e.title,
+		Slug:        e.Slug(),
+		Description: e.description,
+		Thumbnail:   e.thumbnail,
+		Cover:       e.cover,
+		Tags:        e.tags,
+		Date:        e.date,
+		Author:      e.authorUuid,
+		Text:        e.text,
+		Format:      e.Format(),
+		Language:    e.language,
+		Status:      e.Status(),
+		Deleted:     e.deleted,
+		DeletedAt:   e.deletedAt,
+		Created:     e.created,
+		Updated:     e.updated,
+	}
+}
+
+func (e *GaeEntry) MarshalJSON() ([]byte, error) {
+	doc := e.toJSON()
+	doc.Uuid = e.Uuid()
+	doc.AuthorName = authorName(e, "")
+	doc.Html = e.Html()
+	if doc.Tags == nil {
+		doc.Tags = []string{}
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON sets the fields present in a JSON document, leaving other
+// fields unchanged, so a partial document can be applied to an existing
+// entry.
+func (e *GaeEntry) UnmarshalJSON(data []byte) error {
+	doc := e.toJSON()
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	if doc.Uuid != "" {
+		e.uuid = doc.Uuid
+	}
+	e.title = doc.Title
+	if doc.Slug != e.slug {
+		e.SetSlug(doc.Slug)
+	}
+	e.description = doc.Description
+	e.thumbnail = doc.Thumbnail
+	e.cover = doc.Cover
+	e.tags = doc.Tags
+	e.date = doc.Date
+	if doc.Author != e.authorUuid {
+		e.author = nil
+		e.authorUuid = doc.Author
+	}
+	e.SetText(doc.Text)
+	e.SetFormat(doc.Format)
+	e.language = doc.Language
+	e.status = doc.Status
+	e.deleted = doc.Deleted
+	e.deletedAt = doc.DeletedAt
+	e.created = doc.Created
+	e.updated = doc.Updated
+	return nil
+}
@@ -11,6 +11,9 @@ import (
 
 // TestBlogEntry tests Getting and Searching four blog entries
 func TestBlogEntry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires the datastore emulator and cassandra")
+	}
 
 	l := log.NewStdoutLogDebug()
 	defer l.Close()
@@ -155,8 +158,8 @@ func testBlogEntry(am security.AccessManager, bm BlogManager, t *testing.T) {
 
 	{
 		ev, err := bm.GetEntryBySlug("a-title-archie", session)
-		if err != nil {
-			t.Fatalf("GetEntryBySlug() failed unexpectedly: %v", err)
+		if err != ErrNotFound {
+			t.Fatalf("GetEntryBySlug() returned %v, want ErrNotFound", err)
 			return
 		}
 		if ev != nil {
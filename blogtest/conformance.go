@@ -0,0 +1,1663 @@
+// Package blogtest provides a conformance test suite that every
+// blog.BlogManager implementation is expected to pass, along with minimal
+// security.AccessManager and security.Session implementations for testing
+// without a database.
+package blogtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zaddok/blog"
+	"gitlab.com/montebo/security"
+)
+
+// Fixture is a BlogManager under test and the sessions used to exercise it.
+type Fixture struct {
+	// Manager is the BlogManager under test.
+	Manager blog.BlogManager
+
+	// Session is an authenticated session with the editor role. The site
+	// must have no blog entries.
+	Session security.Session
+
+	// Author is an optional authenticated session on the same site as
+	// Session with the author role but not the editor role. Its person
+	// must be known to the access manager. Cases needing it are skipped
+	// when it is nil.
+	Author security.Session
+
+	// Reader is an optional authenticated session on the same site as
+	// Session with neither the editor nor the author role. Cases needing
+	// it are skipped when it is nil.
+	Reader security.Session
+
+	// OtherSite is an authenticated session on a second site that also
+	// has no blog entries.
+	OtherSite security.Session
+
+	// Anonymous is an optional unauthenticated session on the same site
+	// as Session. Cases needing it are skipped when it is nil.
+	Anonymous security.Session
+
+	// Authors are at least two distinct people on the same site as Session.
+	Authors []security.Person
+}
+
+// Factory returns a new Fixture. It is called once for every test case so
+// that cases do not share blog entries.
+type Factory func(t *testing.T) *Fixture
+
+// RunConformance runs every conformance test against the BlogManager
+// returned by factory.
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, f *Fixture)
+	}{
+		{"AddEntry", testAddEntry},
+		{"GetEntry", testGetEntry},
+		{"Ordering", testOrdering},
+		{"Limits", testLimits},
+		{"Deleted", testDeleted},
+		{"SiteIsolation", testSiteIsolation},
+		{"Caching", testCaching},
+		{"UpdateEntry", testUpdateEntry},
+		{"Format", testFormat},
+		{"DeleteEntry", testDeleteEntry},
+		{"Trash", testTrash},
+		{"Revisions", testRevisions},
+		{"Status", testStatus},
+		{"StatusPermissions", testStatusPermissions},
+		{"Ownership", testOwnership},
+		{"Visibility", testVisibility},
+		{"ListEntries", testListEntries},
+		{"Search", testSearch},
+		{"Slugs", testSlugs},
+		{"ResolveSlug", testResolveSlug},
+		{"SetSlug", testSetSlug},
+		{"Context", testContext},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			f := factory(t)
+			if len(f.Authors) < 2 {
+				t.Fatalf("Fixture must have at least two authors")
+			}
+			tc.test(t, f)
+		})
+	}
+}
+
+// showHidden is the context most cases read with, so that the editor
+// session sees every entry. testVisibility covers reads without it.
+var showHidden = blog.ShowHidden(context.Background())
+
+// entries are the blog entries added by seed. Their titles share the word
+// "post" so that all of them can be found by SearchEntries.
+type entries struct {
+	alpha, beta, gamma, delta, epsilon blog.Entry
+}
+
+func seed(t *testing.T, f *Fixture) *entries {
+	t.Helper()
+
+	return &entries{
+		alpha:   add(t, f, "Alpha post", "2001/1/1", f.Authors[0], "News", "Go"),
+		beta:    add(t, f, "Beta post", "2002/1/1", f.Authors[1], "news"),
+		gamma:   add(t, f, "Gamma post", "2003/1/1", f.Authors[0], "Big News"),
+		delta:   add(t, f, "Delta post", "2100/1/1", f.Authors[1], "news"),
+		epsilon: add(t, f, "Epsilon post", "2101/1/1", f.Authors[0]),
+	}
+}
+
+func add(t *testing.T, f *Fixture, title, date string, author security.Person, tags ...string) blog.Entry {
+	t.Helper()
+
+	d, err := time.Parse("2006/1/2", date)
+	if err != nil {
+		t.Fatalf("invalid date %q: %v", date, err)
+	}
+
+	e := f.Manager.NewEntry()
+	e.SetTitle(title)
+	e.SetDescription("Description of " + title)
+	e.SetText("Some *text* for " + title)
+	e.SetDate(d)
+	e.SetAuthor(author)
+	e.SetStatus(blog.StatusPublished)
+	if len(tags) > 0 {
+		e.SetTags(tags)
+	}
+	if err := f.Manager.AddEntry(e, f.Session); err != nil {
+		t.Fatalf("AddEntry(%q) failed: %v", title, err)
+	}
+	return e
+}
+
+// expect checks that items contains exactly the wanted entries in order.
+func expect(t *testing.T, method string, items []blog.Entry, err error, want ...blog.Entry) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("%s failed: %v", method, err)
+	}
+	if len(items) != len(want) {
+		t.Fatalf("%s returned %d entries %v, expected %d %v", method, len(items), titles(items), len(want), titles(want))
+	}
+	for i := range want {
+		if items[i].Uuid() != want[i].Uuid() {
+			t.Fatalf("%s returned %v, expected %v", method, titles(items), titles(want))
+		}
+	}
+}
+
+func titles(items []blog.Entry) string {
+	var t []string
+	for _, i := range items {
+		t = append(t, i.Title())
+	}
+	return "[" + strings.Join(t, ", ") + "]"
+}
+
+func testAddEntry(t *testing.T, f *Fixture) {
+	cases := []struct {
+		name    string
+		title   string
+		text    string
+		format  string
+		session security.Session
+		valid   bool
+		field   string
+	}{
+		{"valid", "Valid", "Text", "", f.Session, true, ""},
+		{"missing title", "", "Text", "", f.Session, false, "Title"},
+		{"missing text", "Missing text", "", "", f.Session, false, "Text"},
+		{"unknown format", "Unknown format", "Text", "rtf", f.Session, false, "Format"},
+		{"nil session", "Nil session", "Text", "", nil, false, ""},
+		{"anonymous", "Anonymous", "Text", "", f.Anonymous, false, ""},
+	}
+
+	for _, c := range cases {
+		if c.name == "anonymous" && f.Anonymous == nil {
+			continue
+		}
+		e := f.Manager.NewEntry()
+		e.SetTitle(c.title)
+		e.SetText(c.text)
+		if c.format != "" {
+			e.SetFormat(c.format)
+		}
+		e.SetDate(time.Now().Add(-time.Hour))
+		err := f.Manager.AddEntry(e, c.session)
+		if c.valid && err != nil {
+			t.Errorf("%s: AddEntry() failed unexpectedly: %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: AddEntry() should fail", c.name)
+		}
+		var invalid *blog.ErrValidation
+		if c.field != "" && (!errors.As(err, &invalid) || invalid.Fields[c.field] == "") {
+			t.Errorf("%s: AddEntry() returned %v, want an ErrValidation for %s", c.name, err, c.field)
+		}
+	}
+
+	items, err := f.Manager.GetEntriesContext(showHidden, f.Session)
+	if err != nil {
+		t.Fatalf("GetEntries() failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Title() != "Valid" {
+		t.Fatalf("Only the valid entry should have been added, found %v", titles(items))
+	}
+}
+
+func testGetEntry(t *testing.T, f *Fixture) {
+	e := f.Manager.NewEntry()
+	e.SetTitle("A Title")
+	e.SetDescription("Simple description")
+	e.SetCover("cover.jpg")
+	e.SetThumbnail("thumbnail.jpg")
+	e.SetText("Does _this_ blog entry need some *text*?")
+	e.SetDate(time.Date(2000, 1, 1, 10, 30, 0, 0, time.UTC))
+	e.SetAuthor(f.Authors[0])
+	e.SetTags([]string{"a", "b"})
+	if err := f.Manager.AddEntry(e, f.Session); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+
+	lookups := []struct {
+		name string
+		get  func() (blog.Entry, error)
+	}{
+		{"GetEntry", func() (blog.Entry, error) { return f.Manager.GetEntryContext(showHidden, e.Uuid(), f.Session) }},
+		{"GetEntryCached", func() (blog.Entry, error) { return f.Manager.GetEntryCachedContext(showHidden, e.Uuid(), f.Session) }},
+		{"GetEntryBySlug", func() (blog.Entry, error) { return f.Manager.GetEntryBySlugContext(showHidden, "a-title", f.Session) }},
+		{"GetEntryBySlugCached", func() (blog.Entry, error) {
+			return f.Manager.GetEntryBySlugCachedContext(showHidden, "a-title", f.Session)
+		}},
+	}
+
+	for _, l := range lookups {
+		ev, err := l.get()
+		if err != nil {
+			t.Fatalf("%s() failed: %v", l.name, err)
+		}
+		if ev == nil {
+			t.Fatalf("%s() returned nil", l.name)
+		}
+		if ev.Uuid() != e.Uuid() {
+			t.Errorf("%s() incorrect uuid %v", l.name, ev.Uuid())
+		}
+		if ev.Title() != "A Title" || ev.Slug() != "a-title" {
+			t.Errorf("%s() incorrect title %q or slug %q", l.name, ev.Title(), ev.Slug())
+		}
+		if ev.Description() != "Simple description" || ev.Text() != e.Text() {
+			t.Errorf("%s() incorrect description %q or text %q", l.name, ev.Description(), ev.Text())
+		}
+		if ev.Cover() != "cover.jpg" || ev.Thumbnail() != "thumbnail.jpg" {
+			t.Errorf("%s() incorrect cover %q or thumbnail %q", l.name, ev.Cover(), ev.Thumbnail())
+		}
+		if !strings.Contains(ev.Html(), "<em>this</em>") {
+			t.Errorf("%s() did not render Markdown text, returned %q", l.name, ev.Html())
+		}
+		if strings.Join(ev.Tags(), "|") != "a|b" {
+			t.Errorf("%s() incorrect tags %v", l.name, ev.Tags())
+		}
+		if ev.Date() == nil || ev.Date().Unix() != e.Date().Unix() {
+			t.Errorf("%s() incorrect date %v", l.name, ev.Date())
+		}
+		if ev.Created() == nil || ev.Updated() == nil {
+			t.Errorf("%s() should set created and updated times", l.name)
+		}
+		if ev.AuthorUUID() != f.Authors[0].Uuid() || ev.Author() == nil || ev.Author().Uuid() != f.Authors[0].Uuid() {
+			t.Errorf("%s() did not load the author", l.name)
+		}
+	}
+
+	missing := []struct {
+		name string
+		get  func() (blog.Entry, error)
+	}{
+		{"GetEntry", func() (blog.Entry, error) { return f.Manager.GetEntryContext(showHidden, "missing", f.Session) }},
+		{"GetEntryCached", func() (blog.Entry, error) { return f.Manager.GetEntryCachedContext(showHidden, "", f.Session) }},
+		{"GetEntryBySlug", func() (blog.Entry, error) {
+			return f.Manager.GetEntryBySlugContext(showHidden, "a-title-archie", f.Session)
+		}},
+		{"GetEntryBySlugCached", func() (blog.Entry, error) { return f.Manager.GetEntryBySlugCachedContext(showHidden, "", f.Session) }},
+	}
+
+	for _, l := range missing {
+		ev, err := l.get()
+		if !errors.Is(err, blog.ErrNotFound) {
+			t.Errorf("%s() returned %v, want ErrNotFound", l.name, err)
+		}
+		if ev != nil {
+			t.Errorf("%s() should not find an entry", l.name)
+		}
+	}
+
+	if _, err := f.Manager.GetEntryContext(showHidden, e.Uuid(), nil); !errors.Is(err, blog.ErrInvalidSession) {
+		t.Errorf("GetEntry() without a session returned %v, want ErrInvalidSession", err)
+	}
+}
+
+func testOrdering(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	cases := []struct {
+		name string
+		list func() ([]blog.Entry, error)
+		want []blog.Entry
+	}{
+		{"GetEntries", func() ([]blog.Entry, error) {
+			return f.Manager.GetEntriesContext(showHidden, f.Session)
+		}, []blog.Entry{s.epsilon, s.delta, s.gamma, s.beta, s.alpha}},
+		{"GetRecentEntries", func() ([]blog.Entry, error) {
+			return f.Manager.GetRecentEntriesContext(showHidden, 10, f.Session)
+		}, []blog.Entry{s.gamma, s.beta, s.alpha}},
+		{"GetFutureEntries", func() ([]blog.Entry, error) {
+			return f.Manager.GetFutureEntriesContext(showHidden, f.Session)
+		}, []blog.Entry{s.epsilon, s.delta}},
+		{"GetEntriesByTag", func() ([]blog.Entry, error) {
+			return f.Manager.GetEntriesByTagContext(showHidden, " NEWS ", 10, f.Session)
+		}, []blog.Entry{s.beta, s.alpha}},
+		{"GetEntriesByTag several words", func() ([]blog.Entry, error) {
+			return f.Manager.GetEntriesByTagContext(showHidden, " big news", 10, f.Session)
+		}, []blog.Entry{s.gamma}},
+		{"GetEntriesByTag several words as stored", func() ([]blog.Entry, error) {
+			return f.Manager.GetEntriesByTagContext(showHidden, "Big-News", 10, f.Session)
+		}, []blog.Entry{s.gamma}},
+		{"GetEntriesByTag empty", func() ([]blog.Entry, error) {
+			return f.Manager.GetEntriesByTagContext(showHidden, "", 10, f.Session)
+		}, nil},
+		{"GetEntriesByAuthor", func() ([]blog.Entry, error) {
+			return f.Manager.GetEntriesByAuthorContext(showHidden, f.Authors[0].Uuid(), f.Session)
+		}, []blog.Entry{s.epsilon, s.gamma, s.alpha}},
+		{"SearchEntries", func() ([]blog.Entry, error) {
+			return f.Manager.SearchEntriesContext(showHidden, "post", f.Session)
+		}, []blog.Entry{s.epsilon, s.delta, s.gamma, s.beta, s.alpha}},
+		{"SearchEntries two keywords", func() ([]blog.Entry, error) {
+			return f.Manager.SearchEntriesContext(showHidden, "Beta POST", f.Session)
+		}, []blog.Entry{s.beta}},
+		{"SearchEntries no match", func() ([]blog.Entry, error) {
+			return f.Manager.SearchEntriesContext(showHidden, "beta gamma", f.Session)
+		}, nil},
+		{"SearchEntries empty", func() ([]blog.Entry, error) {
+			return f.Manager.SearchEntriesContext(showHidden, " ", f.Session)
+		}, nil},
+	}
+
+	for _, c := range cases {
+		items, err := c.list()
+		expect(t, c.name, items, err, c.want...)
+	}
+}
+
+func testLimits(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	cases := []struct {
+		name  string
+		limit int
+		list  func(limit int) ([]blog.Entry, error)
+		want  []blog.Entry
+	}{
+		{"GetRecentEntries", 1, func(limit int) ([]blog.Entry, error) {
+			return f.Manager.GetRecentEntriesContext(showHidden, limit, f.Session)
+		}, []blog.Entry{s.gamma}},
+		{"GetRecentEntries", 2, func(limit int) ([]blog.Entry, error) {
+			return f.Manager.GetRecentEntriesContext(showHidden, limit, f.Session)
+		}, []blog.Entry{s.gamma, s.beta}},
+		{"GetRecentEntries", 3, func(limit int) ([]blog.Entry, error) {
+			return f.Manager.GetRecentEntriesContext(showHidden, limit, f.Session)
+		}, []blog.Entry{s.gamma, s.beta, s.alpha}},
+		{"GetEntriesByTag", 1, func(limit int) ([]blog.Entry, error) {
+			return f.Manager.GetEntriesByTagContext(showHidden, "news", limit, f.Session)
+		}, []blog.Entry{s.beta}},
+		{"GetEntriesByTag", 5, func(limit int) ([]blog.Entry, error) {
+			return f.Manager.GetEntriesByTagContext(showHidden, "news", limit, f.Session)
+		}, []blog.Entry{s.beta, s.alpha}},
+	}
+
+	for _, c := range cases {
+		items, err := c.list(c.limit)
+		expect(t, c.name, items, err, c.want...)
+	}
+}
+
+func testDeleted(t *testing.T, f *Fixture) {
+	e := f.Manager.NewEntry()
+	e.SetTitle("Deleted entry")
+	e.SetText("Text")
+	e.SetDate(time.Now().Add(-time.Hour))
+	e.SetDeleted(true)
+	if err := f.Manager.AddEntry(e, f.Session); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+
+	ev, err := f.Manager.GetEntryContext(showHidden, e.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	if ev == nil || !ev.Deleted() {
+		t.Fatalf("GetEntry() should return the entry flagged as deleted")
+	}
+
+	items, err := f.Manager.GetEntriesContext(showHidden, f.Session)
+	expect(t, "GetEntries", items, err, e)
+	if !items[0].Deleted() {
+		t.Fatalf("GetEntries() should return the entry flagged as deleted")
+	}
+}
+
+func testSiteIsolation(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+	o := f.OtherSite
+
+	lookups := []struct {
+		name string
+		get  func() (blog.Entry, error)
+	}{
+		{"GetEntry", func() (blog.Entry, error) { return f.Manager.GetEntryContext(showHidden, s.alpha.Uuid(), o) }},
+		{"GetEntryBySlug", func() (blog.Entry, error) { return f.Manager.GetEntryBySlugContext(showHidden, s.alpha.Slug(), o) }},
+	}
+	for _, l := range lookups {
+		ev, err := l.get()
+		if !errors.Is(err, blog.ErrNotFound) {
+			t.Errorf("%s() returned %v, want ErrNotFound", l.name, err)
+		}
+		if ev != nil {
+			t.Errorf("%s() returned an entry from another site", l.name)
+		}
+	}
+
+	lists := []struct {
+		name string
+		list func() ([]blog.Entry, error)
+	}{
+		{"GetEntries", func() ([]blog.Entry, error) { return f.Manager.GetEntriesContext(showHidden, o) }},
+		{"GetRecentEntries", func() ([]blog.Entry, error) { return f.Manager.GetRecentEntriesContext(showHidden, 10, o) }},
+		{"GetFutureEntries", func() ([]blog.Entry, error) { return f.Manager.GetFutureEntriesContext(showHidden, o) }},
+		{"GetEntriesByTag", func() ([]blog.Entry, error) { return f.Manager.GetEntriesByTagContext(showHidden, "news", 10, o) }},
+		{"GetEntriesByAuthor", func() ([]blog.Entry, error) {
+			return f.Manager.GetEntriesByAuthorContext(showHidden, f.Authors[0].Uuid(), o)
+		}},
+		{"SearchEntries", func() ([]blog.Entry, error) { return f.Manager.SearchEntriesContext(showHidden, "post", o) }},
+	}
+	for _, l := range lists {
+		items, err := l.list()
+		expect(t, l.name, items, err)
+	}
+
+	if err := f.Manager.UpdateEntry(s.alpha, o); err == nil {
+		t.Errorf("UpdateEntry() should not update an entry on another site")
+	}
+	if err := f.Manager.DeleteEntry(s.alpha.Uuid(), o); err == nil {
+		t.Errorf("DeleteEntry() should not delete an entry on another site")
+	}
+	if ev, err := f.Manager.GetEntryContext(showHidden, s.alpha.Uuid(), f.Session); err != nil || ev == nil {
+		t.Errorf("Entry should not be affected by another site: %v", err)
+	}
+}
+
+func testCaching(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	ev, err := f.Manager.GetEntryCachedContext(showHidden, s.beta.Uuid(), f.Session)
+	if err != nil || ev == nil {
+		t.Fatalf("GetEntryCached() failed: %v", err)
+	}
+	ev, err = f.Manager.GetEntryBySlugCachedContext(showHidden, s.beta.Slug(), f.Session)
+	if err != nil || ev == nil {
+		t.Fatalf("GetEntryBySlugCached() failed: %v", err)
+	}
+
+	// Changes to an entry that are not saved are not seen by other readers.
+	ev.SetTitle("Unsaved title")
+	ev.SetTags([]string{"unsaved"})
+	for _, read := range []struct {
+		name string
+		get  func() (blog.Entry, error)
+	}{
+		{"GetEntryCached", func() (blog.Entry, error) {
+			return f.Manager.GetEntryCachedContext(showHidden, s.beta.Uuid(), f.Session)
+		}},
+		{"GetEntryBySlugCached", func() (blog.Entry, error) {
+			return f.Manager.GetEntryBySlugCachedContext(showHidden, s.beta.Slug(), f.Session)
+		}},
+		{"GetEntry", func() (blog.Entry, error) { return f.Manager.GetEntryContext(showHidden, s.beta.Uuid(), f.Session) }},
+	} {
+		e, err := read.get()
+		if err != nil || e == nil {
+			t.Fatalf("%s() failed: %v", read.name, err)
+		}
+		if e.Title() != s.beta.Title() || strings.Join(e.Tags(), "|") != "news" {
+			t.Errorf("%s() returned unsaved changes to another copy of the entry: %q %v", read.name, e.Title(), e.Tags())
+		}
+		e.SetTitle("Changed by " + read.name)
+	}
+	if e, err := f.Manager.GetEntryCachedContext(showHidden, s.beta.Uuid(), f.Session); err != nil || e.Title() != s.beta.Title() {
+		t.Errorf("GetEntryCached() returned unsaved changes to an entry it returned before")
+	}
+
+	ev, _ = f.Manager.GetEntryContext(showHidden, s.beta.Uuid(), f.Session)
+	ev.SetDescription("Changed description")
+	if err := f.Manager.UpdateEntry(ev, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+
+	ev, err = f.Manager.GetEntryCachedContext(showHidden, s.beta.Uuid(), f.Session)
+	if err != nil || ev == nil {
+		t.Fatalf("GetEntryCached() failed: %v", err)
+	}
+	if ev.Description() != "Changed description" {
+		t.Errorf("GetEntryCached() returned a stale entry after UpdateEntry()")
+	}
+	if ev.Author() == nil {
+		t.Errorf("GetEntryCached() returned an entry without an author after UpdateEntry()")
+	}
+	ev, err = f.Manager.GetEntryBySlugCachedContext(showHidden, s.beta.Slug(), f.Session)
+	if err != nil || ev == nil {
+		t.Fatalf("GetEntryBySlugCached() failed: %v", err)
+	}
+	if ev.Description() != "Changed description" {
+		t.Errorf("GetEntryBySlugCached() returned a stale entry after UpdateEntry()")
+	}
+
+	if err := f.Manager.DeleteEntry(s.beta.Uuid(), f.Session); err != nil {
+		t.Fatalf("DeleteEntry() failed: %v", err)
+	}
+	if ev, err := f.Manager.GetEntryCached(s.beta.Uuid(), f.Session); ev != nil || !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("GetEntryCached() returned an entry after DeleteEntry()")
+	}
+	if ev, err := f.Manager.GetEntryBySlugCached(s.beta.Slug(), f.Session); ev != nil || !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("GetEntryBySlugCached() returned an entry after DeleteEntry()")
+	}
+}
+
+func testUpdateEntry(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	ev, err := f.Manager.GetEntryContext(showHidden, s.alpha.Uuid(), f.Session)
+	if err != nil || ev == nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	date := time.Date(2004, 2, 3, 0, 0, 0, 0, time.UTC)
+	ev.SetTitle("Updated title")
+	ev.SetDescription("Updated description")
+	ev.SetText("t2")
+	ev.SetCover("coverV.jpg")
+	ev.SetThumbnail("thumbnailV.jpg")
+	ev.SetTags([]string{"z", "x", "y"})
+	ev.SetDate(date)
+	if err := f.Manager.UpdateEntry(ev, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+
+	ev, err = f.Manager.GetEntryContext(showHidden, s.alpha.Uuid(), f.Session)
+	if err != nil || ev == nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	if ev.Title() != "Updated title" || ev.Description() != "Updated description" || ev.Text() != "t2" {
+		t.Errorf("UpdateEntry() did not save title, description or text")
+	}
+	if ev.Html() != "<p>t2</p>\n" {
+		t.Errorf("UpdateEntry() did not render the updated text, found %q", ev.Html())
+	}
+	if ev.Cover() != "coverV.jpg" || ev.Thumbnail() != "thumbnailV.jpg" {
+		t.Errorf("UpdateEntry() did not save cover or thumbnail")
+	}
+	if strings.Join(ev.Tags(), "|") != "z|x|y" {
+		t.Errorf("UpdateEntry() did not save tags, found %v", ev.Tags())
+	}
+	if ev.Date() == nil || ev.Date().Unix() != date.Unix() {
+		t.Errorf("UpdateEntry() did not save date, found %v", ev.Date())
+	}
+	if ev.Slug() != s.alpha.Slug() {
+		t.Errorf("UpdateEntry() should not change the slug, found %v", ev.Slug())
+	}
+	if ev.Updated() == nil || ev.Created() == nil || ev.Updated().Before(*ev.Created()) {
+		t.Errorf("UpdateEntry() did not set the updated time")
+	}
+
+	items, err := f.Manager.GetEntriesByTagContext(showHidden, "z", 10, f.Session)
+	expect(t, "GetEntriesByTag", items, err, s.alpha)
+	items, err = f.Manager.GetRecentEntriesContext(showHidden, 10, f.Session)
+	expect(t, "GetRecentEntries", items, err, s.alpha, s.gamma, s.beta)
+
+	missing := f.Manager.NewEntry()
+	missing.SetTitle("Missing")
+	missing.SetText("Text")
+	if err := f.Manager.UpdateEntry(missing, f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("UpdateEntry() of an entry that was never added returned %v, want ErrNotFound", err)
+	}
+}
+
+func testFormat(t *testing.T, f *Fixture) {
+	e := f.Manager.NewEntry()
+	e.SetTitle("Plain text")
+	e.SetText("Some *text*\nwith <breaks>")
+	e.SetFormat(blog.FormatText)
+	e.SetDate(time.Now().Add(-time.Hour))
+	if err := f.Manager.AddEntry(e, f.Session); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+
+	ev, err := f.Manager.GetEntryContext(showHidden, e.Uuid(), f.Session)
+	if err != nil || ev == nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	if ev.Format() != blog.FormatText {
+		t.Errorf("GetEntry() returned format %q", ev.Format())
+	}
+	if ev.Html() != "<p>Some *text*<br>\nwith &lt;breaks&gt;</p>\n" {
+		t.Errorf("GetEntry() returned html %q", ev.Html())
+	}
+
+	ev.SetFormat(blog.FormatHTML)
+	if err := f.Manager.UpdateEntry(ev, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+	ev, err = f.Manager.GetEntryContext(showHidden, e.Uuid(), f.Session)
+	if err != nil || ev == nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	if ev.Format() != blog.FormatHTML {
+		t.Errorf("UpdateEntry() did not save format, found %q", ev.Format())
+	}
+	if ev.Html() != "Some *text*\nwith " {
+		t.Errorf("UpdateEntry() did not render with the new format, found %q", ev.Html())
+	}
+}
+
+func testDeleteEntry(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	cases := []struct {
+		name    string
+		uuid    string
+		session security.Session
+		valid   bool
+	}{
+		{"empty uuid", "", f.Session, false},
+		{"missing", "missing", f.Session, false},
+		{"nil session", s.beta.Uuid(), nil, false},
+		{"anonymous", s.beta.Uuid(), f.Anonymous, false},
+		{"valid", s.beta.Uuid(), f.Session, true},
+		{"repeated", s.beta.Uuid(), f.Session, true},
+	}
+
+	for _, c := range cases {
+		if c.name == "anonymous" && f.Anonymous == nil {
+			continue
+		}
+		err := f.Manager.DeleteEntry(c.uuid, c.session)
+		if c.valid && err != nil {
+			t.Errorf("%s: DeleteEntry() failed unexpectedly: %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: DeleteEntry() should fail", c.name)
+		}
+	}
+
+	if ev, err := f.Manager.GetEntry(s.beta.Uuid(), f.Session); !errors.Is(err, blog.ErrDeleted) || ev != nil {
+		t.Errorf("GetEntry() of a deleted entry returned %v, want ErrDeleted", err)
+	}
+	ev, err := f.Manager.GetEntryContext(showHidden, s.beta.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetEntry() should find a deleted entry when showing hidden entries: %v", err)
+	}
+	if !ev.Deleted() || ev.DeletedAt() == nil {
+		t.Errorf("GetEntry() returned deleted %v at %v, want a deleted entry with a deletion time", ev.Deleted(), ev.DeletedAt())
+	}
+	if err := f.Manager.DeleteEntry("missing", f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("DeleteEntry() of a missing entry returned %v, want ErrNotFound", err)
+	}
+	items, err := f.Manager.GetEntries(f.Session)
+	expect(t, "GetEntries", items, err, s.gamma, s.alpha)
+}
+
+func testTrash(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	if _, err := f.Manager.GetDeletedEntries(nil); err == nil {
+		t.Errorf("GetDeletedEntries() should fail without a session")
+	}
+	items, err := f.Manager.GetDeletedEntries(f.Session)
+	expect(t, "GetDeletedEntries", items, err)
+
+	for _, e := range []blog.Entry{s.alpha, s.gamma, s.delta} {
+		if err := f.Manager.DeleteEntry(e.Uuid(), f.Session); err != nil {
+			t.Fatalf("DeleteEntry() failed: %v", err)
+		}
+	}
+	items, err = f.Manager.GetDeletedEntries(f.Session)
+	expect(t, "GetDeletedEntries", items, err, s.delta, s.gamma, s.alpha)
+	items, err = f.Manager.GetDeletedEntries(f.OtherSite)
+	expect(t, "GetDeletedEntries on another site", items, err)
+
+	if err := f.Manager.RestoreEntry(s.gamma.Uuid(), f.Session); err != nil {
+		t.Fatalf("RestoreEntry() failed: %v", err)
+	}
+	ev, err := f.Manager.GetEntry(s.gamma.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetEntry() of a restored entry failed: %v", err)
+	}
+	if ev.Deleted() || ev.DeletedAt() != nil {
+		t.Errorf("RestoreEntry() left the entry deleted %v at %v", ev.Deleted(), ev.DeletedAt())
+	}
+	if err := f.Manager.RestoreEntry("missing", f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("RestoreEntry() of a missing entry returned %v, want ErrNotFound", err)
+	}
+	revisions, err := f.Manager.GetRevisions(s.gamma.Uuid(), f.Session)
+	if err != nil || len(revisions) != 3 {
+		t.Errorf("DeleteEntry() and RestoreEntry() should each save a revision, got %d: %v", len(revisions), err)
+	}
+
+	var invalid *blog.ErrValidation
+	if err := f.Manager.PurgeEntry(s.gamma.Uuid(), f.Session); !errors.As(err, &invalid) {
+		t.Errorf("PurgeEntry() of an entry not in the trash returned %v, want ErrValidation", err)
+	}
+	if err := f.Manager.PurgeEntry(s.alpha.Uuid(), f.OtherSite); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("PurgeEntry() on another site returned %v, want ErrNotFound", err)
+	}
+	if err := f.Manager.PurgeEntry(s.alpha.Uuid(), f.Session); err != nil {
+		t.Fatalf("PurgeEntry() failed: %v", err)
+	}
+	if _, err := f.Manager.GetEntryContext(showHidden, s.alpha.Uuid(), f.Session); !errors.Is(err, blog.ErrNotFound) || errors.Is(err, blog.ErrDeleted) {
+		t.Errorf("GetEntry() of a purged entry returned %v, want ErrNotFound", err)
+	}
+	if err := f.Manager.PurgeEntry(s.alpha.Uuid(), f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("repeated PurgeEntry() returned %v, want ErrNotFound", err)
+	}
+
+	n, err := blog.PurgeExpired(context.Background(), f.Manager, time.Hour, f.Session)
+	if err != nil || n != 0 {
+		t.Errorf("PurgeExpired() of recently deleted entries purged %d: %v", n, err)
+	}
+	n, err = blog.PurgeExpired(context.Background(), f.Manager, 0, f.Session)
+	if err != nil || n != 1 {
+		t.Errorf("PurgeExpired() purged %d, want 1: %v", n, err)
+	}
+	items, err = f.Manager.GetDeletedEntries(f.Session)
+	expect(t, "GetDeletedEntries after PurgeExpired", items, err)
+	items, err = f.Manager.GetEntriesContext(showHidden, f.Session)
+	expect(t, "GetEntries after PurgeExpired", items, err, s.epsilon, s.gamma, s.beta)
+}
+
+func testRevisions(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	revisions, err := f.Manager.GetRevisions(s.alpha.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetRevisions() failed: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].Number != 1 {
+		t.Fatalf("GetRevisions() after AddEntry returned %d revisions, want 1", len(revisions))
+	}
+
+	e, err := f.Manager.GetEntryContext(showHidden, s.alpha.Uuid(), f.Session)
+	if err != nil || e == nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	e.SetTitle("Alpha revised")
+	e.SetText("alpha\nrevised")
+	if err := f.Manager.UpdateEntry(e, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+
+	revisions, err = f.Manager.GetRevisions(s.alpha.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetRevisions() failed: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Number != 2 || revisions[1].Number != 1 {
+		t.Fatalf("GetRevisions() after UpdateEntry returned %d revisions, want 2 newest first", len(revisions))
+	}
+	if revisions[0].Entry.Title() != "Alpha revised" {
+		t.Errorf("revision 2 has title %q, want %q", revisions[0].Entry.Title(), "Alpha revised")
+	}
+
+	first, err := f.Manager.GetRevision(s.alpha.Uuid(), 1, f.Session)
+	if err != nil || first == nil {
+		t.Fatalf("GetRevision(1) failed: %v", err)
+	}
+	if first.Entry.Title() != s.alpha.Title() {
+		t.Errorf("revision 1 has title %q, want %q", first.Entry.Title(), s.alpha.Title())
+	}
+	if first.PersonUuid != f.Session.PersonUuid() {
+		t.Errorf("revision 1 saved by %q, want %q", first.PersonUuid, f.Session.PersonUuid())
+	}
+	if first.Entry.Author() == nil || first.Entry.Author().Uuid() != s.alpha.Author().Uuid() {
+		t.Errorf("revision 1 should have the entry author")
+	}
+
+	diff := blog.DiffRevisions(first, revisions[0])
+	if len(diff) == 0 {
+		t.Errorf("DiffRevisions() returned no changes")
+	}
+
+	if err := f.Manager.RestoreRevision(s.alpha.Uuid(), 1, f.Session); err != nil {
+		t.Fatalf("RestoreRevision() failed: %v", err)
+	}
+	e, err = f.Manager.GetEntryContext(showHidden, s.alpha.Uuid(), f.Session)
+	if err != nil || e == nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	if e.Title() != s.alpha.Title() || e.Text() != s.alpha.Text() {
+		t.Errorf("RestoreRevision() left title %q text %q", e.Title(), e.Text())
+	}
+	revisions, err = f.Manager.GetRevisions(s.alpha.Uuid(), f.Session)
+	if err != nil || len(revisions) != 3 {
+		t.Errorf("GetRevisions() after RestoreRevision returned %d revisions, want 3: %v", len(revisions), err)
+	}
+
+	if _, err := f.Manager.GetRevision(s.alpha.Uuid(), 9, f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("GetRevision() of a missing revision returned %v, want ErrNotFound", err)
+	}
+	if err := f.Manager.RestoreRevision(s.alpha.Uuid(), 9, f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("RestoreRevision() of a missing revision returned %v, want ErrNotFound", err)
+	}
+
+	// Restoring a revision without a date clears the date.
+	undated := f.Manager.NewEntry()
+	undated.SetTitle("Undated draft")
+	undated.SetText("Not dated yet")
+	undated.SetStatus(blog.StatusDraft)
+	if err := f.Manager.AddEntry(undated, f.Session); err != nil {
+		t.Fatalf("AddEntry() of an undated draft failed: %v", err)
+	}
+	undated.SetDate(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err := f.Manager.UpdateEntry(undated, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+	if err := f.Manager.RestoreRevision(undated.Uuid(), 1, f.Session); err != nil {
+		t.Fatalf("RestoreRevision() failed: %v", err)
+	}
+	if e, err := f.Manager.GetEntryContext(showHidden, undated.Uuid(), f.Session); err != nil {
+		t.Errorf("GetEntry() failed: %v", err)
+	} else if e.Date() != nil {
+		t.Errorf("RestoreRevision() of an undated revision left date %v", e.Date())
+	}
+
+	// Restoring a revision keeps the current status and slug.
+	kept := f.Manager.NewEntry()
+	kept.SetTitle("Kept status")
+	kept.SetText("Kept text")
+	kept.SetDate(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC))
+	kept.SetStatus(blog.StatusDraft)
+	if err := f.Manager.AddEntry(kept, f.Session); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+	kept.SetSlug("kept-renamed")
+	kept.SetStatus(blog.StatusPublished)
+	kept.SetText("Changed text")
+	if err := f.Manager.UpdateEntry(kept, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+	if err := f.Manager.RestoreRevision(kept.Uuid(), 1, f.Session); err != nil {
+		t.Fatalf("RestoreRevision() failed: %v", err)
+	}
+	if e, err := f.Manager.GetEntryContext(showHidden, kept.Uuid(), f.Session); err != nil {
+		t.Errorf("GetEntry() failed: %v", err)
+	} else if e.Text() != "Kept text" || e.Slug() != "kept-renamed" || e.Status() != blog.StatusPublished {
+		t.Errorf("RestoreRevision() left text %q slug %q status %q, want the revision text with the current slug and status", e.Text(), e.Slug(), e.Status())
+	}
+
+	if f.Anonymous != nil {
+		if _, err := f.Manager.GetRevisions(s.alpha.Uuid(), f.Anonymous); err == nil {
+			t.Errorf("GetRevisions() should fail for an anonymous session")
+		}
+	}
+	var forbidden *blog.ErrForbidden
+	for name, session := range map[string]security.Session{"reader": f.Reader, "author": f.Author} {
+		if session == nil {
+			continue
+		}
+		if _, err := f.Manager.GetRevisions(s.alpha.Uuid(), session); !errors.As(err, &forbidden) {
+			t.Errorf("GetRevisions() of another person's entry by %s returned %v, want ErrForbidden", name, err)
+		}
+		if _, err := f.Manager.GetRevision(s.alpha.Uuid(), 1, session); !errors.As(err, &forbidden) {
+			t.Errorf("GetRevision() of another person's entry by %s returned %v, want ErrForbidden", name, err)
+		}
+		if err := f.Manager.RestoreRevision(s.alpha.Uuid(), 1, session); !errors.As(err, &forbidden) {
+			t.Errorf("RestoreRevision() of another person's entry by %s returned %v, want ErrForbidden", name, err)
+		}
+	}
+	if _, err := f.Manager.GetRevisions(s.alpha.Uuid(), f.OtherSite); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("GetRevisions() on another site returned %v, want ErrNotFound", err)
+	}
+}
+
+func testStatus(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	draft := f.Manager.NewEntry()
+	draft.SetTitle("Draft post")
+	draft.SetText("Draft text")
+	if draft.Status() != blog.StatusDraft {
+		t.Errorf("NewEntry() has status %q, want %q", draft.Status(), blog.StatusDraft)
+	}
+	if err := f.Manager.AddEntry(draft, f.Session); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+
+	future := time.Now().Add(48 * time.Hour)
+	scheduled := f.Manager.NewEntry()
+	scheduled.SetTitle("Scheduled post")
+	scheduled.SetText("Scheduled text")
+	scheduled.SetStatus(blog.StatusScheduled)
+	if err := f.Manager.AddEntry(scheduled, f.Session); err == nil {
+		t.Errorf("AddEntry() of a scheduled entry without a future date should fail")
+	}
+	scheduled.SetDate(future)
+	if err := f.Manager.AddEntry(scheduled, f.Session); err != nil {
+		t.Fatalf("AddEntry() of a scheduled entry failed: %v", err)
+	}
+
+	invalid := f.Manager.NewEntry()
+	invalid.SetTitle("Invalid post")
+	invalid.SetText("Invalid text")
+	invalid.SetStatus("pending")
+	var validation *blog.ErrValidation
+	if err := f.Manager.AddEntry(invalid, f.Session); !errors.As(err, &validation) || validation.Fields["Status"] == "" {
+		t.Errorf("AddEntry() with an unknown status returned %v, want an ErrValidation", err)
+	}
+
+	items, err := f.Manager.GetEntriesByStatusContext(showHidden, blog.StatusDraft, f.Session)
+	expect(t, "GetEntriesByStatus(draft)", items, err, draft)
+	items, err = f.Manager.GetEntriesByStatusContext(showHidden, blog.StatusScheduled, f.Session)
+	expect(t, "GetEntriesByStatus(scheduled)", items, err, scheduled)
+	items, err = f.Manager.GetEntriesByStatusContext(showHidden, blog.StatusPublished, f.Session)
+	expect(t, "GetEntriesByStatus(published)", items, err, s.epsilon, s.delta, s.gamma, s.beta, s.alpha)
+
+	steps := []struct {
+		status string
+		valid  bool
+	}{
+		{blog.StatusInReview, true},
+		{blog.StatusArchived, false},
+		{blog.StatusPublished, true},
+		{blog.StatusInReview, false},
+		{blog.StatusArchived, true},
+		{blog.StatusDraft, true},
+	}
+	for _, step := range steps {
+		e, err := f.Manager.GetEntryContext(showHidden, draft.Uuid(), f.Session)
+		if err != nil || e == nil {
+			t.Fatalf("GetEntry() failed: %v", err)
+		}
+		from := e.Status()
+		e.SetStatus(step.status)
+		err = f.Manager.UpdateEntry(e, f.Session)
+		if step.valid && err != nil {
+			t.Errorf("UpdateEntry() from %s to %s failed unexpectedly: %v", from, step.status, err)
+		}
+		if !step.valid && err == nil {
+			t.Errorf("UpdateEntry() from %s to %s should fail", from, step.status)
+		}
+		e, err = f.Manager.GetEntryContext(showHidden, draft.Uuid(), f.Session)
+		if err != nil || e == nil {
+			t.Fatalf("GetEntry() failed: %v", err)
+		}
+		if step.valid && e.Status() != step.status {
+			t.Errorf("UpdateEntry() left status %q, want %q", e.Status(), step.status)
+		}
+		if !step.valid && e.Status() != from {
+			t.Errorf("failed UpdateEntry() changed status from %q to %q", from, e.Status())
+		}
+	}
+}
+
+func testStatusPermissions(t *testing.T, f *Fixture) {
+	if f.Author == nil {
+		t.Skip("fixture has no author session")
+	}
+
+	e := f.Manager.NewEntry()
+	e.SetTitle("Author post")
+	e.SetText("Author text")
+	e.SetAuthor(authorPerson(t, f))
+	e.SetStatus(blog.StatusPublished)
+	if err := f.Manager.AddEntry(e, f.Author); err == nil {
+		t.Errorf("AddEntry() of a published entry by an author should fail")
+	}
+	e.SetStatus(blog.StatusDraft)
+	if err := f.Manager.AddEntry(e, f.Author); err != nil {
+		t.Fatalf("AddEntry() of a draft by an author failed: %v", err)
+	}
+
+	steps := []struct {
+		status  string
+		session security.Session
+		valid   bool
+	}{
+		{blog.StatusInReview, f.Author, true},
+		{blog.StatusPublished, f.Author, false},
+		{blog.StatusDraft, f.Author, true},
+		{blog.StatusInReview, f.Author, true},
+		{blog.StatusPublished, f.Session, true},
+		{blog.StatusDraft, f.Author, false},
+		{blog.StatusArchived, f.Author, false},
+	}
+	for _, step := range steps {
+		current, err := f.Manager.GetEntryContext(showHidden, e.Uuid(), f.Session)
+		if err != nil || current == nil {
+			t.Fatalf("GetEntry() failed: %v", err)
+		}
+		from := current.Status()
+		current.SetStatus(step.status)
+		err = f.Manager.UpdateEntry(current, step.session)
+		if step.valid && err != nil {
+			t.Errorf("UpdateEntry() from %s to %s by %s failed unexpectedly: %v", from, step.status, step.session.PersonUuid(), err)
+		}
+		if !step.valid && err == nil {
+			t.Errorf("UpdateEntry() from %s to %s by %s should fail", from, step.status, step.session.PersonUuid())
+		}
+	}
+
+	// Moving the date of a scheduled entry into the past publishes it,
+	// which an author may not do.
+	current, err := f.Manager.GetEntryContext(showHidden, e.Uuid(), f.Session)
+	if err != nil || current == nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	current.SetStatus(blog.StatusDraft)
+	if err := f.Manager.UpdateEntry(current, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() to draft failed: %v", err)
+	}
+	current.SetDate(time.Now().Add(24 * time.Hour))
+	current.SetStatus(blog.StatusScheduled)
+	if err := f.Manager.UpdateEntry(current, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() scheduling the entry failed: %v", err)
+	}
+	current.SetDate(time.Now().Add(-time.Hour))
+	current.SetStatus(blog.StatusScheduled)
+	var forbidden *blog.ErrForbidden
+	if err := f.Manager.UpdateEntry(current, f.Author); !errors.As(err, &forbidden) {
+		t.Errorf("UpdateEntry() moving a scheduled entry into the past by an author returned %v, want ErrForbidden", err)
+	}
+	if saved, err := f.Manager.GetEntryContext(showHidden, e.Uuid(), f.Session); err != nil || saved.Status() != blog.StatusScheduled {
+		t.Errorf("UpdateEntry() by an author published a scheduled entry: %v", err)
+	}
+	if err := f.Manager.UpdateEntry(current, f.Session); err != nil {
+		t.Errorf("UpdateEntry() moving a scheduled entry into the past by an editor failed: %v", err)
+	}
+}
+
+// authorPerson returns the person of the author session.
+func authorPerson(t *testing.T, f *Fixture) security.Person {
+	t.Helper()
+
+	p, err := f.Manager.AccessManager().GetPersonCached(f.Author.PersonUuid(), f.Session)
+	if err != nil || p == nil {
+		t.Fatalf("GetPersonCached() of the author session person failed: %v", err)
+	}
+	return p
+}
+
+func testOwnership(t *testing.T, f *Fixture) {
+	if f.Author == nil {
+		t.Skip("fixture has no author session")
+	}
+	writer := authorPerson(t, f)
+	noRole := NewSession(f.Session.Site(), f.Author.PersonUuid())
+
+	forbidden := func(action string, err error) {
+		t.Helper()
+		var e *blog.ErrForbidden
+		if !errors.As(err, &e) {
+			t.Errorf("%s should fail with ErrForbidden, not %v", action, err)
+		}
+	}
+	newEntry := func(title string, author security.Person) blog.Entry {
+		e := f.Manager.NewEntry()
+		e.SetTitle(title)
+		e.SetText("Some text")
+		e.SetAuthor(author)
+		return e
+	}
+
+	forbidden("AddEntry() without a blog role", f.Manager.AddEntry(newEntry("No role", writer), noRole))
+	forbidden("AddEntry() by an author for another person", f.Manager.AddEntry(newEntry("Not mine", f.Authors[0]), f.Author))
+
+	own := newEntry("Mine", writer)
+	if err := f.Manager.AddEntry(own, f.Author); err != nil {
+		t.Fatalf("AddEntry() by an author failed: %v", err)
+	}
+	other := newEntry("Theirs", f.Authors[0])
+	if err := f.Manager.AddEntry(other, f.Session); err != nil {
+		t.Fatalf("AddEntry() by an editor failed: %v", err)
+	}
+
+	// Authors may change their own entries, but not give them away.
+	own.SetDescription("Changed by the author")
+	if err := f.Manager.UpdateEntry(own, f.Author); err != nil {
+		t.Errorf("UpdateEntry() of their own entry by an author failed: %v", err)
+	}
+	own.SetAuthor(f.Authors[0])
+	forbidden("UpdateEntry() giving an entry to another person", f.Manager.UpdateEntry(own, f.Author))
+	own.SetAuthor(writer)
+	forbidden("UpdateEntry() without a blog role", f.Manager.UpdateEntry(own, noRole))
+
+	other.SetDescription("Changed by the author")
+	forbidden("UpdateEntry() of another person's entry", f.Manager.UpdateEntry(other, f.Author))
+	other.SetAuthor(writer)
+	forbidden("UpdateEntry() taking another person's entry", f.Manager.UpdateEntry(other, f.Author))
+	forbidden("DeleteEntry() of another person's entry", f.Manager.DeleteEntry(other.Uuid(), f.Author))
+	if e, err := f.Manager.GetEntryContext(showHidden, other.Uuid(), f.Session); err != nil || e == nil || e.AuthorUUID() != f.Authors[0].Uuid() || e.Description() != "" {
+		t.Errorf("forbidden changes were saved: %v", err)
+	}
+
+	// Editors may change every entry.
+	own.SetDescription("Changed by an editor")
+	if err := f.Manager.UpdateEntry(own, f.Session); err != nil {
+		t.Errorf("UpdateEntry() of an author's entry by an editor failed: %v", err)
+	}
+	if err := f.Manager.DeleteEntry(other.Uuid(), f.Session); err != nil {
+		t.Errorf("DeleteEntry() by an editor failed: %v", err)
+	}
+	forbidden("DeleteEntry() without a blog role", f.Manager.DeleteEntry(own.Uuid(), noRole))
+	if err := f.Manager.DeleteEntry(own.Uuid(), f.Author); err != nil {
+		t.Errorf("DeleteEntry() of their own entry by an author failed: %v", err)
+	}
+
+	// Authors only see and manage their own entries in the trash.
+	items, err := f.Manager.GetDeletedEntries(f.Author)
+	expect(t, "GetDeletedEntries() by an author", items, err, own)
+	forbidden("RestoreEntry() of another person's entry", f.Manager.RestoreEntry(other.Uuid(), f.Author))
+	forbidden("PurgeEntry() of another person's entry", f.Manager.PurgeEntry(other.Uuid(), f.Author))
+	forbidden("PurgeEntry() without a blog role", f.Manager.PurgeEntry(own.Uuid(), noRole))
+	if err := f.Manager.RestoreEntry(own.Uuid(), f.Author); err != nil {
+		t.Errorf("RestoreEntry() of their own entry by an author failed: %v", err)
+	}
+	if err := f.Manager.DeleteEntry(own.Uuid(), f.Author); err != nil {
+		t.Errorf("DeleteEntry() of their own entry by an author failed: %v", err)
+	}
+	if err := f.Manager.PurgeEntry(own.Uuid(), f.Author); err != nil {
+		t.Errorf("PurgeEntry() of their own entry by an author failed: %v", err)
+	}
+}
+
+func testVisibility(t *testing.T, f *Fixture) {
+	public := add(t, f, "Public post", "2001/1/1", f.Authors[0], "news")
+	older := add(t, f, "Older post", "2000/1/1", f.Authors[1], "news")
+	future := add(t, f, "Future post", "2100/1/1", f.Authors[0], "news")
+	deleted := add(t, f, "Deleted post", "2002/1/1", f.Authors[0], "news")
+	deleted.SetDeleted(true)
+	if err := f.Manager.UpdateEntry(deleted, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+	draft := add(t, f, "Draft post", "2003/1/1", f.Authors[1], "news")
+	draft.SetStatus(blog.StatusDraft)
+	if err := f.Manager.UpdateEntry(draft, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+
+	// Readers without hidden entries must not find them in the cache
+	if _, err := f.Manager.GetEntryCachedContext(showHidden, future.Uuid(), f.Session); err != nil {
+		t.Fatalf("GetEntryCached() failed: %v", err)
+	}
+
+	readers := []struct {
+		name    string
+		session security.Session
+	}{
+		{"editor", f.Session},
+		{"author", f.Author},
+		{"anonymous", f.Anonymous},
+	}
+	for _, r := range readers {
+		if r.session == nil {
+			continue
+		}
+		ctx := context.Background()
+		name := func(method string) string {
+			return method + " by " + r.name
+		}
+
+		items, err := f.Manager.GetEntriesContext(ctx, r.session)
+		expect(t, name("GetEntries"), items, err, public, older)
+		items, _, err = f.Manager.ListEntriesContext(ctx, blog.ListOptions{Limit: 2}, r.session)
+		expect(t, name("ListEntries"), items, err, public, older)
+		items, err = f.Manager.GetEntriesByTagContext(ctx, "news", 10, r.session)
+		expect(t, name("GetEntriesByTag"), items, err, public, older)
+		items, err = f.Manager.GetEntriesByAuthorContext(ctx, f.Authors[0].Uuid(), r.session)
+		expect(t, name("GetEntriesByAuthor"), items, err, public)
+		items, err = f.Manager.SearchEntriesContext(ctx, "post", r.session)
+		expect(t, name("SearchEntries"), items, err, public, older)
+		items, err = f.Manager.GetFutureEntriesContext(ctx, r.session)
+		expect(t, name("GetFutureEntries"), items, err)
+		items, err = f.Manager.GetEntriesByStatusContext(ctx, blog.StatusDraft, r.session)
+		expect(t, name("GetEntriesByStatus"), items, err)
+
+		for _, e := range []blog.Entry{future, draft} {
+			if _, err := f.Manager.GetEntryContext(ctx, e.Uuid(), r.session); !errors.Is(err, blog.ErrNotFound) || errors.Is(err, blog.ErrDeleted) {
+				t.Errorf("%s of %s returned %v, want ErrNotFound", name("GetEntry"), e.Title(), err)
+			}
+			if _, err := f.Manager.GetEntryCachedContext(ctx, e.Uuid(), r.session); !errors.Is(err, blog.ErrNotFound) {
+				t.Errorf("%s of %s returned %v, want ErrNotFound", name("GetEntryCached"), e.Title(), err)
+			}
+			if _, err := f.Manager.GetEntryBySlugContext(ctx, e.Slug(), r.session); !errors.Is(err, blog.ErrNotFound) {
+				t.Errorf("%s of %s returned %v, want ErrNotFound", name("GetEntryBySlug"), e.Title(), err)
+			}
+		}
+		if _, err := f.Manager.GetEntryContext(ctx, deleted.Uuid(), r.session); !errors.Is(err, blog.ErrDeleted) || !errors.Is(err, blog.ErrNotFound) {
+			t.Errorf("%s of a deleted entry returned %v, want ErrDeleted", name("GetEntry"), err)
+		}
+		if _, _, err := f.Manager.ResolveSlugContext(ctx, deleted.Slug(), r.session); !errors.Is(err, blog.ErrDeleted) {
+			t.Errorf("%s of a deleted entry returned %v, want ErrDeleted", name("ResolveSlug"), err)
+		}
+	}
+
+	// Asking for hidden entries only shows them to editors, and to authors
+	// for their own entries.
+	items, err := f.Manager.GetEntriesContext(showHidden, f.Session)
+	expect(t, "GetEntries by editor showing hidden entries", items, err, future, draft, deleted, public, older)
+	items, _, err = f.Manager.ListEntriesContext(showHidden, blog.ListOptions{Limit: 2}, f.Session)
+	expect(t, "ListEntries by editor showing hidden entries", items, err, future, draft)
+	if f.Author != nil {
+		own := f.Manager.NewEntry()
+		own.SetTitle("Own post")
+		own.SetText("Some text")
+		own.SetDate(time.Date(2004, 1, 1, 0, 0, 0, 0, time.UTC))
+		own.SetAuthor(authorPerson(t, f))
+		if err := f.Manager.AddEntry(own, f.Author); err != nil {
+			t.Fatalf("AddEntry() by an author failed: %v", err)
+		}
+		items, err := f.Manager.GetEntriesContext(showHidden, f.Author)
+		expect(t, "GetEntries by author showing hidden entries", items, err, own, public, older)
+		items, err = f.Manager.GetEntriesContext(context.Background(), f.Author)
+		expect(t, "GetEntries by author", items, err, public, older)
+	}
+	if f.Anonymous != nil {
+		items, err := f.Manager.GetEntriesContext(showHidden, f.Anonymous)
+		expect(t, "GetEntries by anonymous showing hidden entries", items, err, public, older)
+	}
+}
+
+func testListEntries(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	date := func(value string) *time.Time {
+		d, err := time.Parse("2006/1/2", value)
+		if err != nil {
+			t.Fatalf("invalid date %q: %v", value, err)
+		}
+		return &d
+	}
+
+	// Entries without a date are listed by the time they were created,
+	// and are left out when a date range is given.
+	undated := f.Manager.NewEntry()
+	undated.SetTitle("Undated draft")
+	undated.SetText("Not dated yet")
+	undated.SetAuthor(f.Authors[0])
+	undated.SetTags([]string{"news"})
+	undated.SetStatus(blog.StatusDraft)
+	if err := f.Manager.AddEntry(undated, f.Session); err != nil {
+		t.Fatalf("AddEntry() of an undated draft failed: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		options blog.ListOptions
+		want    []blog.Entry
+	}{
+		{"all", blog.ListOptions{}, []blog.Entry{s.epsilon, s.delta, undated, s.gamma, s.beta, s.alpha}},
+		{"tag", blog.ListOptions{Tag: "News"}, []blog.Entry{s.delta, undated, s.beta, s.alpha}},
+		{"author", blog.ListOptions{Author: f.Authors[1].Uuid()}, []blog.Entry{s.delta, s.beta}},
+		{"other author", blog.ListOptions{Author: f.Authors[0].Uuid()}, []blog.Entry{s.epsilon, undated, s.gamma, s.alpha}},
+		{"tag and author", blog.ListOptions{Tag: "news", Author: f.Authors[0].Uuid()}, []blog.Entry{undated, s.alpha}},
+		{"tag of several words", blog.ListOptions{Tag: "Big News"}, []blog.Entry{s.gamma}},
+		{"before", blog.ListOptions{Before: date("2050/1/1")}, []blog.Entry{s.gamma, s.beta, s.alpha}},
+		{"after", blog.ListOptions{After: date("2002/6/1")}, []blog.Entry{s.epsilon, s.delta, s.gamma}},
+		{"between", blog.ListOptions{After: date("2001/6/1"), Before: date("2100/6/1")}, []blog.Entry{s.delta, s.gamma, s.beta}},
+		{"no match", blog.ListOptions{Tag: "missing"}, nil},
+	}
+
+	for _, c := range cases {
+		for _, limit := range []int{0, 1, 2, 3} {
+			options := c.options
+			options.Limit = limit
+			items := listAll(t, f, c.name, options)
+			expect(t, fmt.Sprintf("ListEntries(%s, limit %d)", c.name, limit), items, nil, c.want...)
+		}
+	}
+
+	if _, _, err := f.Manager.ListEntriesContext(showHidden, blog.ListOptions{Cursor: "%%%"}, f.Session); err == nil {
+		t.Errorf("ListEntries() with an invalid cursor should fail")
+	}
+	items, _, err := f.Manager.ListEntriesContext(showHidden, blog.ListOptions{}, f.OtherSite)
+	expect(t, "ListEntries(other site)", items, err)
+}
+
+// listAll reads every page of ListEntries, checking that no page is larger
+// than the limit.
+func listAll(t *testing.T, f *Fixture, name string, options blog.ListOptions) []blog.Entry {
+	t.Helper()
+
+	var items []blog.Entry
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("ListEntries(%s) returned too many pages", name)
+		}
+		page, next, err := f.Manager.ListEntriesContext(showHidden, options, f.Session)
+		if err != nil {
+			t.Fatalf("ListEntries(%s) failed: %v", name, err)
+		}
+		if options.Limit > 0 && len(page) > options.Limit {
+			t.Fatalf("ListEntries(%s) returned %d entries, limit is %d", name, len(page), options.Limit)
+		}
+		items = append(items, page...)
+		if next == "" {
+			break
+		}
+		options.Cursor = next
+	}
+
+	return items
+}
+
+func testSearch(t *testing.T, f *Fixture) {
+	s := seed(t, f)
+
+	text := func(e blog.Entry, value string) {
+		t.Helper()
+		e.SetText(value)
+		if err := f.Manager.UpdateEntry(e, f.Session); err != nil {
+			t.Fatalf("UpdateEntry() failed: %v", err)
+		}
+	}
+	tomatoes := add(t, f, "Growing tomatoes", "2004/1/1", f.Authors[0])
+	text(tomatoes, "Water tomatoes daily. Tomato plants need full sun and warm nights.")
+	notes := add(t, f, "Weekly notes", "2005/1/1", f.Authors[1])
+	text(notes, "Notes about growing roses, and a few tomatoes.")
+
+	chinese := add(t, f, "學習中文", "2006/1/1", f.Authors[0])
+	chinese.SetLanguage("zh-TW")
+	text(chinese, "我喜歡學習中文，也喜歡看書。")
+	if e, err := f.Manager.GetEntry(chinese.Uuid(), f.Session); err != nil || e.Language() != "zh-TW" {
+		t.Fatalf("UpdateEntry() did not save the language: %v", err)
+	}
+
+	search := func(query string) []blog.Entry {
+		t.Helper()
+		items, err := f.Manager.SearchEntriesContext(showHidden, query, f.Session)
+		if err != nil {
+			t.Fatalf("SearchEntries(%q) failed: %v", query, err)
+		}
+		return items
+	}
+	cases := []struct {
+		query string
+		want  []blog.Entry
+	}{
+		{"tomatoes", []blog.Entry{tomatoes, notes}},
+		{"grow", []blog.Entry{tomatoes, notes}},
+		{"Tomato", []blog.Entry{tomatoes, notes}},
+		{"tomatoes roses", []blog.Entry{notes}},
+		{"tomatoes AND roses", []blog.Entry{notes}},
+		{`"full sun"`, []blog.Entry{tomatoes}},
+		{`"sun full"`, nil},
+		{`"warm nights" daily`, []blog.Entry{tomatoes}},
+		{"tomat*", []blog.Entry{tomatoes, notes}},
+		{"ros*", []blog.Entry{notes}},
+		{"roses OR gamma", []blog.Entry{s.gamma, notes}},
+		{"roses | missing", []blog.Entry{notes}},
+		{"the", nil},
+		{"中文", []blog.Entry{chinese}},
+		{"學習中文", []blog.Entry{chinese}},
+		{"喜歡看書", []blog.Entry{chinese}},
+		{"中文書", nil},
+		{"學習*", []blog.Entry{chinese}},
+	}
+	for _, c := range cases {
+		expect(t, fmt.Sprintf("SearchEntries(%q)", c.query), search(c.query), nil, c.want...)
+	}
+
+	var hits []blog.Entry
+	options := blog.SearchOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("Search() returned too many pages")
+		}
+		results, err := f.Manager.SearchContext(showHidden, "post", options, f.Session)
+		if err != nil {
+			t.Fatalf("Search() failed: %v", err)
+		}
+		if results.Total != 5 || len(results.Hits) > 2 {
+			t.Fatalf("Search() returned %d hits of %d, want at most 2 of 5", len(results.Hits), results.Total)
+		}
+		for _, h := range results.Hits {
+			hits = append(hits, h.Entry)
+		}
+		if results.Next == "" {
+			break
+		}
+		options.Cursor = results.Next
+	}
+	expect(t, "Search(post) pages", hits, nil, s.epsilon, s.delta, s.gamma, s.beta, s.alpha)
+
+	results, err := f.Manager.Search("sun", blog.SearchOptions{}, f.Session)
+	if err != nil || len(results.Hits) != 1 {
+		t.Fatalf("Search(sun) returned %v: %v", results, err)
+	}
+	if h := results.Hits[0]; h.Score <= 0 || !strings.Contains(string(h.Snippet), "full <mark>sun</mark> and") {
+		t.Errorf("Search(sun) returned score %v and snippet %q", h.Score, h.Snippet)
+	}
+	if _, err := f.Manager.Search("post", blog.SearchOptions{Cursor: "%%%"}, f.Session); !errors.Is(err, blog.ErrInvalidCursor) {
+		t.Errorf("Search() with an invalid cursor returned %v, want ErrInvalidCursor", err)
+	}
+
+	items, err := f.Manager.SearchEntries("post", f.Session)
+	expect(t, "SearchEntries without showing hidden entries", items, err, s.gamma, s.beta, s.alpha)
+	items, err = f.Manager.SearchEntriesContext(showHidden, "tomatoes", f.OtherSite)
+	expect(t, "SearchEntries(other site)", items, err)
+
+	text(tomatoes, "Water daily.")
+	expect(t, "SearchEntries after UpdateEntry", search(`"full sun"`), nil)
+	expect(t, "SearchEntries after UpdateEntry", search("tomatoes"), nil, tomatoes, notes)
+
+	if err := f.Manager.DeleteEntry(notes.Uuid(), f.Session); err != nil {
+		t.Fatalf("DeleteEntry() failed: %v", err)
+	}
+	items, err = f.Manager.SearchEntries("roses", f.Session)
+	expect(t, "SearchEntries of a deleted entry", items, err)
+	if err := f.Manager.PurgeEntry(notes.Uuid(), f.Session); err != nil {
+		t.Fatalf("PurgeEntry() failed: %v", err)
+	}
+	expect(t, "SearchEntries of a purged entry", search("roses"), nil)
+}
+
+func testSlugs(t *testing.T, f *Fixture) {
+	first := add(t, f, "Same title", "2001/1/1", f.Authors[0])
+	second := add(t, f, "Same title", "2001/1/2", f.Authors[0])
+	third := add(t, f, "Same title", "2001/1/3", f.Authors[0])
+	if first.Slug() != "same-title" || second.Slug() != "same-title-2" || third.Slug() != "same-title-3" {
+		t.Fatalf("AddEntry() gave slugs %q, %q, %q, expected same-title, same-title-2, same-title-3",
+			first.Slug(), second.Slug(), third.Slug())
+	}
+	e, err := f.Manager.GetEntryBySlugContext(showHidden, "same-title-2", f.Session)
+	if err != nil || e.Uuid() != second.Uuid() {
+		t.Fatalf("GetEntryBySlug(same-title-2) did not find the second entry: %v", err)
+	}
+
+	other := add(t, f, "Same title", "2001/1/1", f.Authors[0])
+	if other.Slug() != "same-title-4" {
+		t.Errorf("AddEntry() gave slug %q, expected same-title-4", other.Slug())
+	}
+	if err := f.Manager.DeleteEntry(other.Uuid(), f.Session); err != nil {
+		t.Fatalf("DeleteEntry() failed: %v", err)
+	}
+
+	explicit := f.Manager.NewEntry()
+	explicit.SetTitle("Explicit")
+	explicit.SetText("Text")
+	explicit.SetSlug("same-title")
+	var conflict *blog.ErrSlugConflict
+	if err := f.Manager.AddEntry(explicit, f.Session); !errors.As(err, &conflict) {
+		t.Fatalf("AddEntry() with a taken slug returned %v, expected ErrSlugConflict", err)
+	}
+	if _, err := f.Manager.GetEntryBySlugContext(showHidden, "explicit", f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("AddEntry() saved an entry with a conflicting slug")
+	}
+
+	e, err = f.Manager.GetEntryContext(showHidden, third.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	e.SetSlug("same-title")
+	if err := f.Manager.UpdateEntry(e, f.Session); !errors.As(err, &conflict) {
+		t.Fatalf("UpdateEntry() to a taken slug returned %v, expected ErrSlugConflict", err)
+	}
+
+	e, err = f.Manager.GetEntryContext(showHidden, first.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	e.SetSlug("renamed")
+	if err := f.Manager.UpdateEntry(e, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() to a free slug failed: %v", err)
+	}
+	if e, err := f.Manager.GetEntryBySlugContext(showHidden, "renamed", f.Session); err != nil || e.Uuid() != first.Uuid() {
+		t.Errorf("GetEntryBySlug(renamed) did not find the renamed entry: %v", err)
+	}
+
+	e, err = f.Manager.GetEntryContext(showHidden, third.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	e.SetSlug("same-title")
+	if err := f.Manager.UpdateEntry(e, f.Session); err != nil {
+		t.Errorf("UpdateEntry() could not take a slug given up by another entry: %v", err)
+	}
+
+	on := f.Manager.NewEntry()
+	on.SetTitle("Same title")
+	on.SetText("Text")
+	if err := f.Manager.AddEntry(on, f.OtherSite); err != nil {
+		t.Fatalf("AddEntry() on another site failed: %v", err)
+	}
+	if on.Slug() != "same-title" {
+		t.Errorf("AddEntry() on another site gave slug %q, expected same-title", on.Slug())
+	}
+}
+
+func testResolveSlug(t *testing.T, f *Fixture) {
+	a := add(t, f, "First name", "2001/1/1", f.Authors[0])
+
+	e, moved, err := f.Manager.ResolveSlugContext(showHidden, "first-name", f.Session)
+	if err != nil || e.Uuid() != a.Uuid() || moved != "" {
+		t.Fatalf("ResolveSlug(first-name) returned %v, %q, %v, expected the entry and no new slug", e, moved, err)
+	}
+
+	for _, slug := range []string{"second-name", "third-name"} {
+		e, err := f.Manager.GetEntryContext(showHidden, a.Uuid(), f.Session)
+		if err != nil {
+			t.Fatalf("GetEntry() failed: %v", err)
+		}
+		e.SetSlug(slug)
+		if err := f.Manager.UpdateEntry(e, f.Session); err != nil {
+			t.Fatalf("UpdateEntry() failed: %v", err)
+		}
+	}
+
+	for _, slug := range []string{"first-name", "second-name"} {
+		e, moved, err := f.Manager.ResolveSlugContext(showHidden, slug, f.Session)
+		if err != nil || e.Uuid() != a.Uuid() || moved != "third-name" {
+			t.Errorf("ResolveSlug(%s) returned %v, %q, %v, expected the entry and third-name", slug, e, moved, err)
+		}
+	}
+	if _, moved, err := f.Manager.ResolveSlugContext(showHidden, "third-name", f.Session); err != nil || moved != "" {
+		t.Errorf("ResolveSlug(third-name) returned %q, %v, expected no new slug", moved, err)
+	}
+	if _, _, err := f.Manager.ResolveSlugContext(showHidden, "missing", f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("ResolveSlug(missing) returned %v, expected ErrNotFound", err)
+	}
+	if _, _, err := f.Manager.ResolveSlugContext(showHidden, "first-name", f.OtherSite); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("ResolveSlug(first-name) on another site returned %v, expected ErrNotFound", err)
+	}
+
+	// A slug given up by one entry and claimed by another belongs to the
+	// entry that has it now.
+	b := add(t, f, "First name", "2001/1/2", f.Authors[0])
+	e, moved, err = f.Manager.ResolveSlugContext(showHidden, "first-name", f.Session)
+	if err != nil || e.Uuid() != b.Uuid() || moved != "" {
+		t.Errorf("ResolveSlug(first-name) did not return the entry that now has the slug: %v", err)
+	}
+}
+
+func testSetSlug(t *testing.T, f *Fixture) {
+	cases := []struct {
+		slug  string
+		valid bool
+	}{
+		{"seo-friendly-2020", true},
+		{"部落格-文章", true},
+		{"Upper", false},
+		{"with space", false},
+		{"with/slash", false},
+		{"-leading", false},
+		{"trailing-", false},
+		{"double--dash", false},
+		{"tag", false},
+		{"manage", false},
+		{strings.Repeat("a", 100), true},
+		{strings.Repeat("a", 101), false},
+	}
+	for _, c := range cases {
+		e := f.Manager.NewEntry()
+		e.SetTitle("Chosen slug")
+		e.SetText("Text")
+		e.SetSlug(c.slug)
+		err := f.Manager.AddEntry(e, f.Session)
+		if c.valid {
+			if err != nil || e.Slug() != c.slug {
+				t.Errorf("AddEntry() with slug %q gave %q, %v", c.slug, e.Slug(), err)
+			}
+			continue
+		}
+		var v *blog.ErrValidation
+		if !errors.As(err, &v) || v.Fields["Slug"] == "" {
+			t.Errorf("AddEntry() with slug %q returned %v, expected a Slug validation error", c.slug, err)
+		}
+	}
+
+	// Slugs derived from a title avoid reserved words rather than failing.
+	tag := add(t, f, "Tag", "2001/1/1", f.Authors[0])
+	if tag.Slug() != "tag-2" {
+		t.Errorf("AddEntry() derived slug %q from title Tag, expected tag-2", tag.Slug())
+	}
+
+	e, err := f.Manager.GetEntryContext(showHidden, tag.Uuid(), f.Session)
+	if err != nil {
+		t.Fatalf("GetEntry() failed: %v", err)
+	}
+	e.SetSlug("Invalid slug")
+	var v *blog.ErrValidation
+	if err := f.Manager.UpdateEntry(e, f.Session); !errors.As(err, &v) || v.Fields["Slug"] == "" {
+		t.Errorf("UpdateEntry() with an invalid slug returned %v, expected a Slug validation error", err)
+	}
+	e.SetSlug("topic")
+	if err := f.Manager.UpdateEntry(e, f.Session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+	if _, err := f.Manager.GetEntryBySlugCachedContext(showHidden, "tag-2", f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("GetEntryBySlugCached() found the entry by its old slug: %v", err)
+	}
+	if e, err := f.Manager.GetEntryBySlugCachedContext(showHidden, "topic", f.Session); err != nil || e.Uuid() != tag.Uuid() {
+		t.Errorf("GetEntryBySlugCached() did not find the entry by its new slug: %v", err)
+	}
+}
+
+func testContext(t *testing.T, f *Fixture) {
+	ctx, cancel := context.WithTimeout(blog.ShowHidden(context.Background()), time.Minute)
+	defer cancel()
+
+	e := f.Manager.NewEntry()
+	e.SetTitle("Context entry")
+	e.SetText("Text")
+	if err := f.Manager.AddEntryContext(ctx, e, f.Session); err != nil {
+		t.Fatalf("AddEntryContext() failed: %v", err)
+	}
+	if found, err := f.Manager.GetEntryContext(ctx, e.Uuid(), f.Session); err != nil || found.Title() != "Context entry" {
+		t.Fatalf("GetEntryContext() failed: %v", err)
+	}
+	if found, _, err := f.Manager.ResolveSlugContext(ctx, "context-entry", f.Session); err != nil || found.Uuid() != e.Uuid() {
+		t.Fatalf("ResolveSlugContext() failed: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := f.Manager.GetEntryContext(cancelled, e.Uuid(), f.Session); err == nil {
+		t.Errorf("GetEntryContext() with a cancelled context should fail")
+	}
+	if _, _, err := f.Manager.ListEntriesContext(cancelled, blog.ListOptions{}, f.Session); err == nil {
+		t.Errorf("ListEntriesContext() with a cancelled context should fail")
+	}
+
+	other := f.Manager.NewEntry()
+	other.SetTitle("Cancelled entry")
+	other.SetText("Text")
+	if err := f.Manager.AddEntryContext(cancelled, other, f.Session); err == nil {
+		t.Errorf("AddEntryContext() with a cancelled context should fail")
+	}
+	if _, err := f.Manager.GetEntryContext(showHidden, other.Uuid(), f.Session); !errors.Is(err, blog.ErrNotFound) {
+		t.Errorf("AddEntryContext() with a cancelled context saved the entry: %v", err)
+	}
+	if e, err := f.Manager.GetEntryContext(showHidden, e.Uuid(), f.Session); err != nil {
+		t.Errorf("GetEntry() failed after a cancelled request: %v", err)
+	} else {
+		e.SetTitle("Changed")
+		if err := f.Manager.UpdateEntryContext(cancelled, e, f.Session); err == nil {
+			t.Errorf("UpdateEntryContext() with a cancelled context should fail")
+		}
+	}
+}
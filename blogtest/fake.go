@@ -0,0 +1,138 @@
+package blogtest
+
+import (
+	"fmt"
+	"sync"
+
+	"gitlab.com/montebo/security"
+)
+
+// AccessManager implements the parts of security.AccessManager used by the
+// blog package, so that a BlogManager can be tested without a database. Any
+// other AccessManager method panics.
+type AccessManager struct {
+	security.AccessManager
+
+	lock    sync.Mutex
+	people  map[string]security.Person
+	changes []*security.GaeEntityAuditLogCollection
+}
+
+func NewAccessManager() *AccessManager {
+	return &AccessManager{people: make(map[string]security.Person)}
+}
+
+// NewPerson registers a person that GetPersonCached can return.
+func (am *AccessManager) NewPerson(firstName, lastName string) security.Person {
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	p := &Person{
+		uuid:      fmt.Sprintf("person-%d", len(am.people)+1),
+		firstName: firstName,
+		lastName:  lastName,
+	}
+	am.people[p.uuid] = p
+	return p
+}
+
+func (am *AccessManager) GetPersonCached(uuid string, session security.Session) (security.Person, error) {
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	return am.people[uuid], nil
+}
+
+func (am *AccessManager) AddEntityChangeLog(ec *security.GaeEntityAuditLogCollection, session security.Session) error {
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	am.changes = append(am.changes, ec)
+	return nil
+}
+
+// ChangeLogs returns every change log written through AddEntityChangeLog.
+func (am *AccessManager) ChangeLogs() []*security.GaeEntityAuditLogCollection {
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	return append([]*security.GaeEntityAuditLogCollection{}, am.changes...)
+}
+
+// Person is a minimal security.Person.
+type Person struct {
+	security.Person
+
+	uuid      string
+	firstName string
+	lastName  string
+}
+
+func (p *Person) Uuid() string {
+	return p.uuid
+}
+
+func (p *Person) FirstName() string {
+	return p.firstName
+}
+
+func (p *Person) LastName() string {
+	return p.lastName
+}
+
+func (p *Person) DisplayName() string {
+	return p.firstName + " " + p.lastName
+}
+
+// Session is a minimal security.Session. A session with an empty person
+// uuid is not authenticated.
+type Session struct {
+	security.Session
+
+	site       string
+	personUuid string
+	roles      []string
+	locale     string
+}
+
+func NewSession(site, personUuid string, roles ...string) *Session {
+	return &Session{site: site, personUuid: personUuid, roles: roles}
+}
+
+func (s *Session) Site() string {
+	return s.site
+}
+
+func (s *Session) PersonUuid() string {
+	return s.personUuid
+}
+
+func (s *Session) DisplayName() string {
+	return s.personUuid
+}
+
+// Locale returns the language set with SetLocale.
+func (s *Session) Locale() string {
+	return s.locale
+}
+
+// SetLocale sets the language of the session, such as "zh-TW".
+func (s *Session) SetLocale(locale string) {
+	s.locale = locale
+}
+
+func (s *Session) IsAuthenticated() bool {
+	return s.personUuid != ""
+}
+
+// HasRole reports whether the session has any of the roles.
+func (s *Session) HasRole(uid ...string) bool {
+	for _, r := range uid {
+		for _, role := range s.roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package blogtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zaddok/blog"
+	"gitlab.com/montebo/security"
+)
+
+func TestMemoryBlogManager(t *testing.T) {
+	sites := 0
+
+	RunConformance(t, func(t *testing.T) *Fixture {
+		sites++
+		site := fmt.Sprintf("site%d.com", sites)
+
+		am := NewAccessManager()
+		writer := am.NewPerson("Wendy", "Writer")
+		return &Fixture{
+			Manager:   blog.NewMemoryBlogManager(am),
+			Session:   NewSession(site, "manager", blog.RoleEditor),
+			Author:    NewSession(site, writer.Uuid(), blog.RoleAuthor),
+			Reader:    NewSession(site, "reader"),
+			OtherSite: NewSession("other."+site, "manager", blog.RoleEditor),
+			Anonymous: NewSession(site, ""),
+			Authors: []security.Person{
+				am.NewPerson("Jane", "Li"),
+				am.NewPerson("William", "Wang"),
+			},
+		}
+	})
+}
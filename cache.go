@@ -0,0 +1,123 @@
+package blog
+
+import (
+	"context"
+	"time"
+
+	"github.com/bluele/gcache"
+	"gitlab.com/montebo/security"
+)
+
+// A Cache holds recently read entries for GetEntryCached and
+// GetEntryBySlugCached. Keys are scoped to a site by the blog managers, so
+// one Cache may be shared by managers serving many sites. A Cache must be
+// safe for concurrent use. Failures are treated as a cache miss, so a Cache
+// does not return errors.
+type Cache interface {
+	Get(ctx context.Context, key string) (Entry, bool)
+	Set(ctx context.Context, key string, entry Entry)
+	Remove(ctx context.Context, key string)
+}
+
+// CacheOptions configure a Cache. Zero values select the defaults.
+type CacheOptions struct {
+	// Size is the most entries held in process memory, 200 by default.
+	Size int
+
+	// TTL is how long an entry is cached, one hour by default.
+	TTL time.Duration
+}
+
+func (o CacheOptions) size() int {
+	if o.Size <= 0 {
+		return 200
+	}
+	return o.Size
+}
+
+func (o CacheOptions) ttl() time.Duration {
+	if o.TTL <= 0 {
+		return time.Hour
+	}
+	return o.TTL
+}
+
+// NewMemoryCache returns a Cache that holds the least recently used entries
+// in process memory. Entries removed by other processes are not noticed
+// until they expire.
+func NewMemoryCache(options CacheOptions) Cache {
+	return &memoryCache{
+		cache: gcache.New(options.size()).LRU().Expiration(options.ttl()).Build(),
+	}
+}
+
+// memoryCache holds copies of entries, and returns a new copy from every
+// Get, so that changes made to an entry by one reader are not seen by
+// others until it is saved.
+type memoryCache struct {
+	cache gcache.Cache
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (Entry, bool) {
+	v, err := c.cache.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	return cloneEntry(v.(Entry)), true
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, entry Entry) {
+	c.cache.Set(key, cloneEntry(entry))
+}
+
+func (c *memoryCache) Remove(ctx context.Context, key string) {
+	c.cache.Remove(key)
+}
+
+func entryCacheKey(site, uuid string) string {
+	return site + "/entry/" + uuid
+}
+
+func slugCacheKey(site, slug string) string {
+	return site + "/slug/" + slug
+}
+
+// cacheEntry adds an entry to a cache under both its uuid and its slug.
+func cacheEntry(ctx context.Context, cache Cache, site string, entry Entry) {
+	cache.Set(ctx, entryCacheKey(site, entry.Uuid()), entry)
+	if entry.Slug() != "" {
+		cache.Set(ctx, slugCacheKey(site, entry.Slug()), entry)
+	}
+}
+
+// uncacheEntry removes an entry from a cache. Every slug the entry has been
+// cached under must be given.
+func uncacheEntry(ctx context.Context, cache Cache, site, uuid string, slugs ...string) {
+	cache.Remove(ctx, entryCacheKey(site, uuid))
+	for _, slug := range slugs {
+		if slug != "" {
+			cache.Remove(ctx, slugCacheKey(site, slug))
+		}
+	}
+}
+
+// cachedEntry looks up an entry in a cache. Caches shared between processes
+// do not store the author, so it is loaded again into a copy of the entry.
+func cachedEntry(ctx context.Context, cache Cache, key string, am security.AccessManager, session security.Session) (Entry, bool, error) {
+	entry, ok := cache.Get(ctx, key)
+	if !ok {
+		return nil, false, nil
+	}
+	e, isGae := entry.(*GaeEntry)
+	if !isGae || e.author != nil || e.authorUuid == "" {
+		return entry, true, nil
+	}
+
+	author, err := am.GetPersonCached(e.authorUuid, session)
+	if err != nil {
+		return nil, false, err
+	}
+	copy := *e
+	copy.author = author
+	return &copy, true, nil
+}
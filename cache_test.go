@@ -0,0 +1,69 @@
+package blog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(CacheOptions{Size: 2})
+
+	one := &GaeEntry{uuid: "u1", title: "One", slug: "same"}
+	two := &GaeEntry{uuid: "u2", title: "Two", slug: "same"}
+	cacheEntry(ctx, c, "one.com", one)
+	if e, ok := c.Get(ctx, slugCacheKey("one.com", "same")); !ok || e.Uuid() != "u1" {
+		t.Fatalf("Get() did not return the cached entry")
+	}
+
+	// The same slug on another site must not replace the first entry.
+	cacheEntry(ctx, c, "two.com", two)
+	if e, ok := c.Get(ctx, slugCacheKey("two.com", "same")); !ok || e.Uuid() != "u2" {
+		t.Errorf("Get() did not return the entry of the second site")
+	}
+	if _, ok := c.Get(ctx, slugCacheKey("one.com", "same")); ok {
+		t.Errorf("Get() should have evicted the least recently used entry")
+	}
+
+	uncacheEntry(ctx, c, "two.com", "u2", "same")
+	if _, ok := c.Get(ctx, entryCacheKey("two.com", "u2")); ok {
+		t.Errorf("Get() returned a removed entry")
+	}
+	if _, ok := c.Get(ctx, slugCacheKey("two.com", "same")); ok {
+		t.Errorf("Get() returned an entry by a removed slug")
+	}
+
+	c = NewMemoryCache(CacheOptions{TTL: time.Millisecond})
+	cacheEntry(ctx, c, "one.com", one)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get(ctx, entryCacheKey("one.com", "u1")); ok {
+		t.Errorf("Get() returned an expired entry")
+	}
+}
+
+func TestCachedEntry(t *testing.T) {
+	ctx := context.Background()
+	am := newTestAccessManager()
+	am.addPerson("p1", "Jane", "Li")
+	session := &testSession{site: "cache.com"}
+	c := NewMemoryCache(CacheOptions{})
+
+	// Entries read from a shared cache have no author.
+	shared := &GaeEntry{uuid: "u1", title: "Shared", authorUuid: "p1"}
+	c.Set(ctx, "key", shared)
+	e, ok, err := cachedEntry(ctx, c, "key", am, session)
+	if err != nil || !ok {
+		t.Fatalf("cachedEntry() failed: %v", err)
+	}
+	if e.Author() == nil || e.Author().FirstName() != "Jane" {
+		t.Errorf("cachedEntry() did not load the author")
+	}
+	if shared.author != nil {
+		t.Errorf("cachedEntry() modified the cached entry")
+	}
+
+	if _, ok, err := cachedEntry(ctx, c, "missing", am, session); ok || err != nil {
+		t.Errorf("cachedEntry() found a missing key: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package blog_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zaddok/blog"
+	"github.com/zaddok/blog/blogtest"
+	"github.com/zaddok/log"
+	"gitlab.com/montebo/security"
+)
+
+// TestConformance runs the blogtest conformance suite against the datastore
+// and cassandra blog managers.
+func TestConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("requires the datastore emulator and cassandra")
+	}
+
+	l := log.NewStdoutLogDebug()
+	defer l.Close()
+
+	t.Run("Gae", func(t *testing.T) {
+		am, err, client, context := security.NewGaeAccessManager(blog.EmulatorProjectId(), "australia-southeast1", time.Now().Location(), l)
+		if err != nil {
+			t.Fatalf("NewGaeAccessManager() failed: %v", err)
+		}
+		bm := blog.NewGaeBlogManager(client, context, am)
+		blogtest.RunConformance(t, conformanceFactory(am, bm))
+	})
+
+	t.Run("Cql", func(t *testing.T) {
+		am, cql, err := security.NewCqlAccessManager(blog.TestCqlKeyspace, blog.CassandraHostname(), "", time.Now().Location(), l)
+		if err != nil {
+			t.Fatalf("NewCqlAccessManager() failed: %v", err)
+		}
+		bm, err := blog.NewCqlBlogManager(cql, am, l)
+		if err != nil {
+			t.Fatalf("NewCqlBlogManager() failed: %v", err)
+		}
+		blogtest.RunConformance(t, conformanceFactory(am, bm))
+	})
+}
+
+// conformanceFactory returns fixtures that use a pair of new randomly named
+// sites, so that test cases do not see each other's entries.
+func conformanceFactory(am security.AccessManager, bm blog.BlogManager) blogtest.Factory {
+	return func(t *testing.T) *blogtest.Fixture {
+		site := security.RandomString(10) + ".com"
+		other := security.RandomString(10) + ".com"
+
+		return &blogtest.Fixture{
+			Manager:   bm,
+			Session:   conformanceSession(t, am, site, "manager@example.com", blog.RoleEditor),
+			Author:    conformanceSession(t, am, site, "writer@example.com", blog.RoleAuthor),
+			Reader:    conformanceSession(t, am, site, "reader@example.com", ""),
+			OtherSite: conformanceSession(t, am, other, "manager@example.com", blog.RoleEditor),
+			Anonymous: blogtest.NewSession(site, ""),
+			Authors: []security.Person{
+				conformancePerson(t, am, site, "Jane", "Li", "jane.li@example.com", ""),
+				conformancePerson(t, am, site, "William", "Wang", "william.wang@example.com", ""),
+			},
+		}
+	}
+}
+
+func conformancePerson(t *testing.T, am security.AccessManager, site, firstName, lastName, email, role string) security.Person {
+	roles := "s1:s2:s3:s4:c1:c2:c3:c4:c5:c6"
+	if role != "" {
+		roles += ":" + role
+	}
+	_, err := am.AddPerson(site, firstName, lastName, email, roles, security.HashPassword("tmp1!aAfo"), "127.0.0.1", nil)
+	if err != nil {
+		t.Fatalf("AddPerson() failed: %v", err)
+	}
+	session, err := am.GetSystemSession(site, "Test", "Test")
+	if err != nil {
+		t.Fatalf("GetSystemSession() failed: %v", err)
+	}
+	p, err := am.GetPersonByEmail(site, email, session)
+	if err != nil {
+		t.Fatalf("GetPersonByEmail() failed: %v", err)
+	}
+	return p
+}
+
+func conformanceSession(t *testing.T, am security.AccessManager, site, email, role string) security.Session {
+	conformancePerson(t, am, site, "Blog", "Manager", email, role)
+	session, _, err := am.Authenticate(site, email, "tmp1!aAfo", "127.0.0.1", "", "en-AU", "", "Australia/Melbourne")
+	if err != nil {
+		t.Fatalf("Authenticate() failed: %v", err)
+	}
+	if !session.IsAuthenticated() {
+		t.Fatalf("Authenticate() authentication for %s failed.", email)
+	}
+	return session
+}
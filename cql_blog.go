@@ -1,64 +1,26 @@
 package blog
 
 import (
-	"errors"
-	"fmt"
-	"sort"
+	"context"
 	"strings"
 	"time"
 
-	"github.com/bluele/gcache"
 	"github.com/gocql/gocql"
-	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/zaddok/log"
 	"gitlab.com/montebo/security"
-	"golang.org/x/text/language"
 )
 
 func NewCqlBlogManager(cql *gocql.Session, am security.AccessManager, log log.Log) (*CqlBlogManager, error) {
 	s := &CqlBlogManager{
-		cql:        cql,
-		am:         am,
-		log:        log,
-		entryCache: gcache.New(200).LRU().Expiration(time.Second * 3600).Build(),
-		slugCache:  gcache.New(200).LRU().Expiration(time.Second * 3600).Build(),
-	}
-	am.AddCustomRoleType("User", "bk1", "Manage Blog Entries", "Create and update blog entries")
-
-	rows := cql.Query(`
-create table if not exists blog_entry (
-	site text,
-	uuid text,
-	slug text,
-	title text,
-	description text,
-	thumbnail text,
-	cover text,
-	tags set<text>,
-	search_tags set<text>,
-	"date" timestamp,
-	created timestamp,
-	updated timestamp,
-	author text,
-	text text,
-	html text,
-	deleted boolean,
-	primary key ((site), uuid))
-`).Iter()
-	err := rows.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	rows = cql.Query(`create index if not exists blog_slug on blog_entry (slug)`).Iter()
-	err = rows.Close()
-	if err != nil {
-		return nil, errors.New("blog_slug creation failed. " + err.Error())
+		cql:   cql,
+		am:    am,
+		log:   log,
+		cache: NewMemoryCache(CacheOptions{}),
 	}
+	am.AddCustomRoleType("User", RoleEditor, "Edit Blog Entries", "Create, review and publish any blog entry")
+	am.AddCustomRoleType("User", RoleAuthor, "Write Blog Entries", "Write their own blog entries and submit them for review")
 
-	rows = cql.Query(`create index if not exists blog_entry_search on blog_entry (search_tags)`).Iter()
-	err = rows.Close()
-	if err != nil {
+	if _, err := s.Migrate(false); err != nil {
 		return nil, err
 	}
 
@@ -71,33 +33,47 @@ func activateBlogPlugin(am security.AccessManager) {
 	security.RegisterSecondaryMenuItem(security.ActionButton{
 		Title:     "manage-blog",
 		Link:      "/blog/manage",
-		Roles:     []string{"bk1"},
+		Roles:     []string{RoleEditor, RoleAuthor},
 		SortOrder: 200,
 	})
 
-	security.RegisterTranslations(language.English,
-		&i18n.Message{ID: "blog", Other: "Blog"},
-		&i18n.Message{ID: "manage-blog", Other: "Manage Blog"},
-	)
-
-	security.RegisterTranslations(language.TraditionalChinese,
-		&i18n.Message{ID: "blog", Other: "部落格"},
-		&i18n.Message{ID: "manage-blog", Other: "Manage 部落格"},
-	)
+	registerBlogTranslations()
+}
 
-	security.RegisterTranslations(language.SimplifiedChinese,
-		&i18n.Message{ID: "blog", Other: "博客"},
-		&i18n.Message{ID: "manage-blog", Other: "Manage 博客"},
-	)
+// cqlEntryColumns are the blog_entry columns read by scanCqlEntry.
+const cqlEntryColumns = "uuid, title, slug, description, tags, date, created, updated, author, text, html, thumbnail, cover, deleted, deleted_at, format, language, status"
 
+// scanCqlEntry reads the next row selected with cqlEntryColumns, followed by
+// any extra columns.
+func scanCqlEntry(rows *gocql.Iter, entry *GaeEntry, extra ...interface{}) bool {
+	dest := []interface{}{&entry.uuid, &entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.html, &entry.thumbnail, &entry.cover, &entry.deleted, &entry.deletedAt, &entry.format, &entry.language, &entry.status}
+	if !rows.Scan(append(dest, extra...)...) {
+		return false
+	}
+	if entry.status == "" {
+		// Entries saved before statuses were introduced were public
+		entry.status = StatusPublished
+	}
+	return true
 }
 
 type CqlBlogManager struct {
-	cql        *gocql.Session
-	log        log.Log
-	am         security.AccessManager
-	entryCache gcache.Cache
-	slugCache  gcache.Cache
+	cql   *gocql.Session
+	log   log.Log
+	am    security.AccessManager
+	cache Cache
+}
+
+// query returns a query that is cancelled along with ctx.
+func (bm *CqlBlogManager) query(ctx context.Context, stmt string, values ...interface{}) *gocql.Query {
+	return bm.cql.Query(stmt, values...).WithContext(ctx)
+}
+
+// SetCache replaces the cache used by GetEntryCached and
+// GetEntryBySlugCached, which holds 200 entries in process memory for an
+// hour by default. It must be called before the manager is used.
+func (bm *CqlBlogManager) SetCache(cache Cache) {
+	bm.cache = cache
 }
 
 func (bm *CqlBlogManager) NewEntry() Entry {
@@ -108,13 +84,36 @@ func (bm *CqlBlogManager) AccessManager() security.AccessManager {
 	return bm.am
 }
 
-func (bm *CqlBlogManager) GetEntry(uuid string, session security.Session) (Entry, error) {
+func (bm *CqlBlogManager) GetEntryContext(ctx context.Context, uuid string, session security.Session) (Entry, error) {
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	entry, err := bm.storedEntry(ctx, uuid, session)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVisible(ctx, entry, session); err != nil {
+		return nil, err
+	}
+
+	cacheEntry(ctx, bm.cache, session.Site(), entry)
+
+	return entry, nil
+}
+
+// storedEntry reads an entry whether or not the session may see it.
+func (bm *CqlBlogManager) storedEntry(ctx context.Context, uuid string, session security.Session) (*GaeEntry, error) {
 	var entry GaeEntry
 
-	rows := bm.cql.Query("select title, slug, description, tags, date, created, updated, author, text, thumbnail, cover, deleted from blog_entry where site=? and uuid=?",
+	rows := bm.query(ctx, "select "+cqlEntryColumns+" from blog_entry where site=? and uuid=?",
 		session.Site(), uuid).Iter()
-	if !rows.Scan(&entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.thumbnail, &entry.cover, &entry.deleted) {
-		return nil, rows.Close()
+	if !scanCqlEntry(rows, &entry) {
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
 	}
 
 	// Found result
@@ -132,24 +131,25 @@ func (bm *CqlBlogManager) GetEntry(uuid string, session security.Session) (Entry
 		}
 	}
 
-	bm.entryCache.Set(entry.Uuid(), &entry)
-	bm.slugCache.Set(entry.Slug(), &entry)
-
 	return &entry, nil
 }
 
-func (bm *CqlBlogManager) GetEntries(session security.Session) ([]Entry, error) {
+func (bm *CqlBlogManager) GetEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
 
 	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
+		return nil, ErrInvalidSession
 	}
 
 	var items []Entry
 	var err error
 
-	rows := bm.cql.Query("select uuid, title, slug, description, tags, date, created, updated, author, text, thumbnail, cover, deleted from blog_entry where site=?", session.Site()).Iter()
+	now := time.Now()
+	rows := bm.query(ctx, "select "+cqlEntryColumns+" from blog_entry where site=?", session.Site()).Iter()
 	entry := &GaeEntry{}
-	for rows.Scan(&entry.uuid, &entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.thumbnail, &entry.cover, &entry.deleted) {
+	for scanCqlEntry(rows, entry) {
+		if !canSee(ctx, entry, session, now) {
+			continue
+		}
 		if entry.authorUuid != "" {
 			entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
 			if err != nil {
@@ -157,9 +157,6 @@ func (bm *CqlBlogManager) GetEntries(session security.Session) ([]Entry, error)
 			}
 		}
 		items = append(items, entry)
-
-		bm.entryCache.Set(entry.Uuid(), entry)
-		bm.slugCache.Set(entry.Slug(), entry)
 		entry = &GaeEntry{}
 	}
 
@@ -168,291 +165,187 @@ func (bm *CqlBlogManager) GetEntries(session security.Session) ([]Entry, error)
 		return nil, err
 	}
 
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date() != nil && items[j].Date() != nil {
-			return items[j].Date().Before(*items[i].Date())
-		}
-		if items[j].Date() != nil && items[i].Created() != nil {
-			return items[j].Date().Before(*items[i].Created())
-		}
-		if items[i].Date() != nil && items[j].Created() != nil {
-			return items[j].Created().Before(*items[i].Date())
-		}
-		return items[j].Created().Before(*items[i].Created())
-	})
+	sortEntries(items)
 
 	return items[:], nil
 }
 
-func (bm *CqlBlogManager) GetRecentEntries(limit int, session security.Session) ([]Entry, error) {
+func (bm *CqlBlogManager) GetRecentEntriesContext(ctx context.Context, limit int, session security.Session) ([]Entry, error) {
 
 	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
-	}
-
-	var items []Entry
-	var err error
-	now := time.Now()
-
-	rows := bm.cql.Query("select uuid, title, slug, description, tags, date, created, updated, author, text, thumbnail, cover, deleted from blog_entry where site=?", session.Site()).Iter()
-	entry := &GaeEntry{}
-	for rows.Scan(&entry.uuid, &entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.thumbnail, &entry.cover, &entry.deleted) {
-		if entry.date.Before(now) {
-			if entry.authorUuid != "" {
-				entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
-				if err != nil {
-					return nil, err
-				}
-			}
-			items = append(items, entry)
-
-			bm.entryCache.Set(entry.Uuid(), entry)
-			bm.slugCache.Set(entry.Slug(), entry)
-			entry = &GaeEntry{}
-		}
+		return nil, ErrInvalidSession
 	}
-
-	err = rows.Close()
-	if err != nil {
-		return nil, err
+	if limit <= 0 {
+		return nil, nil
 	}
 
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date() != nil && items[j].Date() != nil {
-			return items[j].Date().Before(*items[i].Date())
-		}
-		if items[j].Date() != nil && items[i].Created() != nil {
-			return items[j].Date().Before(*items[i].Created())
-		}
-		if items[i].Date() != nil && items[j].Created() != nil {
-			return items[j].Created().Before(*items[i].Date())
-		}
-		return items[j].Created().Before(*items[i].Created())
-	})
-
-	if len(items) > limit {
-		return items[0:limit], nil
-	}
-	return items[:], nil
+	now := time.Now()
+	items, _, err := bm.indexedEntries(ctx,
+		`select uuid from blog_entry_by_date where site=? and "date" < ?`,
+		[]interface{}{session.Site(), now},
+		limit, nil,
+		func(e *GaeEntry) bool {
+			return e.date != nil && e.date.Before(now)
+		},
+		session)
+	return items, err
 }
 
-func (bm *CqlBlogManager) GetEntriesByTag(tag string, limit int, session security.Session) ([]Entry, error) {
+func (bm *CqlBlogManager) GetEntriesByTagContext(ctx context.Context, tag string, limit int, session security.Session) ([]Entry, error) {
 
 	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
+		return nil, ErrInvalidSession
 	}
 
-	tag = strings.ToLower(strings.TrimSpace(tag))
-	if tag == "" {
+	tag = tagKey(tag)
+	if tag == "" || limit <= 0 {
 		return nil, nil
 	}
 
-	var items []Entry
-	var err error
 	now := time.Now()
+	items, _, err := bm.indexedEntries(ctx,
+		`select uuid from blog_entry_by_tag where site=? and tag=? and "date" < ?`,
+		[]interface{}{session.Site(), tag, now},
+		limit, nil,
+		func(e *GaeEntry) bool {
+			return e.date != nil && e.date.Before(now)
+		},
+		session)
+	return items, err
+}
 
-	rows := bm.cql.Query("select uuid, title, slug, description, tags, date, created, updated, author, text, thumbnail, cover, deleted from blog_entry where site=? and search_tags contains ?", session.Site(), "tag:"+tag).Iter()
-	entry := &GaeEntry{}
-	for rows.Scan(&entry.uuid, &entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.thumbnail, &entry.cover, &entry.deleted) {
-		if entry.date.Before(now) {
-			if entry.authorUuid != "" {
-				entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
-				if err != nil {
-					return nil, err
-				}
-			}
-			items = append(items, entry)
-
-			bm.entryCache.Set(entry.Uuid(), entry)
-			bm.slugCache.Set(entry.Slug(), entry)
-			entry = &GaeEntry{}
-		}
+// ListEntriesContext returns a page of entries, most recent first, and the
+// cursor of the next page. The cursor is empty when there are no more
+// entries.
+func (bm *CqlBlogManager) ListEntriesContext(ctx context.Context, options ListOptions, session security.Session) ([]Entry, string, error) {
+	if session == nil {
+		return nil, "", ErrInvalidSession
 	}
 
-	err = rows.Close()
+	state, err := decodeCursor(options.Cursor)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date() != nil && items[j].Date() != nil {
-			return items[j].Date().Before(*items[i].Date())
-		}
-		if items[j].Date() != nil && items[i].Created() != nil {
-			return items[j].Date().Before(*items[i].Created())
-		}
-		if items[i].Date() != nil && items[j].Created() != nil {
-			return items[j].Created().Before(*items[i].Date())
-		}
-		return items[j].Created().Before(*items[i].Created())
-	})
-
-	if len(items) > limit {
-		return items[0:limit], nil
+	stmt := "select uuid from blog_entry_by_date where site=?"
+	args := []interface{}{session.Site()}
+	if tag := options.tag(); tag != "" {
+		stmt = "select uuid from blog_entry_by_tag where site=? and tag=?"
+		args = append(args, tag)
+	} else if options.Author != "" {
+		stmt = "select uuid from blog_entry_by_author where site=? and author=?"
+		args = append(args, options.Author)
 	}
-	return items[:], nil
-}
-
-func (bm *CqlBlogManager) GetEntriesByAuthor(personUuid string, session security.Session) ([]Entry, error) {
-
-	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
+	if options.Before != nil {
+		stmt += ` and "date" < ?`
+		args = append(args, *options.Before)
 	}
-
-	var items []Entry
-	var err error
-	now := time.Now()
-
-	rows := bm.cql.Query("select uuid, title, slug, description, tags, date, created, updated, author, text, thumbnail, cover, deleted from blog_entry where site=? and author=?", session.Site(), personUuid).Iter()
-	entry := &GaeEntry{}
-	for rows.Scan(&entry.uuid, &entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.thumbnail, &entry.cover, &entry.deleted) {
-		if entry.date.After(now) {
-			if entry.authorUuid != "" {
-				entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
-				if err != nil {
-					return nil, err
-				}
-			}
-			items = append(items, entry)
-			entry = &GaeEntry{}
-		}
+	if options.After != nil {
+		stmt += ` and "date" > ?`
+		args = append(args, *options.After)
 	}
 
-	err = rows.Close()
+	items, state, err := bm.indexedEntries(ctx, stmt, args, options.limit(), state,
+		func(e *GaeEntry) bool {
+			return options.match(e)
+		},
+		session)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date() != nil && items[j].Date() != nil {
-			return items[j].Date().Before(*items[i].Date())
-		}
-		if items[j].Date() != nil && items[i].Created() != nil {
-			return items[j].Date().Before(*items[i].Created())
-		}
-		if items[i].Date() != nil && items[j].Created() != nil {
-			return items[j].Created().Before(*items[i].Date())
-		}
-		return items[j].Created().Before(*items[i].Created())
-	})
-
-	return items, nil
-
+	if len(state) == 0 {
+		return items, "", nil
+	}
+	return items, encodeCursor(state), nil
 }
 
-// SearchEntries returns all entries matching a specified keyword. Take care
-// to ensure users have permission to view each search entry. Search results
-// may include future unpublished blog articles.
-func (bm *CqlBlogManager) SearchEntries(query string, session security.Session) ([]Entry, error) {
-
+// GetEntriesByStatusContext returns all entries currently in a workflow
+// state, most recent first.
+func (bm *CqlBlogManager) GetEntriesByStatusContext(ctx context.Context, status string, session security.Session) ([]Entry, error) {
 	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
-	}
-
-	var items []Entry
-	var err error
-
-	fields := strings.Fields(strings.ToLower(query))
-	sort.Slice(fields, func(i, j int) bool {
-		return len(fields[j]) < len(fields[i])
-	})
-
-	if len(fields) == 0 {
-		return nil, nil
-	}
-
-	rows := bm.cql.Query("select uuid, title, slug, description, tags, date, created, updated, author, text, thumbnail, cover, deleted from blog_entry where site=? and search_tags=?", session.Site(), fields).Iter()
-	entry := &GaeEntry{}
-	for rows.Scan(&entry.uuid, &entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.thumbnail, &entry.cover, &entry.deleted) {
-		if entry.authorUuid != "" {
-			entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
-			if err != nil {
-				return nil, err
-			}
-		}
-		items = append(items, entry)
-		entry = &GaeEntry{}
+		return nil, ErrInvalidSession
 	}
 
-	err = rows.Close()
+	// Scheduled entries change status when their date passes, so the
+	// status is checked after loading rather than in the query.
+	items, err := bm.GetEntriesContext(ctx, session)
 	if err != nil {
 		return nil, err
 	}
 
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date() != nil && items[j].Date() != nil {
-			return items[j].Date().Before(*items[i].Date())
-		}
-		if items[j].Date() != nil && items[i].Created() != nil {
-			return items[j].Date().Before(*items[i].Created())
-		}
-		if items[i].Date() != nil && items[j].Created() != nil {
-			return items[j].Created().Before(*items[i].Date())
-		}
-		return items[j].Created().Before(*items[i].Created())
-	})
+	return withStatus(items, status), nil
+}
 
-	return items, nil
+func (bm *CqlBlogManager) GetEntriesByAuthorContext(ctx context.Context, personUuid string, session security.Session) ([]Entry, error) {
 
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	items, _, err := bm.indexedEntries(ctx,
+		"select uuid from blog_entry_by_author where site=? and author=?",
+		[]interface{}{session.Site(), personUuid},
+		0, nil,
+		func(e *GaeEntry) bool {
+			return true
+		},
+		session)
+	return items, err
 }
-func (bm *CqlBlogManager) GetFutureEntries(session security.Session) ([]Entry, error) {
 
+// SearchEntriesContext returns every entry matching a search query, most
+// relevant first.
+func (bm *CqlBlogManager) SearchEntriesContext(ctx context.Context, query string, session security.Session) ([]Entry, error) {
 	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
+		return nil, ErrInvalidSession
 	}
 
-	var items []Entry
-	var err error
-	now := time.Now()
+	return searchAll(ctx, &cqlSearchIndex{bm, ctx, session}, query, session)
+}
 
-	rows := bm.cql.Query("select uuid, title, slug, description, tags, date, created, updated, author, text, html, thumbnail, cover, deleted from blog_entry where site=?", session.Site()).Iter()
-	entry := &GaeEntry{}
-	for rows.Scan(&entry.uuid, &entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.html, &entry.thumbnail, &entry.cover, &entry.deleted) {
-		if entry.date.After(now) {
-			if entry.authorUuid != "" {
-				entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
-				if err != nil {
-					return nil, err
-				}
-			}
-			items = append(items, entry)
-			entry = &GaeEntry{}
-		}
+// SearchContext returns a page of the entries matching a search query,
+// most relevant first.
+func (bm *CqlBlogManager) SearchContext(ctx context.Context, query string, options SearchOptions, session security.Session) (*SearchResults, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
 	}
 
-	err = rows.Close()
-	if err != nil {
-		return nil, err
-	}
+	return search(ctx, &cqlSearchIndex{bm, ctx, session}, query, options, session)
+}
 
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date() != nil && items[j].Date() != nil {
-			return items[j].Date().Before(*items[i].Date())
-		}
-		if items[j].Date() != nil && items[i].Created() != nil {
-			return items[j].Date().Before(*items[i].Created())
-		}
-		if items[i].Date() != nil && items[j].Created() != nil {
-			return items[j].Created().Before(*items[i].Date())
-		}
-		return items[j].Created().Before(*items[i].Created())
-	})
+func (bm *CqlBlogManager) GetFutureEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
 
-	return items, nil
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	now := time.Now()
+	items, _, err := bm.indexedEntries(ctx,
+		`select uuid from blog_entry_by_date where site=? and "date" > ?`,
+		[]interface{}{session.Site(), now},
+		0, nil,
+		func(e *GaeEntry) bool {
+			return e.date != nil && e.date.After(now)
+		},
+		session)
+	return items, err
 }
 
-func (bm *CqlBlogManager) GetEntryBySlug(slug string, session security.Session) (Entry, error) {
+func (bm *CqlBlogManager) GetEntryBySlugContext(ctx context.Context, slug string, session security.Session) (Entry, error) {
 
 	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
+		return nil, ErrInvalidSession
 	}
 
 	var entry GaeEntry
 
-	rows := bm.cql.Query("select uuid, title, slug, description, tags, date, created, updated, author, text, html, thumbnail, cover, deleted from blog_entry where site=? and slug=?",
+	rows := bm.query(ctx, "select "+cqlEntryColumns+" from blog_entry where site=? and slug=?",
 		session.Site(), slug).Iter()
-	if !rows.Scan(&entry.uuid, &entry.title, &entry.slug, &entry.description, &entry.tags, &entry.date, &entry.created, &entry.updated, &entry.authorUuid, &entry.text, &entry.html, &entry.thumbnail, &entry.cover, &entry.deleted) {
-		return nil, rows.Close()
+	if !scanCqlEntry(rows, &entry) {
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
 	}
 
 	// Found result
@@ -460,6 +353,9 @@ func (bm *CqlBlogManager) GetEntryBySlug(slug string, session security.Session)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkVisible(ctx, &entry, session); err != nil {
+		return nil, err
+	}
 
 	if entry.authorUuid != "" {
 		entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
@@ -468,80 +364,92 @@ func (bm *CqlBlogManager) GetEntryBySlug(slug string, session security.Session)
 		}
 	}
 
-	bm.entryCache.Set(entry.Uuid(), &entry)
-	bm.slugCache.Set(entry.Slug(), &entry)
+	cacheEntry(ctx, bm.cache, session.Site(), &entry)
 
 	return &entry, nil
 }
 
-func (bm *CqlBlogManager) GetEntryCached(uuid string, session security.Session) (Entry, error) {
+func (bm *CqlBlogManager) GetEntryCachedContext(ctx context.Context, uuid string, session security.Session) (Entry, error) {
 
 	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
+		return nil, ErrInvalidSession
 	}
 
 	if uuid == "" {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 
-	v, _ := bm.entryCache.Get(uuid)
-	if v != nil {
-		entry := v.(Entry)
+	entry, ok, err := cachedEntry(ctx, bm.cache, entryCacheKey(session.Site(), uuid), bm.am, session)
+	if err != nil {
+		return nil, err
+	} else if ok {
+		if err := checkVisible(ctx, entry, session); err != nil {
+			return nil, err
+		}
 		return entry, nil
 	}
 
-	entry, err := bm.GetEntry(uuid, session)
+	entry, err = bm.GetEntryContext(ctx, uuid, session)
 	if err != nil {
 		return nil, err
 	}
-	bm.entryCache.Set(entry.Uuid(), entry)
-	bm.slugCache.Set(entry.Slug(), entry)
+	cacheEntry(ctx, bm.cache, session.Site(), entry)
 
 	return entry, nil
 }
 
-func (bm *CqlBlogManager) GetEntryBySlugCached(slug string, session security.Session) (Entry, error) {
+func (bm *CqlBlogManager) GetEntryBySlugCachedContext(ctx context.Context, slug string, session security.Session) (Entry, error) {
 
 	if session == nil {
-		return nil, errors.New("Invalid session object. Contact support.")
+		return nil, ErrInvalidSession
 	}
 
 	if slug == "" {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 
-	v, _ := bm.slugCache.Get(slug)
-	if v != nil {
-		fmt.Println(v)
-		entry := v.(Entry)
+	entry, ok, err := cachedEntry(ctx, bm.cache, slugCacheKey(session.Site(), slug), bm.am, session)
+	if err != nil {
+		return nil, err
+	} else if ok {
+		if err := checkVisible(ctx, entry, session); err != nil {
+			return nil, err
+		}
 		return entry, nil
 	}
 
-	entry, err := bm.GetEntryBySlug(slug, session)
+	entry, err = bm.GetEntryBySlugContext(ctx, slug, session)
 	if err != nil {
 		return nil, err
 	}
-	if entry == nil {
-		return nil, nil
-	}
-	bm.entryCache.Set(entry.Uuid(), entry)
-	bm.slugCache.Set(entry.Slug(), entry)
+	cacheEntry(ctx, bm.cache, session.Site(), entry)
 
 	return entry, nil
 }
 
-func (bm *CqlBlogManager) AddEntry(entry Entry, session security.Session) error {
+func (bm *CqlBlogManager) AddEntryContext(ctx context.Context, entry Entry, session security.Session) error {
 	if session == nil || !session.IsAuthenticated() {
 		return &security.ErrUnauthenticated{session}
 	}
+	if err := checkAuthor(entry.AuthorUUID(), session); err != nil {
+		return err
+	}
 
-	if entry.Title() == "" {
-		return errors.New("Entry must have a title")
+	if err := validateEntry(entry); err != nil {
+		return err
 	}
-	if entry.Text() == "" {
-		return errors.New("Entry must contain text")
+	if err := checkTransition("", entry.Status(), entry.Date(), session); err != nil {
+		return err
 	}
 
+	slug, err := uniqueSlug(entry.Slug(), entry.explicitSlug(), func(slug string) (bool, error) {
+		return bm.reserveSlug(ctx, session.Site(), slug, entry.Uuid())
+	})
+	if err != nil {
+		return err
+	}
+	entry.setSlug(slug)
+
 	bulk := &security.GaeEntityAuditLogCollection{}
 	bulk.SetEntityUuidPersonUuid(entry.Uuid(), session.PersonUuid(), session.DisplayName())
 
@@ -565,6 +473,14 @@ func (bm *CqlBlogManager) AddEntry(entry Entry, session security.Session) error
 		bulk.AddItem("Text", "", entry.Text())
 	}
 
+	if entry.Format() != FormatMarkdown {
+		bulk.AddItem("Format", "", entry.Format())
+	}
+
+	if entry.Language() != "" {
+		bulk.AddItem("Language", "", entry.Language())
+	}
+
 	if entry.Thumbnail() != "" {
 		bulk.AddItem("Thumbnail", "", entry.Thumbnail())
 	}
@@ -585,17 +501,28 @@ func (bm *CqlBlogManager) AddEntry(entry Entry, session security.Session) error
 		bulk.AddBoolItem("Deleted", false, true)
 	}
 
+	if entry.Status() != StatusDraft {
+		bulk.AddItem("Status", "", entry.Status())
+	}
+
 	now := time.Now()
 	entry.setCreated(now)
 	entry.setUpdated(now)
+	if entry.Deleted() {
+		entry.setDeletedAt(&now)
+	} else {
+		entry.setDeletedAt(nil)
+	}
 
 	// TODO: Technically should be in a transaction
 	if err := bm.am.AddEntityChangeLog(bulk, session); err != nil {
+		bm.releaseSlug(session.Site(), slug, entry.Uuid())
 		return err
 	}
 
-	rows := bm.cql.Query(
-		"update blog_entry set title=?, slug=?, description=?, tags=?, date=?, created=?, updated=?, author=?, text=?, html=?, thumbnail=?, cover=?, search_tags=?, deleted=? where site=? and uuid=?",
+	batch := bm.cql.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query(
+		"update blog_entry set title=?, slug=?, description=?, tags=?, date=?, created=?, updated=?, author=?, text=?, html=?, format=?, language=?, thumbnail=?, cover=?, search_tags=?, deleted=?, deleted_at=?, status=? where site=? and uuid=?",
 		entry.Title(),
 		entry.Slug(),
 		entry.Description(),
@@ -606,54 +533,50 @@ func (bm *CqlBlogManager) AddEntry(entry Entry, session security.Session) error
 		entry.AuthorUUID(),
 		entry.Text(),
 		entry.Html(),
+		entry.Format(),
+		entry.Language(),
 		entry.Thumbnail(),
 		entry.Cover(),
 		entry.SearchTags(),
 		entry.Deleted(),
+		entry.DeletedAt(),
+		entry.Status(),
 		session.Site(),
-		entry.Uuid()).Iter()
-	err := rows.Close()
+		entry.Uuid())
+	addCqlRevision(batch, 1, entry, session)
+	addCqlIndexes(batch, session.Site(), entry.Uuid(), nil, entry)
+	err = bm.cql.ExecuteBatch(batch)
 	if err != nil {
+		bm.releaseSlug(session.Site(), slug, entry.Uuid())
+		return err
+	}
+	if err := bm.updateSearchIndex(ctx, session.Site(), entry.Uuid(), nil, entry); err != nil {
+		return err
+	}
+	if err := bm.countSearchDocuments(ctx, session.Site(), 1); err != nil {
 		return err
 	}
 
-	bm.entryCache.Set(entry.Uuid(), entry)
-	bm.slugCache.Set(entry.Slug(), entry)
+	cacheEntry(ctx, bm.cache, session.Site(), entry)
 
 	return nil
 }
 
-func (bm *CqlBlogManager) UpdateEntry(entry Entry, session security.Session) error {
+func (bm *CqlBlogManager) UpdateEntryContext(ctx context.Context, entry Entry, session security.Session) error {
 	if session == nil || !session.IsAuthenticated() {
 		return &security.ErrUnauthenticated{session}
 	}
 
-	if entry.Title() == "" {
-		return errors.New("Entry must have a title")
-	}
-	if entry.Text() == "" {
-		return errors.New("Entry must contain text")
+	if err := validateUpdate(ctx, entry); err != nil {
+		return err
 	}
 	var current GaeEntry
-	rows := bm.cql.Query("select title, slug, description, tags, date, created, updated, author, deleted, text, html, thumbnail, cover from blog_entry where site=? and uuid=?",
+	rows := bm.query(ctx, "select "+cqlEntryColumns+" from blog_entry where site=? and uuid=?",
 		session.Site(), entry.Uuid()).Iter()
-	if !rows.Scan(
-		&current.title,
-		&current.slug,
-		&current.description,
-		&current.tags,
-		&current.date,
-		&current.created,
-		&current.updated,
-		&current.authorUuid,
-		&current.deleted,
-		&current.text,
-		&current.html,
-		&current.thumbnail,
-		&current.cover) {
+	if !scanCqlEntry(rows, &current) {
 		err := rows.Close()
 		if err == nil {
-			return errors.New("No entry has uuid " + entry.Uuid() + " on site " + session.Site())
+			return ErrNotFound
 		}
 		return err
 	}
@@ -663,12 +586,36 @@ func (bm *CqlBlogManager) UpdateEntry(entry Entry, session security.Session) err
 		return err
 	}
 
+	if err := checkAuthor(current.AuthorUUID(), session); err != nil {
+		return err
+	}
+	if err := checkAuthor(entry.AuthorUUID(), session); err != nil {
+		return err
+	}
+
+	previous := current
+
 	bulk := &security.GaeEntityAuditLogCollection{}
 	bulk.SetEntityUuidPersonUuid(entry.Uuid(), session.PersonUuid(), session.DisplayName())
 
+	// A new date can publish a scheduled entry, so the status is compared
+	// as it was before any change.
+	status := current.Status()
 	if !security.MatchingDate(entry.Date(), current.Date()) {
 		bulk.AddDateItem("Date", current.Date(), entry.Date())
-		current.SetDate(*entry.Date())
+		if entry.Date() == nil {
+			current.date = nil
+		} else {
+			current.SetDate(*entry.Date())
+		}
+	}
+
+	if entry.Status() != status {
+		if err := checkTransition(status, entry.Status(), current.Date(), session); err != nil {
+			return err
+		}
+		bulk.AddItem("Status", status, entry.Status())
+		current.SetStatus(entry.Status())
 	}
 
 	if entry.Title() != current.Title() {
@@ -686,6 +633,16 @@ func (bm *CqlBlogManager) UpdateEntry(entry Entry, session security.Session) err
 		current.SetText(entry.Text())
 	}
 
+	if entry.Format() != current.Format() {
+		bulk.AddItem("Format", current.Format(), entry.Format())
+		current.SetFormat(entry.Format())
+	}
+
+	if entry.Language() != current.Language() {
+		bulk.AddItem("Language", current.Language(), entry.Language())
+		current.SetLanguage(entry.Language())
+	}
+
 	if entry.Thumbnail() != current.Thumbnail() {
 		bulk.AddItem("Thumbnail", current.Thumbnail(), entry.Thumbnail())
 		current.SetThumbnail(entry.Thumbnail())
@@ -701,17 +658,61 @@ func (bm *CqlBlogManager) UpdateEntry(entry Entry, session security.Session) err
 		current.SetTags(entry.Tags())
 	}
 
+	if entry.AuthorUUID() != current.AuthorUUID() {
+		bulk.AddItem("Author", current.AuthorUUID(), entry.AuthorUUID())
+		current.authorUuid = entry.AuthorUUID()
+		current.author = entry.Author()
+	}
+
+	if entry.Deleted() != current.Deleted() {
+		bulk.AddBoolItem("Deleted", current.Deleted(), entry.Deleted())
+		current.SetDeleted(entry.Deleted())
+	}
+
+	// The new slug is claimed last, so it only needs releasing again if
+	// saving the entry fails.
+	release := func() {}
+	if entry.Slug() != current.Slug() {
+		slug, err := uniqueSlug(entry.Slug(), entry.explicitSlug(), func(slug string) (bool, error) {
+			return bm.reserveSlug(ctx, session.Site(), slug, current.Uuid())
+		})
+		if err != nil {
+			return err
+		}
+		bulk.AddItem("Slug", current.Slug(), slug)
+		current.slug = slug
+		entry.setSlug(slug)
+		release = func() {
+			bm.releaseSlug(session.Site(), slug, current.Uuid())
+		}
+	}
+
 	if bulk.HasUpdates() {
 		if err := bm.am.AddEntityChangeLog(bulk, session); err != nil {
+			release()
 			return err
 		}
 
 		now := time.Now()
 		current.updated = &now
+		if current.deleted != previous.deleted {
+			if current.deleted {
+				current.deletedAt = &now
+			} else {
+				current.deletedAt = nil
+			}
+		}
+		entry.setDeletedAt(current.deletedAt)
+
+		revision, err := bm.latestRevision(ctx, current.Uuid(), session)
+		if err != nil {
+			release()
+			return err
+		}
 
-		bm.slugCache.Remove(entry.Slug())
-		rows := bm.cql.Query(
-			"update blog_entry set title=?, slug=?, description=?, tags=?, date=?, updated=?, author=?, text=?, html=?, deleted=?, search_tags=?, thumbnail=?, cover=? where site=? and uuid=?",
+		batch := bm.cql.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+		batch.Query(
+			"update blog_entry set title=?, slug=?, description=?, tags=?, date=?, updated=?, author=?, text=?, html=?, format=?, language=?, deleted=?, deleted_at=?, search_tags=?, thumbnail=?, cover=?, status=? where site=? and uuid=?",
 			current.Title(),
 			current.Slug(),
 			current.Description(),
@@ -721,30 +722,70 @@ func (bm *CqlBlogManager) UpdateEntry(entry Entry, session security.Session) err
 			current.AuthorUUID(),
 			current.Text(),
 			current.Html(),
+			current.Format(),
+			current.Language(),
 			current.Deleted(),
+			current.DeletedAt(),
 			current.SearchTags(),
 			current.Thumbnail(),
 			current.Cover(),
+			current.Status(),
 			session.Site(),
-			current.Uuid()).Iter()
-		err := rows.Close()
+			current.Uuid())
+		addCqlRevision(batch, revision+1, &current, session)
+		addCqlIndexes(batch, session.Site(), current.Uuid(), &previous, &current)
+		if current.Slug() != previous.Slug() && previous.Slug() != "" {
+			addCqlSlugHistory(batch, session.Site(), previous.Slug(), current.Uuid(), now)
+		}
+		err = bm.cql.ExecuteBatch(batch)
 		if err != nil {
+			release()
+			return err
+		}
+		if current.Slug() != previous.Slug() {
+			if err := bm.releaseSlug(session.Site(), previous.Slug(), current.Uuid()); err != nil {
+				return err
+			}
+		}
+		if err := bm.updateSearchIndex(ctx, session.Site(), current.Uuid(), &previous, &current); err != nil {
 			return err
 		}
 
-		bm.slugCache.Remove(current.Slug())
-		bm.slugCache.Set(current.Slug(), &current)
+		// Cached copies are reloaded with their author on next access
+		uncacheEntry(context.Background(), bm.cache, session.Site(), current.Uuid(), previous.Slug(), current.Slug())
 	}
 
 	return nil
 }
 
-// DeleteEntry removes a blog entry from the database. It does not remove
-// entity change history, so theoretically the data is recoverable by a
-// programmer if the situation calls for recovery of a blog entry.
-func (bm *CqlBlogManager) DeleteEntry(uuid string, session security.Session) error {
+// DeleteEntryContext moves a blog entry to the trash.
+func (bm *CqlBlogManager) DeleteEntryContext(ctx context.Context, uuid string, session security.Session) error {
+	return trashEntry(ctx, bm, uuid, true, session, bm.storedEntryFunc(ctx, session))
+}
+
+// RestoreEntryContext moves a blog entry out of the trash.
+func (bm *CqlBlogManager) RestoreEntryContext(ctx context.Context, uuid string, session security.Session) error {
+	return trashEntry(ctx, bm, uuid, false, session, bm.storedEntryFunc(ctx, session))
+}
+
+// storedEntryFunc returns storedEntry as a function of the entry uuid.
+func (bm *CqlBlogManager) storedEntryFunc(ctx context.Context, session security.Session) func(uuid string) (Entry, error) {
+	return func(uuid string) (Entry, error) {
+		return bm.storedEntry(ctx, uuid, session)
+	}
+}
+
+func (bm *CqlBlogManager) GetDeletedEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
+	return deletedEntries(ctx, bm, session)
+}
+
+// PurgeEntryContext removes a deleted blog entry and its revisions from the
+// database. It does not remove entity change history, so theoretically the
+// data is recoverable by a programmer if the situation calls for recovery
+// of a blog entry.
+func (bm *CqlBlogManager) PurgeEntryContext(ctx context.Context, uuid string, session security.Session) error {
 	if uuid == "" {
-		return errors.New("Cannot delete entry without a uuid")
+		return ErrNotFound
 	}
 	if session == nil || !session.IsAuthenticated() {
 		return &security.ErrUnauthenticated{session}
@@ -752,22 +793,243 @@ func (bm *CqlBlogManager) DeleteEntry(uuid string, session security.Session) err
 
 	// Must fetch first so we know the slug, so we can clear the slug
 	// from the cache
-	entry, err := bm.GetEntryCached(uuid, session)
+	entry, err := bm.storedEntry(ctx, uuid, session)
 	if err != nil {
 		return err
 	}
-	if entry == nil {
-		return errors.New("No entry has this uuid")
+	if err := checkPurge(entry, session); err != nil {
+		return err
 	}
 
-	rows := bm.cql.Query("delete from blog_entry where uuid=?", uuid).Iter()
-	err = rows.Close()
+	batch := bm.cql.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query("delete from blog_entry where site=? and uuid=?", session.Site(), uuid)
+	batch.Query("delete from blog_entry_revision where site=? and uuid=?", session.Site(), uuid)
+	addCqlIndexes(batch, session.Site(), uuid, entry, nil)
+	err = bm.cql.ExecuteBatch(batch)
 	if err != nil {
 		return err
 	}
+	if err := bm.releaseSlug(session.Site(), entry.Slug(), uuid); err != nil {
+		return err
+	}
+	if err := bm.updateSearchIndex(ctx, session.Site(), uuid, entry, nil); err != nil {
+		return err
+	}
+	if err := bm.countSearchDocuments(ctx, session.Site(), -1); err != nil {
+		return err
+	}
 
-	bm.entryCache.Remove(uuid)
-	bm.slugCache.Remove(entry.Slug())
+	uncacheEntry(context.Background(), bm.cache, session.Site(), uuid, entry.Slug())
 
 	return nil
 }
+
+// cqlRevisionColumns are the blog_entry_revision columns read by
+// scanCqlRevision.
+const cqlRevisionColumns = "revision, title, slug, description, thumbnail, cover, tags, date, author, text, format, language, deleted, person, person_name, created"
+
+func scanCqlRevision(rows *gocql.Iter, r *Revision, entry *GaeEntry) bool {
+	return rows.Scan(&r.Number, &entry.title, &entry.slug, &entry.description, &entry.thumbnail, &entry.cover, &entry.tags, &entry.date, &entry.authorUuid, &entry.text, &entry.format, &entry.language, &entry.deleted, &r.PersonUuid, &r.DisplayName, &r.Created)
+}
+
+// addCqlRevision adds the statement recording a snapshot of an entry to a
+// batch.
+func addCqlRevision(batch *gocql.Batch, number int, entry Entry, session security.Session) {
+	batch.Query(
+		"insert into blog_entry_revision (site, uuid, "+cqlRevisionColumns+") values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		session.Site(),
+		entry.Uuid(),
+		number,
+		entry.Title(),
+		entry.Slug(),
+		entry.Description(),
+		entry.Thumbnail(),
+		entry.Cover(),
+		entry.Tags(),
+		entry.Date(),
+		entry.AuthorUUID(),
+		entry.Text(),
+		entry.Format(),
+		entry.Language(),
+		entry.Deleted(),
+		session.PersonUuid(),
+		session.DisplayName(),
+		entry.Updated())
+}
+
+// latestRevision returns the number of the most recent revision of an
+// entry, or zero if it has none.
+func (bm *CqlBlogManager) latestRevision(ctx context.Context, uuid string, session security.Session) (int, error) {
+	var number int
+	rows := bm.query(ctx, "select revision from blog_entry_revision where site=? and uuid=? limit 1", session.Site(), uuid).Iter()
+	rows.Scan(&number)
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	return number, nil
+}
+
+// GetRevisionsContext returns every saved version of an entry, newest first.
+// Entries saved before revision history was introduced have no revisions
+// until they are next updated.
+func (bm *CqlBlogManager) GetRevisionsContext(ctx context.Context, uuid string, session security.Session) ([]*Revision, error) {
+	if err := checkRevisions(uuid, session, bm.storedEntryFunc(ctx, session)); err != nil {
+		return nil, err
+	}
+
+	var items []*Revision
+	var err error
+
+	rows := bm.query(ctx, "select "+cqlRevisionColumns+" from blog_entry_revision where site=? and uuid=?", session.Site(), uuid).Iter()
+	r := &Revision{}
+	entry := &GaeEntry{uuid: uuid}
+	for scanCqlRevision(rows, r, entry) {
+		if entry.authorUuid != "" {
+			entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
+			if err != nil {
+				return nil, err
+			}
+		}
+		r.Entry = entry
+		items = append(items, r)
+		r = &Revision{}
+		entry = &GaeEntry{uuid: uuid}
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (bm *CqlBlogManager) GetRevisionContext(ctx context.Context, uuid string, revision int, session security.Session) (*Revision, error) {
+	if err := checkRevisions(uuid, session, bm.storedEntryFunc(ctx, session)); err != nil {
+		return nil, err
+	}
+
+	r := &Revision{}
+	entry := &GaeEntry{uuid: uuid}
+	rows := bm.query(ctx, "select "+cqlRevisionColumns+" from blog_entry_revision where site=? and uuid=? and revision=?", session.Site(), uuid, revision).Iter()
+	if !scanCqlRevision(rows, r, entry) {
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	err := rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.authorUuid != "" {
+		entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.Entry = entry
+
+	return r, nil
+}
+
+// RestoreRevisionContext saves the content of an earlier revision as the
+// current version of an entry.
+func (bm *CqlBlogManager) RestoreRevisionContext(ctx context.Context, uuid string, revision int, session security.Session) error {
+	return restoreRevision(ctx, bm, uuid, revision, session)
+}
+
+// The methods below call their Context variants with a background context.
+
+func (bm *CqlBlogManager) GetEntry(uuid string, session security.Session) (Entry, error) {
+	return bm.GetEntryContext(context.Background(), uuid, session)
+}
+
+func (bm *CqlBlogManager) GetEntries(session security.Session) ([]Entry, error) {
+	return bm.GetEntriesContext(context.Background(), session)
+}
+
+func (bm *CqlBlogManager) GetRecentEntries(limit int, session security.Session) ([]Entry, error) {
+	return bm.GetRecentEntriesContext(context.Background(), limit, session)
+}
+
+func (bm *CqlBlogManager) GetEntriesByTag(tag string, limit int, session security.Session) ([]Entry, error) {
+	return bm.GetEntriesByTagContext(context.Background(), tag, limit, session)
+}
+
+func (bm *CqlBlogManager) ListEntries(options ListOptions, session security.Session) ([]Entry, string, error) {
+	return bm.ListEntriesContext(context.Background(), options, session)
+}
+
+func (bm *CqlBlogManager) GetEntriesByStatus(status string, session security.Session) ([]Entry, error) {
+	return bm.GetEntriesByStatusContext(context.Background(), status, session)
+}
+
+func (bm *CqlBlogManager) GetEntriesByAuthor(personUuid string, session security.Session) ([]Entry, error) {
+	return bm.GetEntriesByAuthorContext(context.Background(), personUuid, session)
+}
+
+func (bm *CqlBlogManager) SearchEntries(query string, session security.Session) ([]Entry, error) {
+	return bm.SearchEntriesContext(context.Background(), query, session)
+}
+
+func (bm *CqlBlogManager) GetFutureEntries(session security.Session) ([]Entry, error) {
+	return bm.GetFutureEntriesContext(context.Background(), session)
+}
+
+func (bm *CqlBlogManager) GetEntryBySlug(slug string, session security.Session) (Entry, error) {
+	return bm.GetEntryBySlugContext(context.Background(), slug, session)
+}
+
+func (bm *CqlBlogManager) GetEntryCached(uuid string, session security.Session) (Entry, error) {
+	return bm.GetEntryCachedContext(context.Background(), uuid, session)
+}
+
+func (bm *CqlBlogManager) GetEntryBySlugCached(slug string, session security.Session) (Entry, error) {
+	return bm.GetEntryBySlugCachedContext(context.Background(), slug, session)
+}
+
+func (bm *CqlBlogManager) Search(query string, options SearchOptions, session security.Session) (*SearchResults, error) {
+	return bm.SearchContext(context.Background(), query, options, session)
+}
+
+func (bm *CqlBlogManager) AddEntry(entry Entry, session security.Session) error {
+	return bm.AddEntryContext(context.Background(), entry, session)
+}
+
+func (bm *CqlBlogManager) UpdateEntry(entry Entry, session security.Session) error {
+	return bm.UpdateEntryContext(context.Background(), entry, session)
+}
+
+func (bm *CqlBlogManager) DeleteEntry(uuid string, session security.Session) error {
+	return bm.DeleteEntryContext(context.Background(), uuid, session)
+}
+
+func (bm *CqlBlogManager) RestoreEntry(uuid string, session security.Session) error {
+	return bm.RestoreEntryContext(context.Background(), uuid, session)
+}
+
+func (bm *CqlBlogManager) GetDeletedEntries(session security.Session) ([]Entry, error) {
+	return bm.GetDeletedEntriesContext(context.Background(), session)
+}
+
+func (bm *CqlBlogManager) PurgeEntry(uuid string, session security.Session) error {
+	return bm.PurgeEntryContext(context.Background(), uuid, session)
+}
+
+func (bm *CqlBlogManager) GetRevisions(uuid string, session security.Session) ([]*Revision, error) {
+	return bm.GetRevisionsContext(context.Background(), uuid, session)
+}
+
+func (bm *CqlBlogManager) GetRevision(uuid string, revision int, session security.Session) (*Revision, error) {
+	return bm.GetRevisionContext(context.Background(), uuid, revision, session)
+}
+
+func (bm *CqlBlogManager) RestoreRevision(uuid string, revision int, session security.Session) error {
+	return bm.RestoreRevisionContext(context.Background(), uuid, revision, session)
+}
+
+func (bm *CqlBlogManager) ResolveSlug(slug string, session security.Session) (Entry, string, error) {
+	return bm.ResolveSlugContext(context.Background(), slug, session)
+}
@@ -0,0 +1,225 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gitlab.com/montebo/security"
+)
+
+// The blog_entry table is partitioned by site and clustered by uuid, so it
+// can not be read in date order. Each entry therefore also has a row in
+// blog_entry_by_date, a row in blog_entry_by_tag for each of its tags, and
+// a row in blog_entry_by_author. These rows are clustered most recent first
+// by the entry date, or the creation time of entries without a date, and
+// are written in the same logged batch as the entry itself.
+var cqlIndexTables = []string{`
+create table if not exists blog_entry_by_date (
+	site text,
+	"date" timestamp,
+	uuid text,
+	primary key ((site), "date", uuid))
+	with clustering order by ("date" desc, uuid asc)
+`, `
+create table if not exists blog_entry_by_tag (
+	site text,
+	tag text,
+	"date" timestamp,
+	uuid text,
+	primary key ((site, tag), "date", uuid))
+	with clustering order by ("date" desc, uuid asc)
+`, `
+create table if not exists blog_entry_by_author (
+	site text,
+	author text,
+	"date" timestamp,
+	uuid text,
+	primary key ((site, author), "date", uuid))
+	with clustering order by ("date" desc, uuid asc)
+`}
+
+// cqlIndexPageSize is the number of index rows read at a time when a query
+// has no limit.
+const cqlIndexPageSize = 200
+
+// A cqlIndexKey identifies the row of one index table that refers to an
+// entry.
+type cqlIndexKey struct {
+	table  string
+	column string
+	value  string
+	date   time.Time
+}
+
+// cqlIndexKeys returns the index rows that refer to an entry. Dates are
+// truncated to the millisecond precision that cassandra stores, so that
+// keys of a saved entry compare equal to keys of the entry when reloaded.
+func cqlIndexKeys(e Entry) []cqlIndexKey {
+	if e == nil {
+		return nil
+	}
+
+	date := entryTime(e).Truncate(time.Millisecond).UTC()
+	keys := []cqlIndexKey{{table: "blog_entry_by_date", date: date}}
+	for _, tag := range e.Tags() {
+		if t := tagKey(tag); t != "" {
+			keys = append(keys, cqlIndexKey{"blog_entry_by_tag", "tag", t, date})
+		}
+	}
+	if e.AuthorUUID() != "" {
+		keys = append(keys, cqlIndexKey{"blog_entry_by_author", "author", e.AuthorUUID(), date})
+	}
+	return keys
+}
+
+func (k cqlIndexKey) insert(batch *gocql.Batch, site, uuid string) {
+	if k.column == "" {
+		batch.Query("insert into "+k.table+` (site, "date", uuid) values (?, ?, ?)`, site, k.date, uuid)
+		return
+	}
+	batch.Query("insert into "+k.table+" (site, "+k.column+`, "date", uuid) values (?, ?, ?, ?)`, site, k.value, k.date, uuid)
+}
+
+func (k cqlIndexKey) delete(batch *gocql.Batch, site, uuid string) {
+	if k.column == "" {
+		batch.Query("delete from "+k.table+` where site=? and "date"=? and uuid=?`, site, k.date, uuid)
+		return
+	}
+	batch.Query("delete from "+k.table+" where site=? and "+k.column+`=? and "date"=? and uuid=?`, site, k.value, k.date, uuid)
+}
+
+// addCqlIndexes adds the statements that move the index rows of an entry
+// from its previous version to its current version to a batch. previous is
+// nil for a new entry and current is nil for a deleted entry. Rows present
+// in both versions are left untouched, as a delete and insert of the same
+// row in one batch share a timestamp and the delete would win.
+func addCqlIndexes(batch *gocql.Batch, site, uuid string, previous, current Entry) {
+	before := cqlIndexKeys(previous)
+	after := cqlIndexKeys(current)
+
+	contains := func(keys []cqlIndexKey, key cqlIndexKey) bool {
+		for _, k := range keys {
+			if k.table == key.table && k.value == key.value && k.date.Equal(key.date) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, k := range before {
+		if !contains(after, k) {
+			k.delete(batch, site, uuid)
+		}
+	}
+	for _, k := range after {
+		if !contains(before, k) {
+			k.insert(batch, site, uuid)
+		}
+	}
+}
+
+// indexedEntries reads uuids from an index table query and returns the
+// entries they refer to in index order. Entries the session may not see
+// with ctx, and entries rejected by match, are skipped. At most limit entries are returned, or every entry when limit
+// is zero. The returned page state is empty when the query has no more
+// rows.
+func (bm *CqlBlogManager) indexedEntries(ctx context.Context, stmt string, args []interface{}, limit int, state []byte, match func(e *GaeEntry) bool, session security.Session) ([]Entry, []byte, error) {
+	var items []Entry
+	now := time.Now()
+
+	for {
+		// Only request as many rows as are still needed, so that a page
+		// never ends part way through the rows read from cassandra.
+		size := cqlIndexPageSize
+		if limit > 0 {
+			size = limit - len(items)
+		}
+
+		var uuids []string
+		var uuid string
+		rows := bm.query(ctx, stmt, args...).PageSize(size).PageState(state).Iter()
+		state = rows.PageState()
+		for rows.Scan(&uuid) {
+			uuids = append(uuids, uuid)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, nil, err
+		}
+
+		entries, err := bm.entriesByUuid(ctx, uuids, session)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, u := range uuids {
+			// Index rows may briefly outlive their entry
+			if e, ok := entries[u]; ok && canSee(ctx, e, session, now) && match(e) {
+				items = append(items, e)
+			}
+		}
+
+		if len(state) == 0 || (limit > 0 && len(items) >= limit) {
+			return items, state, nil
+		}
+	}
+}
+
+// entriesByUuid loads a set of entries on the session site, keyed by uuid.
+func (bm *CqlBlogManager) entriesByUuid(ctx context.Context, uuids []string, session security.Session) (map[string]*GaeEntry, error) {
+	items := make(map[string]*GaeEntry)
+	if len(uuids) == 0 {
+		return items, nil
+	}
+
+	var err error
+	rows := bm.query(ctx, "select "+cqlEntryColumns+" from blog_entry where site=? and uuid in ?", session.Site(), uuids).Iter()
+	entry := &GaeEntry{}
+	for scanCqlEntry(rows, entry) {
+		if entry.authorUuid != "" {
+			entry.author, err = bm.am.GetPersonCached(entry.authorUuid, session)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+		}
+		items[entry.uuid] = entry
+		entry = &GaeEntry{}
+	}
+
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// BackfillIndexes writes the date, tag and author index rows of every entry
+// on every site. It is run by the schema migration that creates the index
+// tables, and may be run again at any time to repair the indexes.
+func (bm *CqlBlogManager) BackfillIndexes() error {
+	var site string
+	entry := &GaeEntry{}
+	count := 0
+
+	rows := bm.cql.Query(`select site, uuid, "date", created, tags, author from blog_entry`).Iter()
+	for rows.Scan(&site, &entry.uuid, &entry.date, &entry.created, &entry.tags, &entry.authorUuid) {
+		batch := bm.cql.NewBatch(gocql.LoggedBatch)
+		addCqlIndexes(batch, site, entry.uuid, nil, entry)
+		if err := bm.cql.ExecuteBatch(batch); err != nil {
+			rows.Close()
+			return errors.New("Blog index backfill failed. " + err.Error())
+		}
+		count++
+		entry = &GaeEntry{}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	if bm.log != nil && count > 0 {
+		bm.log.Info("Indexed %d blog entries", count)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package blog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCqlIndexKeys(t *testing.T) {
+	date := time.Date(2021, 3, 4, 5, 6, 7, 891234567, time.UTC)
+	e := &GaeEntry{tags: []string{"Go", "Big News", " "}, authorUuid: "a1"}
+	e.SetDate(date)
+
+	keys := cqlIndexKeys(e)
+	want := []cqlIndexKey{
+		{"blog_entry_by_date", "", "", date.Truncate(time.Millisecond)},
+		{"blog_entry_by_tag", "tag", "go", date.Truncate(time.Millisecond)},
+		{"blog_entry_by_tag", "tag", "big-news", date.Truncate(time.Millisecond)},
+		{"blog_entry_by_author", "author", "a1", date.Truncate(time.Millisecond)},
+	}
+	if len(keys) != len(want) {
+		t.Fatalf("cqlIndexKeys() returned %d keys, want %d", len(keys), len(want))
+	}
+	for i := range want {
+		if keys[i].table != want[i].table || keys[i].value != want[i].value || !keys[i].date.Equal(want[i].date) {
+			t.Errorf("cqlIndexKeys()[%d] = %v, want %v", i, keys[i], want[i])
+		}
+	}
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	undated := &GaeEntry{created: &created}
+	if keys := cqlIndexKeys(undated); len(keys) != 1 || !keys[0].date.Equal(created) {
+		t.Errorf("cqlIndexKeys() of an undated entry should use the creation time, got %v", keys)
+	}
+
+	if keys := cqlIndexKeys(nil); keys != nil {
+		t.Errorf("cqlIndexKeys(nil) = %v, want nil", keys)
+	}
+}
@@ -0,0 +1,323 @@
+package blog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zaddok/base62"
+)
+
+// A CqlMigration is one versioned change to the cassandra schema of the
+// blog. Statements are executed in order, followed by Run when it is set.
+// Every migration must be safe to apply again: tables and indexes are
+// created with "if not exists", and an "alter table ... add" statement for a
+// column that already exists is treated as having succeeded. This allows
+// keyspaces created before schema versions were recorded to be brought up to
+// date by applying every migration.
+type CqlMigration struct {
+	Version     int
+	Description string
+	Statements  []string
+	Run         func(bm *CqlBlogManager) error
+}
+
+// cqlSchemaComponent identifies the blog in blog_schema_version.
+const cqlSchemaComponent = "blog"
+
+// cqlMigrations lists every schema change in the order it is applied. New
+// migrations must be appended with the next version number; released
+// migrations must never be changed.
+var cqlMigrations = []*CqlMigration{
+	{
+		Version:     1,
+		Description: "Create blog_entry table",
+		Statements: []string{`
+create table if not exists blog_entry (
+	site text,
+	uuid text,
+	slug text,
+	title text,
+	description text,
+	tags set<text>,
+	search_tags set<text>,
+	"date" timestamp,
+	created timestamp,
+	updated timestamp,
+	author text,
+	text text,
+	deleted boolean,
+	primary key ((site), uuid))`,
+			`create index if not exists blog_slug on blog_entry (slug)`,
+			`create index if not exists blog_entry_search on blog_entry (search_tags)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "Add thumbnail, cover and html columns to blog_entry",
+		Statements: []string{
+			`alter table blog_entry add thumbnail text`,
+			`alter table blog_entry add cover text`,
+			`alter table blog_entry add html text`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "Add blog_author index",
+		Statements: []string{
+			`create index if not exists blog_author on blog_entry (author)`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "Add format column to blog_entry",
+		Statements: []string{
+			`alter table blog_entry add format text`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "Create blog_entry_revision table",
+		Statements: []string{`
+create table if not exists blog_entry_revision (
+	site text,
+	uuid text,
+	revision int,
+	title text,
+	slug text,
+	description text,
+	thumbnail text,
+	cover text,
+	tags set<text>,
+	"date" timestamp,
+	author text,
+	text text,
+	format text,
+	deleted boolean,
+	person text,
+	person_name text,
+	created timestamp,
+	primary key ((site, uuid), revision))
+	with clustering order by (revision desc)`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "Add status column to blog_entry",
+		Statements: []string{
+			`alter table blog_entry add status text`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "Create and back-fill date, tag and author index tables",
+		Statements:  cqlIndexTables,
+		Run: func(bm *CqlBlogManager) error {
+			return bm.BackfillIndexes()
+		},
+	},
+	{
+		Version:     8,
+		Description: "Create and back-fill blog_entry_by_slug table",
+		Statements:  []string{cqlSlugTable},
+		Run: func(bm *CqlBlogManager) error {
+			return bm.BackfillSlugs()
+		},
+	},
+	{
+		Version:     9,
+		Description: "Create blog_slug_history table",
+		Statements:  []string{cqlSlugHistoryTable},
+	},
+	{
+		Version:     10,
+		Description: "Add deleted_at column to blog_entry",
+		Statements: []string{
+			`alter table blog_entry add deleted_at timestamp`,
+		},
+	},
+	{
+		Version:     11,
+		Description: "Create and back-fill blog_search_index table",
+		Statements:  []string{cqlSearchTable},
+		Run: func(bm *CqlBlogManager) error {
+			return bm.BackfillSearch()
+		},
+	},
+	{
+		Version:     12,
+		Description: "Add language columns and re-index entries for search",
+		Statements: []string{
+			`alter table blog_entry add language text`,
+			`alter table blog_entry_revision add language text`,
+		},
+		Run: func(bm *CqlBlogManager) error {
+			return bm.BackfillSearch()
+		},
+	},
+	{
+		Version:     13,
+		Description: "Create and back-fill blog_search_documents table",
+		Statements:  []string{cqlSearchDocumentsTable},
+		Run: func(bm *CqlBlogManager) error {
+			return bm.BackfillSearchDocuments()
+		},
+	},
+}
+
+// CqlMigrations returns every schema migration known to this version of the
+// package, in the order they are applied.
+func CqlMigrations() []*CqlMigration {
+	return cqlMigrations
+}
+
+// SchemaVersion returns the version of the most recent migration applied to
+// the keyspace, or zero if none have been applied.
+func (bm *CqlBlogManager) SchemaVersion() (int, error) {
+	if err := bm.cql.Query(`
+create table if not exists blog_schema_version (
+	component text,
+	version int,
+	description text,
+	applied timestamp,
+	primary key ((component), version))
+	with clustering order by (version desc)`).Exec(); err != nil {
+		return 0, errors.New("blog_schema_version creation failed. " + err.Error())
+	}
+
+	var version int
+	rows := bm.cql.Query("select version from blog_schema_version where component=? limit 1", cqlSchemaComponent).Iter()
+	rows.Scan(&version)
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// PendingMigrations returns the migrations that have not been applied to
+// the keyspace, without applying them.
+func (bm *CqlBlogManager) PendingMigrations() ([]*CqlMigration, error) {
+	version, err := bm.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*CqlMigration
+	for _, m := range cqlMigrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies every pending migration in order and returns the
+// migrations applied. When dryRun is set the pending migrations are
+// reported and returned but not applied. Migrate is called by
+// NewCqlBlogManager. Servers that start at the same time take turns to
+// apply migrations, holding a lock in blog_schema_lock, so each pending
+// migration is applied once.
+func (bm *CqlBlogManager) Migrate(dryRun bool) ([]*CqlMigration, error) {
+	if !dryRun {
+		unlock, err := bm.lockMigrations()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	pending, err := bm.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range pending {
+		if dryRun {
+			if bm.log != nil {
+				bm.log.Info("Pending blog schema migration %d: %s", m.Version, m.Description)
+			}
+			continue
+		}
+
+		if bm.log != nil {
+			bm.log.Info("Applying blog schema migration %d: %s", m.Version, m.Description)
+		}
+		if err := bm.applyMigration(m); err != nil {
+			return pending[:i], fmt.Errorf("Blog schema migration %d failed. %v", m.Version, err)
+		}
+	}
+
+	return pending, nil
+}
+
+// cqlMigrationLockTTL is how long the migration lock is held by a server
+// that stops without releasing it.
+const cqlMigrationLockTTL = time.Hour
+
+// lockMigrations waits until no other server is applying migrations, and
+// returns a function that lets others apply them again.
+func (bm *CqlBlogManager) lockMigrations() (func(), error) {
+	if err := bm.cql.Query(`
+create table if not exists blog_schema_lock (
+	component text,
+	owner text,
+	primary key (component))`).Exec(); err != nil {
+		return nil, errors.New("blog_schema_lock creation failed. " + err.Error())
+	}
+
+	owner := base62.NewUuid()
+	for waited := false; ; waited = true {
+		locked, err := bm.cql.Query("insert into blog_schema_lock (component, owner) values (?, ?) if not exists using ttl ?",
+			cqlSchemaComponent, owner, int(cqlMigrationLockTTL/time.Second)).MapScanCAS(make(map[string]interface{}))
+		if err != nil {
+			return nil, errors.New("Blog schema migration lock failed. " + err.Error())
+		}
+		if locked {
+			break
+		}
+		if !waited && bm.log != nil {
+			bm.log.Info("Waiting for another server to apply blog schema migrations")
+		}
+		time.Sleep(time.Second)
+	}
+
+	return func() {
+		_, err := bm.cql.Query("delete from blog_schema_lock where component=? if owner=?", cqlSchemaComponent, owner).MapScanCAS(make(map[string]interface{}))
+		if err != nil && bm.log != nil {
+			bm.log.Warning("Blog schema migration lock was not released. %v", err)
+		}
+	}, nil
+}
+
+func (bm *CqlBlogManager) applyMigration(m *CqlMigration) error {
+	for _, stmt := range m.Statements {
+		err := bm.cql.Query(stmt).Exec()
+		if err != nil && !(isCqlAddColumn(stmt) && strings.Contains(err.Error(), "exist")) {
+			return err
+		}
+	}
+
+	if m.Run != nil {
+		if err := m.Run(bm); err != nil {
+			return err
+		}
+	}
+
+	return bm.cql.Query("insert into blog_schema_version (component, version, description, applied) values (?, ?, ?, ?)",
+		cqlSchemaComponent, m.Version, m.Description, time.Now()).Exec()
+}
+
+// isCqlUndefinedColumn reports whether an error is the one returned for a
+// query reading a column that has not been added to its table.
+func isCqlUndefinedColumn(err error, column string) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "undefined column name "+column)
+}
+
+var cqlAddColumn = regexp.MustCompile(`(?is)^\s*alter\s+table\s+\S+\s+add\s`)
+
+// isCqlAddColumn reports whether a statement adds a column to a table.
+func isCqlAddColumn(stmt string) bool {
+	return cqlAddColumn.MatchString(stmt)
+}
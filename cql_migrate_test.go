@@ -0,0 +1,58 @@
+package blog
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCqlMigrationsOrdered(t *testing.T) {
+	for i, m := range CqlMigrations() {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+		if m.Description == "" {
+			t.Errorf("migration %d has no description", m.Version)
+		}
+		if len(m.Statements) == 0 && m.Run == nil {
+			t.Errorf("migration %d does nothing", m.Version)
+		}
+	}
+}
+
+func TestIsCqlAddColumn(t *testing.T) {
+	cases := []struct {
+		stmt string
+		want bool
+	}{
+		{"alter table blog_entry add format text", true},
+		{"\n  ALTER TABLE blog_entry\n\tADD status text", true},
+		{"alter table blog_entry drop format", false},
+		{"alter table blog_entry with comment = 'add'", false},
+		{"create table if not exists blog_schema_version (component text)", false},
+	}
+
+	for _, c := range cases {
+		if got := isCqlAddColumn(c.stmt); got != c.want {
+			t.Errorf("isCqlAddColumn(%q) = %v, want %v", c.stmt, got, c.want)
+		}
+	}
+}
+
+func TestIsCqlUndefinedColumn(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("Undefined column name language"), true},
+		{errors.New("Undefined column name language in table blog.blog_entry"), true},
+		{errors.New("Undefined column name status"), false},
+		{errors.New("Keyspace blog does not exist"), false},
+	}
+
+	for _, c := range cases {
+		if got := isCqlUndefinedColumn(c.err, "language"); got != c.want {
+			t.Errorf("isCqlUndefinedColumn(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
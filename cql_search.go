@@ -0,0 +1,218 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+
+	"github.com/gocql/gocql"
+	"gitlab.com/montebo/security"
+)
+
+// The search index has a row for each term of each entry. Rows are
+// partitioned by site and the first letters of the term, so that a prefix
+// query of at least minPrefix letters reads a single partition, and are
+// clustered by term so that prefixes can be read as a range.
+const cqlSearchTable = `
+create table if not exists blog_search_index (
+	site text,
+	bucket text,
+	term text,
+	uuid text,
+	weight double,
+	positions list<int>,
+	primary key ((site, bucket), term, uuid))
+`
+
+// The number of entries on each site, which weighs search terms by how
+// few entries contain them, is kept in a counter rather than counted for
+// every search. It only needs to be roughly right.
+const cqlSearchDocumentsTable = `
+create table if not exists blog_search_documents (
+	site text,
+	entries counter,
+	primary key (site))
+`
+
+// cqlSearchBatchSize is the number of index rows written in each batch.
+const cqlSearchBatchSize = 50
+
+// searchBucket returns the partition of the search index holding a term.
+func searchBucket(term string) string {
+	i, n := 0, 0
+	for n < minPrefix && i < len(term) {
+		_, size := utf8.DecodeRuneInString(term[i:])
+		i += size
+		n++
+	}
+	return term[:i]
+}
+
+// updateSearchIndex moves the search index rows of an entry from its
+// previous version to its current version. previous is nil for a new entry
+// and current is nil for a purged entry. The rows are written after the
+// entry, so an error leaves the index out of date until the entry is saved
+// again or BackfillSearch is run.
+func (bm *CqlBlogManager) updateSearchIndex(ctx context.Context, site, uuid string, previous, current Entry) error {
+	before := searchPostings(previous)
+	after := searchPostings(current)
+
+	batch := bm.cql.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+	flush := func(force bool) error {
+		if batch.Size() == 0 || (!force && batch.Size() < cqlSearchBatchSize) {
+			return nil
+		}
+		err := bm.cql.ExecuteBatch(batch)
+		batch = bm.cql.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+		return err
+	}
+
+	for term := range before {
+		if after[term] == nil {
+			batch.Query("delete from blog_search_index where site=? and bucket=? and term=? and uuid=?", site, searchBucket(term), term, uuid)
+			if err := flush(false); err != nil {
+				return err
+			}
+		}
+	}
+	for term, p := range after {
+		if samePosting(before[term], p) {
+			continue
+		}
+		batch.Query("insert into blog_search_index (site, bucket, term, uuid, weight, positions) values (?, ?, ?, ?, ?, ?)",
+			site, searchBucket(term), term, uuid, p.weight, p.positions)
+		if err := flush(false); err != nil {
+			return err
+		}
+	}
+	return flush(true)
+}
+
+// cqlSearchIndex reads the search index of the session site.
+type cqlSearchIndex struct {
+	bm      *CqlBlogManager
+	ctx     context.Context
+	session security.Session
+}
+
+func (index *cqlSearchIndex) postings(term string, prefix bool) ([]posting, error) {
+	site := index.session.Site()
+	var rows *gocql.Iter
+	if prefix {
+		rows = index.bm.query(index.ctx, "select term, uuid, weight, positions from blog_search_index where site=? and bucket=? and term>=? and term<?",
+			site, searchBucket(term), term, term+string(utf8.MaxRune)).Iter()
+	} else {
+		rows = index.bm.query(index.ctx, "select term, uuid, weight, positions from blog_search_index where site=? and bucket=? and term=?",
+			site, searchBucket(term), term).Iter()
+	}
+
+	var items []posting
+	var p posting
+	for rows.Scan(&p.term, &p.uuid, &p.weight, &p.positions) {
+		items = append(items, p)
+		p = posting{}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (index *cqlSearchIndex) documents() (int, error) {
+	var count int64
+	err := index.bm.query(index.ctx, "select entries from blog_search_documents where site=?", index.session.Site()).Scan(&count)
+	if err == gocql.ErrNotFound {
+		return 0, nil
+	}
+	return int(count), err
+}
+
+// countSearchDocuments adds n to the number of entries on a site.
+func (bm *CqlBlogManager) countSearchDocuments(ctx context.Context, site string, n int) error {
+	return bm.query(ctx, "update blog_search_documents set entries = entries + ? where site=?", int64(n), site).Exec()
+}
+
+func (index *cqlSearchIndex) entries(uuids []string) (map[string]Entry, error) {
+	items := make(map[string]Entry)
+	for len(uuids) > 0 {
+		n := len(uuids)
+		if n > cqlIndexPageSize {
+			n = cqlIndexPageSize
+		}
+		entries, err := index.bm.entriesByUuid(index.ctx, uuids[:n], index.session)
+		if err != nil {
+			return nil, err
+		}
+		for uuid, e := range entries {
+			items[uuid] = e
+		}
+		uuids = uuids[n:]
+	}
+	return items, nil
+}
+
+// BackfillSearch writes the search index rows of every entry on every
+// site. It is run by the schema migration that creates the search index,
+// and may be run again at any time to repair the index. Entries are read
+// with their language, so when it is run by that migration on a keyspace
+// that does not have the language column yet, nothing is written and the
+// index is back-filled by the migration that adds the column.
+func (bm *CqlBlogManager) BackfillSearch() error {
+	var site string
+	entry := &GaeEntry{}
+	count := 0
+
+	rows := bm.cql.Query("select " + cqlEntryColumns + ", site from blog_entry").Iter()
+	for scanCqlEntry(rows, entry, &site) {
+		if err := bm.updateSearchIndex(context.Background(), site, entry.uuid, nil, entry); err != nil {
+			rows.Close()
+			return errors.New("Blog search index backfill failed. " + err.Error())
+		}
+		count++
+		entry = &GaeEntry{}
+	}
+	if err := rows.Close(); isCqlUndefinedColumn(err, "language") {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if bm.log != nil && count > 0 {
+		bm.log.Info("Indexed %d blog entries for search", count)
+	}
+	return nil
+}
+
+// BackfillSearchDocuments sets the number of entries on every site used
+// to rank search results. It is run once, by the schema migration that
+// creates the counters, while Migrate holds the migration lock. Counters
+// can only be added to, so two runs at once would each add the difference
+// to the count. Entries added or purged while it runs may be miscounted,
+// which only affects how results are ranked.
+func (bm *CqlBlogManager) BackfillSearchDocuments() error {
+	var site string
+	counts := make(map[string]int)
+
+	rows := bm.cql.Query("select site from blog_entry").Iter()
+	for rows.Scan(&site) {
+		counts[site]++
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for site, n := range counts {
+		var count int64
+		err := bm.query(ctx, "select entries from blog_search_documents where site=?", site).Scan(&count)
+		if err != nil && err != gocql.ErrNotFound {
+			return err
+		}
+		if n != int(count) {
+			if err := bm.countSearchDocuments(ctx, site, n-int(count)); err != nil {
+				return errors.New("Blog search document count failed. " + err.Error())
+			}
+		}
+	}
+	return nil
+}
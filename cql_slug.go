@@ -0,0 +1,101 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gitlab.com/montebo/security"
+)
+
+// blog_entry_by_slug records which entry owns each slug on a site. Slugs are
+// claimed with a lightweight transaction before an entry is written, so two
+// entries can never be saved with the same slug.
+const cqlSlugTable = `
+create table if not exists blog_entry_by_slug (
+	site text,
+	slug text,
+	uuid text,
+	primary key ((site, slug)))`
+
+// blog_slug_history records the entry that most recently gave up each slug,
+// so that links using a previous slug can be redirected.
+const cqlSlugHistoryTable = `
+create table if not exists blog_slug_history (
+	site text,
+	slug text,
+	uuid text,
+	moved timestamp,
+	primary key ((site, slug)))`
+
+// reserveSlug claims a slug for an entry, returning false if another entry
+// already has it.
+func (bm *CqlBlogManager) reserveSlug(ctx context.Context, site, slug, uuid string) (bool, error) {
+	existing := make(map[string]interface{})
+	applied, err := bm.query(ctx, "insert into blog_entry_by_slug (site, slug, uuid) values (?, ?, ?) if not exists",
+		site, slug, uuid).MapScanCAS(existing)
+	if err != nil {
+		return false, err
+	}
+	return applied || existing["uuid"] == uuid, nil
+}
+
+// releaseSlug gives up the claim an entry has on a slug. It is not tied to
+// the context of the request, as a cancelled request must not leave the
+// slug claimed.
+func (bm *CqlBlogManager) releaseSlug(site, slug, uuid string) error {
+	_, err := bm.cql.Query("delete from blog_entry_by_slug where site=? and slug=? if uuid=?",
+		site, slug, uuid).MapScanCAS(make(map[string]interface{}))
+	return err
+}
+
+// addCqlSlugHistory adds a record of an entry giving up a slug to a batch.
+func addCqlSlugHistory(batch *gocql.Batch, site, slug, uuid string, moved time.Time) {
+	batch.Query("insert into blog_slug_history (site, slug, uuid, moved) values (?, ?, ?, ?)",
+		site, slug, uuid, moved)
+}
+
+func (bm *CqlBlogManager) ResolveSlugContext(ctx context.Context, slug string, session security.Session) (Entry, string, error) {
+	return resolveSlug(ctx, bm, slug, session, func(slug string) (string, error) {
+		var uuid string
+		err := bm.query(ctx, "select uuid from blog_slug_history where site=? and slug=?",
+			session.Site(), slug).Scan(&uuid)
+		if err == gocql.ErrNotFound {
+			return "", nil
+		}
+		return uuid, err
+	})
+}
+
+// BackfillSlugs claims the slug of every entry on every site. Where entries
+// saved before slugs were unique share a slug, the first entry read keeps
+// it; the others can still be read by uuid and should be given new slugs.
+func (bm *CqlBlogManager) BackfillSlugs() error {
+	var site, uuid, slug string
+	count := 0
+
+	rows := bm.cql.Query(`select site, uuid, slug from blog_entry`).Iter()
+	for rows.Scan(&site, &uuid, &slug) {
+		if slug == "" {
+			continue
+		}
+		ok, err := bm.reserveSlug(context.Background(), site, slug, uuid)
+		if err != nil {
+			rows.Close()
+			return errors.New("Blog slug backfill failed. " + err.Error())
+		}
+		if !ok && bm.log != nil {
+			bm.log.Warning("Blog entry %s on %s shares the slug %s with another entry", uuid, site, slug)
+		}
+		count++
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	if bm.log != nil && count > 0 {
+		bm.log.Info("Reserved %d blog slugs", count)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package blog
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// ErrNotFound is returned when a requested entry or revision does not
+// exist on the session site.
+var ErrNotFound = errors.New("Entry not found")
+
+// ErrDeleted is returned instead of a published entry that has been
+// deleted, when the session may not see deleted entries. It matches
+// ErrNotFound with errors.Is.
+var ErrDeleted error = errDeleted{}
+
+type errDeleted struct{}
+
+func (errDeleted) Error() string {
+	return "Entry has been deleted"
+}
+
+func (errDeleted) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ErrInvalidSession is returned when a BlogManager method is called
+// without a session.
+var ErrInvalidSession = errors.New("Invalid session object. Contact support.")
+
+// ErrValidation is returned when an entry can not be saved because one or
+// more of its fields are invalid. Fields maps each invalid field name to a
+// description of the problem.
+type ErrValidation struct {
+	Fields map[string]string
+}
+
+func (e *ErrValidation) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	messages := make([]string, len(names))
+	for i, name := range names {
+		messages[i] = e.Fields[name]
+	}
+	return strings.Join(messages, ". ")
+}
+
+// invalid returns an ErrValidation for a single field.
+func invalid(field, message string) *ErrValidation {
+	return &ErrValidation{Fields: map[string]string{field: message}}
+}
+
+// ErrSlugConflict is returned when an entry can not be saved because
+// another entry on the site already has its slug.
+type ErrSlugConflict struct {
+	Slug string
+}
+
+func (e *ErrSlugConflict) Error() string {
+	return "Another entry already has the slug " + e.Slug
+}
+
+// ErrForbidden is returned when the session person does not have a role
+// that permits a change to an entry.
+type ErrForbidden struct {
+	Reason string
+}
+
+func (e *ErrForbidden) Error() string {
+	return e.Reason
+}
+
+// validateEntry returns an ErrValidation if an entry is missing the fields
+// every saved entry must have.
+func validateEntry(entry Entry) error {
+	fields := make(map[string]string)
+	if entry.Title() == "" {
+		fields["Title"] = "Entry must have a title"
+	}
+	if entry.Text() == "" {
+		fields["Text"] = "Entry must contain text"
+	}
+	if !knownFormat(entry.Format()) {
+		fields["Format"] = "Unsupported entry format " + entry.Format()
+	}
+	if entry.explicitSlug() {
+		if problem := checkSlug(entry.Slug()); problem != "" {
+			fields["Slug"] = problem
+		}
+	}
+	if entry.Language() != "" {
+		if _, err := language.Parse(entry.Language()); err != nil {
+			fields["Language"] = "Unknown language " + entry.Language()
+		}
+	}
+	if len(fields) > 0 {
+		return &ErrValidation{Fields: fields}
+	}
+	return nil
+}
@@ -0,0 +1,461 @@
+package blog
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"gitlab.com/montebo/security"
+)
+
+// DefaultFeedLimit is the number of entries in a feed when no limit is
+// given.
+const DefaultFeedLimit = 20
+
+// A Feed is an RSS 2.0 or Atom 1.0 syndication feed of blog entries.
+// Configure the feed, load entries with LoadRecent, LoadTag, LoadAuthor or
+// LoadPage, then write it with RSS, Atom, JSON or the matching Serve method.
+type Feed struct {
+	// Title and Description describe the feed.
+	Title       string
+	Description string
+
+	// Link is the absolute URL of the blog home page. Entries link to
+	// Link + "/" + slug unless EntryLink is set.
+	Link string
+
+	// Self is the absolute URL the feed is published at.
+	Self string
+
+	// Language is the optional language of the feed, such as "en-au".
+	Language string
+
+	// Author is the name used for entries without an author.
+	Author string
+
+	// EntryLink optionally returns the absolute URL of an entry.
+	EntryLink func(e Entry) string
+
+	// Site is used to build the globally unique id of each entry. It is
+	// set to the session site when entries are loaded.
+	Site string
+
+	// Entries in the feed, most recent first.
+	Entries []Entry
+
+	// Next is the cursor of the following page of a paginated feed, set by
+	// LoadPage. It is empty on the last page.
+	Next string
+
+	// Changed is the time the set of entries the feed is loaded from last
+	// changed, including entries that have since been deleted, unpublished
+	// or purged. The entries alone can not show that one was removed, so
+	// requests with only If-Modified-Since are answered with 304 Not
+	// Modified only when Changed is set.
+	Changed time.Time
+}
+
+// LoadRecent sets the feed entries to the most recent published entries.
+func (f *Feed) LoadRecent(bm BlogManager, limit int, session security.Session) error {
+	items, err := bm.GetRecentEntries(feedLimit(limit), session)
+	return f.load(items, limit, err, session)
+}
+
+// LoadTag sets the feed entries to the most recent published entries with
+// a tag.
+func (f *Feed) LoadTag(bm BlogManager, tag string, limit int, session security.Session) error {
+	items, err := bm.GetEntriesByTag(tag, feedLimit(limit), session)
+	return f.load(items, limit, err, session)
+}
+
+// LoadAuthor sets the feed entries to the most recent published entries
+// written by a person.
+func (f *Feed) LoadAuthor(bm BlogManager, personUuid string, limit int, session security.Session) error {
+	items, err := bm.GetEntriesByAuthor(personUuid, session)
+	return f.load(items, limit, err, session)
+}
+
+func feedLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultFeedLimit
+	}
+	return limit
+}
+
+// load keeps the entries that are published, not deleted and dated in the
+// past, up to the feed limit.
+func (f *Feed) load(items []Entry, limit int, err error, session security.Session) error {
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	f.Site = session.Site()
+	f.Entries = nil
+	f.Next = ""
+	for _, e := range items {
+		if len(f.Entries) >= feedLimit(limit) {
+			break
+		}
+		if isPublic(e, now) {
+			f.Entries = append(f.Entries, e)
+		}
+	}
+	return nil
+}
+
+// Updated returns the time the most recently changed entry in the feed was
+// saved, or the zero time if the feed is empty.
+func (f *Feed) Updated() time.Time {
+	var updated time.Time
+	for _, e := range f.Entries {
+		if t := entryUpdated(e); t.After(updated) {
+			updated = t
+		}
+	}
+	return updated
+}
+
+// ETag returns a strong entity tag that changes whenever an entry is added
+// to, removed from or updated in the feed. It is a hash of the uuid and
+// save time of each entry, so that an entry dropping out of the feed as
+// another is published changes it too.
+func (f *Feed) ETag() string {
+	h := sha256.New()
+	for _, e := range f.Entries {
+		fmt.Fprintf(h, "%s %d\n", e.Uuid(), entryUpdated(e).UnixNano())
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+}
+
+// lastModified returns the Last-Modified time of the feed, or the zero
+// time when Changed is not set. A scheduled entry changes the feed when
+// its date passes, so entry dates count as well as save times.
+func (f *Feed) lastModified() time.Time {
+	if f.Changed.IsZero() {
+		return time.Time{}
+	}
+	modified := f.Changed
+	for _, e := range f.Entries {
+		if t := entryUpdated(e); t.After(modified) {
+			modified = t
+		}
+		if e.Date() != nil && e.Date().After(modified) {
+			modified = *e.Date()
+		}
+	}
+	return modified
+}
+
+// entryUpdated returns the time an entry was last saved.
+func entryUpdated(e Entry) time.Time {
+	if e.Updated() != nil {
+		return *e.Updated()
+	}
+	return entryTime(e)
+}
+
+// link returns the absolute URL of an entry.
+func (f *Feed) link(e Entry) string {
+	if f.EntryLink != nil {
+		return f.EntryLink(e)
+	}
+	return strings.TrimSuffix(f.Link, "/") + "/" + e.Slug()
+}
+
+// EntryID returns the globally unique and permanent id of an entry, a tag
+// URI (RFC 4151) built from the site, the date the entry was created and
+// its uuid.
+func EntryID(site string, e Entry) string {
+	t := entryTime(e)
+	if e.Created() != nil {
+		t = *e.Created()
+	}
+	return "tag:" + site + "," + t.UTC().Format("2006-01-02") + ":blog/" + e.Uuid()
+}
+
+func authorName(e Entry, fallback string) string {
+	if a := e.Author(); a != nil {
+		if a.DisplayName() != "" {
+			return a.DisplayName()
+		}
+		if name := strings.TrimSpace(a.FirstName() + " " + a.LastName()); name != "" {
+			return name
+		}
+	}
+	return fallback
+}
+
+// coverType returns the media type of a cover image, based on its file
+// extension.
+func coverType(cover string) string {
+	u := cover
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	t := mime.TypeByExtension(strings.ToLower(path.Ext(u)))
+	if t == "" {
+		return "image/jpeg"
+	}
+	return t
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Content string     `xml:"xmlns:content,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          *atomLink `xml:"atom:link,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Creator     string        `xml:"dc:creator,omitempty"`
+	Categories  []string      `xml:"category"`
+	Description string        `xml:"description,omitempty"`
+	Content     *cdata        `xml:"content:encoded,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+// RSS returns the feed as an RSS 2.0 document.
+func (f *Feed) RSS() ([]byte, error) {
+	doc := rssDocument{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Content: "http://purl.org/rss/1.0/modules/content/",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: f.Description,
+			Language:    f.Language,
+		},
+	}
+	if updated := f.Updated(); !updated.IsZero() {
+		doc.Channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+	if f.Self != "" {
+		doc.Channel.Self = &atomLink{Href: f.Self, Rel: "self", Type: "application/rss+xml"}
+	}
+
+	for _, e := range f.Entries {
+		item := rssItem{
+			Title:       e.Title(),
+			Link:        f.link(e),
+			GUID:        rssGUID{IsPermaLink: "false", Value: EntryID(f.Site, e)},
+			Creator:     authorName(e, f.Author),
+			Categories:  e.Tags(),
+			Description: e.Description(),
+			Content:     &cdata{e.Html()},
+		}
+		if e.Date() != nil {
+			item.PubDate = e.Date().UTC().Format(time.RFC1123Z)
+		}
+		if e.Cover() != "" {
+			item.Enclosure = &rssEnclosure{URL: e.Cover(), Length: "0", Type: coverType(e.Cover())}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	return marshalFeed(doc)
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang     string      `xml:"xml:lang,attr,omitempty"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Links    []atomLink  `xml:"link"`
+	Updated  string      `xml:"updated"`
+	Author   *atomAuthor `xml:"author,omitempty"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published,omitempty"`
+	Updated    string         `xml:"updated"`
+	Author     *atomAuthor    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+// Atom returns the feed as an Atom 1.0 document.
+func (f *Feed) Atom() ([]byte, error) {
+	id := f.Self
+	if id == "" {
+		id = f.Link
+	}
+	doc := atomFeed{
+		Lang:     f.Language,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       id,
+		Links:    []atomLink{{Href: f.Link, Rel: "alternate", Type: "text/html"}},
+		Updated:  f.Updated().UTC().Format(time.RFC3339),
+	}
+	if f.Self != "" {
+		doc.Links = append(doc.Links, atomLink{Href: f.Self, Rel: "self", Type: "application/atom+xml"})
+	}
+	if f.Author != "" {
+		doc.Author = &atomAuthor{f.Author}
+	}
+
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			Title:   e.Title(),
+			ID:      EntryID(f.Site, e),
+			Links:   []atomLink{{Href: f.link(e), Rel: "alternate", Type: "text/html"}},
+			Updated: entryUpdated(e).UTC().Format(time.RFC3339),
+			Content: &atomText{"html", e.Html()},
+		}
+		if e.Date() != nil {
+			entry.Published = e.Date().UTC().Format(time.RFC3339)
+		}
+		if name := authorName(e, ""); name != "" {
+			entry.Author = &atomAuthor{name}
+		} else if f.Author == "" {
+			// Atom requires every entry to have an author
+			entry.Author = &atomAuthor{f.Title}
+		}
+		for _, tag := range e.Tags() {
+			entry.Categories = append(entry.Categories, atomCategory{tag})
+		}
+		if e.Description() != "" {
+			entry.Summary = &atomText{Value: e.Description()}
+		}
+		if e.Cover() != "" {
+			entry.Links = append(entry.Links, atomLink{Href: e.Cover(), Rel: "enclosure", Type: coverType(e.Cover())})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return marshalFeed(doc)
+}
+
+func marshalFeed(doc interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ServeRSS writes the feed as an RSS 2.0 response, or a 304 Not Modified
+// response if the client already has the current version.
+func (f *Feed) ServeRSS(w http.ResponseWriter, r *http.Request) {
+	f.serve(w, r, "application/rss+xml; charset=utf-8", f.RSS)
+}
+
+// ServeAtom writes the feed as an Atom 1.0 response, or a 304 Not Modified
+// response if the client already has the current version.
+func (f *Feed) ServeAtom(w http.ResponseWriter, r *http.Request) {
+	f.serve(w, r, "application/atom+xml; charset=utf-8", f.Atom)
+}
+
+func (f *Feed) serve(w http.ResponseWriter, r *http.Request, contentType string, render func() ([]byte, error)) {
+	if notModified(w, r, f.ETag(), f.lastModified()) {
+		return
+	}
+
+	data, err := render()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// notModified sets the ETag and Last-Modified headers of a response and,
+// if the request preconditions show the client already has this version,
+// writes a 304 Not Modified response and returns true. If-None-Match takes
+// precedence over If-Modified-Since, as required by RFC 7232, and
+// If-Modified-Since is ignored when modified is the zero time.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	match := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == "*" || t == etag {
+				match = true
+			}
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !modified.Truncate(time.Second).After(t) {
+			match = true
+		}
+	}
+
+	if match {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return match
+}
@@ -0,0 +1,241 @@
+package blog
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFeed(t *testing.T) (*Feed, *MemoryBlogManager, *testSession) {
+	t.Helper()
+
+	am := newTestAccessManager()
+	bm := NewMemoryBlogManager(am)
+	session := &testSession{site: "feed.com", personUuid: "p0", authenticated: true, roles: []string{RoleEditor}}
+	p1 := am.addPerson("p1", "Jane", "Li")
+
+	add := func(title, date, status string, tags ...string) Entry {
+		e := bm.NewEntry()
+		e.SetTitle(title)
+		e.SetDescription("About " + title)
+		e.SetText("Text of *" + title + "*")
+		e.SetDate(*StringToDatePointer(date))
+		e.SetAuthor(p1)
+		e.SetTags(tags)
+		e.SetStatus(status)
+		if err := bm.AddEntry(e, session); err != nil {
+			t.Fatalf("AddEntry(%q) failed: %v", title, err)
+		}
+		return e
+	}
+	add("First", "2001/1/1", StatusPublished, "news")
+	second := add("Second & last", "2002/1/1", StatusPublished, "news", "go")
+	second.SetCover("https://feed.com/cover.png")
+	if err := bm.UpdateEntry(second, session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+	add("Draft", "2003/1/1", StatusDraft, "news")
+	add("Future", "2100/1/1", StatusPublished, "news")
+
+	return &Feed{
+		Title:       "Feed blog",
+		Description: "A test feed",
+		Link:        "https://feed.com/blog",
+		Self:        "https://feed.com/blog/feed",
+	}, bm, session
+}
+
+func TestFeedRSS(t *testing.T) {
+	f, bm, session := newTestFeed(t)
+	if err := f.LoadRecent(bm, 10, session); err != nil {
+		t.Fatalf("LoadRecent() failed: %v", err)
+	}
+	if len(f.Entries) != 2 {
+		t.Fatalf("LoadRecent() loaded %d entries, want 2 published entries", len(f.Entries))
+	}
+
+	data, err := f.RSS()
+	if err != nil {
+		t.Fatalf("RSS() failed: %v", err)
+	}
+	var doc struct {
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title   string   `xml:"title"`
+				Link    string   `xml:"link"`
+				GUID    string   `xml:"guid"`
+				Content string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+				Creator string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+				Tags    []string `xml:"category"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("RSS() is not valid XML: %v\n%s", err, data)
+	}
+	items := doc.Channel.Items
+	if len(items) != 2 || items[0].Title != "Second & last" || items[1].Title != "First" {
+		t.Fatalf("RSS() has unexpected items:\n%s", data)
+	}
+	if items[0].Link != "https://feed.com/blog/"+f.Entries[0].Slug() {
+		t.Errorf("RSS() item link %q", items[0].Link)
+	}
+	if !strings.HasPrefix(items[0].GUID, "tag:feed.com,") || !strings.HasSuffix(items[0].GUID, ":blog/"+f.Entries[0].Uuid()) {
+		t.Errorf("RSS() item guid %q", items[0].GUID)
+	}
+	if !strings.Contains(items[0].Content, "<em>Second &amp; last</em>") {
+		t.Errorf("RSS() item content %q", items[0].Content)
+	}
+	if items[0].Creator != "Jane Li" || len(items[0].Tags) != 2 {
+		t.Errorf("RSS() item creator %q tags %v", items[0].Creator, items[0].Tags)
+	}
+	if !strings.Contains(string(data), `<enclosure url="https://feed.com/cover.png" length="0" type="image/png">`) {
+		t.Errorf("RSS() should include the cover as an enclosure:\n%s", data)
+	}
+}
+
+func TestFeedAtom(t *testing.T) {
+	f, bm, session := newTestFeed(t)
+	if err := f.LoadTag(bm, "go", 10, session); err != nil {
+		t.Fatalf("LoadTag() failed: %v", err)
+	}
+
+	data, err := f.Atom()
+	if err != nil {
+		t.Fatalf("Atom() failed: %v", err)
+	}
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			Title   string `xml:"title"`
+			ID      string `xml:"id"`
+			Author  string `xml:"author>name"`
+			Content string `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Atom() is not valid XML: %v\n%s", err, data)
+	}
+	if doc.ID != f.Self || len(doc.Entries) != 1 || doc.Entries[0].Title != "Second & last" {
+		t.Fatalf("Atom() has unexpected content:\n%s", data)
+	}
+	if doc.Entries[0].ID != EntryID("feed.com", f.Entries[0]) || doc.Entries[0].Author != "Jane Li" {
+		t.Errorf("Atom() entry id %q author %q", doc.Entries[0].ID, doc.Entries[0].Author)
+	}
+	if _, err := time.Parse(time.RFC3339, doc.Updated); err != nil {
+		t.Errorf("Atom() updated %q: %v", doc.Updated, err)
+	}
+
+	if err := f.LoadAuthor(bm, "p1", 1, session); err != nil {
+		t.Fatalf("LoadAuthor() failed: %v", err)
+	}
+	if len(f.Entries) != 1 || f.Entries[0].Title() != "Second & last" {
+		t.Errorf("LoadAuthor() loaded %d entries", len(f.Entries))
+	}
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	f, bm, session := newTestFeed(t)
+	if err := f.LoadRecent(bm, 10, session); err != nil {
+		t.Fatalf("LoadRecent() failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	f.ServeRSS(w, httptest.NewRequest("GET", "/blog/feed", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/rss+xml") {
+		t.Fatalf("ServeRSS() returned %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") != "" {
+		t.Fatalf("ServeRSS() should set ETag and, without Changed, no Last-Modified")
+	}
+	r := httptest.NewRequest("GET", "/blog/feed", nil)
+	r.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	f.ServeRSS(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("ServeRSS() with only If-Modified-Since and no Changed returned %d", w.Code)
+	}
+
+	f.Changed = f.Updated()
+	w = httptest.NewRecorder()
+	f.ServeRSS(w, httptest.NewRequest("GET", "/blog/feed", nil))
+	modified := w.Header().Get("Last-Modified")
+	if modified == "" {
+		t.Fatalf("ServeRSS() should set Last-Modified when Changed is set")
+	}
+
+	cases := []struct {
+		header, value string
+		want          int
+	}{
+		{"If-None-Match", etag, http.StatusNotModified},
+		{"If-None-Match", `"other", ` + etag, http.StatusNotModified},
+		{"If-None-Match", `"other"`, http.StatusOK},
+		{"If-Modified-Since", modified, http.StatusNotModified},
+		{"If-Modified-Since", "Mon, 01 Jan 2001 00:00:00 GMT", http.StatusOK},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/blog/feed.atom", nil)
+		r.Header.Set(c.header, c.value)
+		w := httptest.NewRecorder()
+		f.ServeAtom(w, r)
+		if w.Code != c.want {
+			t.Errorf("ServeAtom() with %s: %s returned %d, want %d", c.header, c.value, w.Code, c.want)
+		}
+		if c.want == http.StatusNotModified && w.Body.Len() > 0 {
+			t.Errorf("ServeAtom() should not write a body with 304 Not Modified")
+		}
+	}
+
+	previous := f.ETag()
+	e := f.Entries[1]
+	e.SetText("Changed text")
+	time.Sleep(time.Millisecond)
+	if err := bm.UpdateEntry(e, session); err != nil {
+		t.Fatalf("UpdateEntry() failed: %v", err)
+	}
+	if err := f.LoadRecent(bm, 10, session); err != nil {
+		t.Fatalf("LoadRecent() failed: %v", err)
+	}
+	if f.ETag() == previous {
+		t.Errorf("ETag() should change when an entry is updated")
+	}
+
+	// Replacing an older entry keeps the count and newest save time.
+	previous = f.ETag()
+	last := f.Entries[len(f.Entries)-1]
+	f.Entries[len(f.Entries)-1] = &GaeEntry{uuid: "replacement", date: last.Date(), updated: last.Updated()}
+	if f.ETag() == previous {
+		t.Errorf("ETag() should change when an entry is replaced")
+	}
+
+	// Deleting the most recently saved entry moves the newest save time
+	// back, but the time the entry set changed moves on.
+	if err := bm.DeleteEntry(e.Uuid(), session); err != nil {
+		t.Fatalf("DeleteEntry() failed: %v", err)
+	}
+	if err := f.LoadRecent(bm, 10, session); err != nil {
+		t.Fatalf("LoadRecent() failed: %v", err)
+	}
+	f.Changed = f.Changed.Add(time.Minute)
+	for _, header := range []string{"If-Modified-Since", "If-None-Match"} {
+		r := httptest.NewRequest("GET", "/blog/feed.atom", nil)
+		if header == "If-None-Match" {
+			r.Header.Set(header, etag)
+		} else {
+			r.Header.Set(header, modified)
+		}
+		w := httptest.NewRecorder()
+		f.ServeAtom(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("ServeAtom() with %s after a deletion returned %d, want %d", header, w.Code, http.StatusOK)
+		}
+	}
+}
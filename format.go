@@ -0,0 +1,213 @@
+package blog
+
+import (
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Content formats an entry's text may be written in.
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatText     = "text"
+	FormatAsciiDoc = "asciidoc"
+)
+
+// A Renderer converts entry text written in one content format into
+// sanitized HTML.
+type Renderer interface {
+	Render(text string) string
+}
+
+// RendererFunc adapts an ordinary function to the Renderer interface.
+type RendererFunc func(text string) string
+
+func (f RendererFunc) Render(text string) string {
+	return f(text)
+}
+
+var renderersLock sync.RWMutex
+var renderers = map[string]Renderer{
+	FormatMarkdown: RendererFunc(RenderMarkdown),
+	FormatHTML:     RendererFunc(RenderHTML),
+	FormatText:     RendererFunc(RenderText),
+	FormatAsciiDoc: RendererFunc(RenderAsciiDoc),
+}
+
+// RegisterRenderer adds a renderer for a content format, or replaces the
+// renderer for an existing format. Renderers are responsible for sanitizing
+// the HTML they return.
+func RegisterRenderer(format string, r Renderer) {
+	renderersLock.Lock()
+	defer renderersLock.Unlock()
+
+	renderers[format] = r
+}
+
+// Formats returns the names of all content formats with a renderer.
+func Formats() []string {
+	renderersLock.RLock()
+	defer renderersLock.RUnlock()
+
+	var formats []string
+	for f := range renderers {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// knownFormat reports whether a content format has a renderer.
+func knownFormat(format string) bool {
+	renderersLock.RLock()
+	defer renderersLock.RUnlock()
+
+	_, ok := renderers[format]
+	return ok
+}
+
+// Render converts text in the specified content format into HTML. Text in
+// an unknown format is rendered as Markdown.
+func Render(format, text string) string {
+	renderersLock.RLock()
+	r, ok := renderers[format]
+	if !ok {
+		r = renderers[FormatMarkdown]
+	}
+	renderersLock.RUnlock()
+
+	return r.Render(text)
+}
+
+// RenderHTML sanitizes HTML text.
+func RenderHTML(text string) string {
+	return sanitizer.Sanitize(text)
+}
+
+// RenderText converts plain text into HTML. Blank lines separate paragraphs
+// and single line breaks are kept.
+func RenderText(text string) string {
+	var b strings.Builder
+	for _, p := range paragraphs(text) {
+		lines := strings.Split(p, "\n")
+		for i, l := range lines {
+			lines[i] = template.HTMLEscapeString(strings.TrimSpace(l))
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>\n") + "</p>\n")
+	}
+	return b.String()
+}
+
+// paragraphs splits text on blank lines, ignoring empty paragraphs.
+func paragraphs(text string) []string {
+	var items []string
+	var current []string
+	for _, l := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(l) == "" {
+			if len(current) > 0 {
+				items = append(items, strings.Join(current, "\n"))
+				current = nil
+			}
+			continue
+		}
+		current = append(current, l)
+	}
+	if len(current) > 0 {
+		items = append(items, strings.Join(current, "\n"))
+	}
+	return items
+}
+
+var asciiDocInline = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`\b(https?://[^\s\[]+)\[([^\]]*)\]`), `<a href="$1">$2</a>`},
+	{regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*]*[^*\s])?)\*`), `$1<strong>$2</strong>`},
+	{regexp.MustCompile(`(^|[^\w_])_([^_\s](?:[^_]*[^_\s])?)_`), `$1<em>$2</em>`},
+	{regexp.MustCompile("`([^`]+)`"), `<code>$1</code>`},
+}
+
+// RenderAsciiDoc converts a small subset of AsciiDoc into sanitized HTML:
+// section titles, paragraphs, bulleted and numbered lists, listing blocks,
+// *bold*, _italic_, `monospace` and url[text] links.
+func RenderAsciiDoc(text string) string {
+	var b strings.Builder
+	var paragraph []string
+	list := ""
+
+	closeParagraph := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + asciiDocText(strings.Join(paragraph, " ")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(kind string) {
+		if list != kind {
+			closeList()
+			b.WriteString("<" + kind + ">\n")
+			list = kind
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		switch {
+		case line == "----":
+			closeParagraph()
+			closeList()
+			var listing []string
+			for i++; i < len(lines) && strings.TrimRight(lines[i], " \t") != "----"; i++ {
+				listing = append(listing, template.HTMLEscapeString(lines[i]))
+			}
+			b.WriteString("<pre><code>" + strings.Join(listing, "\n") + "</code></pre>\n")
+		case strings.TrimSpace(line) == "":
+			closeParagraph()
+			closeList()
+		case strings.HasPrefix(line, "="):
+			level := len(line) - len(strings.TrimLeft(line, "="))
+			if level > 6 || len(line) == level || line[level] != ' ' {
+				paragraph = append(paragraph, line)
+				continue
+			}
+			closeParagraph()
+			closeList()
+			tag := "h" + string(rune('0'+level))
+			b.WriteString("<" + tag + ">" + asciiDocText(strings.TrimSpace(line[level:])) + "</" + tag + ">\n")
+		case strings.HasPrefix(line, "* ") || strings.HasPrefix(line, "- "):
+			closeParagraph()
+			openList("ul")
+			b.WriteString("<li>" + asciiDocText(strings.TrimSpace(line[2:])) + "</li>\n")
+		case strings.HasPrefix(line, ". "):
+			closeParagraph()
+			openList("ol")
+			b.WriteString("<li>" + asciiDocText(strings.TrimSpace(line[2:])) + "</li>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, strings.TrimSpace(line))
+		}
+	}
+	closeParagraph()
+	closeList()
+
+	return sanitizer.Sanitize(b.String())
+}
+
+// asciiDocText escapes text and applies AsciiDoc inline formatting.
+func asciiDocText(text string) string {
+	text = template.HTMLEscapeString(text)
+	for _, i := range asciiDocInline {
+		text = i.pattern.ReplaceAllString(text, i.replace)
+	}
+	return text
+}
@@ -0,0 +1,62 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name   string
+		format string
+		text   string
+		html   string
+	}{
+		{"markdown", FormatMarkdown, "Some *text*", "<p>Some <em>text</em></p>\n"},
+		{"unknown format", "unknown", "Some *text*", "<p>Some <em>text</em></p>\n"},
+		{"html", FormatHTML, `<p onclick="x()">Hi <b>there</b></p><script>alert(1)</script>`, "<p>Hi <b>there</b></p>"},
+		{"text", FormatText, "Line one\nLine <two>\n\n\nSecond *para*", "<p>Line one<br>\nLine &lt;two&gt;</p>\n<p>Second *para*</p>\n"},
+		{"asciidoc heading", FormatAsciiDoc, "== Section\n\nA *bold* and _italic_ `code` word.", "<h2>Section</h2>\n<p>A <strong>bold</strong> and <em>italic</em> <code>code</code> word.</p>\n"},
+		{"asciidoc lists", FormatAsciiDoc, "* one\n* two\n\n. first", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<ol>\n<li>first</li>\n</ol>\n"},
+		{"asciidoc listing", FormatAsciiDoc, "----\nif a < b {\n----", "<pre><code>if a &lt; b {</code></pre>\n"},
+		{"asciidoc link", FormatAsciiDoc, "See https://example.com[the site].", "<p>See <a href=\"https://example.com\" rel=\"nofollow\">the site</a>.</p>\n"},
+		{"asciidoc unsafe link", FormatAsciiDoc, "javascript:alert(1)[x]", "<p>javascript:alert(1)[x]</p>\n"},
+	}
+
+	for _, c := range cases {
+		if html := Render(c.format, c.text); html != c.html {
+			t.Errorf("%s: Render() returned %q, expected %q", c.name, html, c.html)
+		}
+	}
+}
+
+func TestRegisterRenderer(t *testing.T) {
+	RegisterRenderer("shout", RendererFunc(func(text string) string {
+		return "<p>" + strings.ToUpper(text) + "</p>"
+	}))
+	defer func() {
+		renderersLock.Lock()
+		delete(renderers, "shout")
+		renderersLock.Unlock()
+	}()
+
+	found := false
+	for _, f := range Formats() {
+		if f == "shout" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Formats() should include registered format, returned %v", Formats())
+	}
+
+	e := &GaeEntry{}
+	e.SetText("hello")
+	if e.Format() != FormatMarkdown || e.Html() != "<p>hello</p>\n" {
+		t.Fatalf("Entries should default to markdown, returned %q", e.Html())
+	}
+	e.SetFormat("shout")
+	if e.Html() != "<p>HELLO</p>" {
+		t.Fatalf("Html() should render with the entry format, returned %q", e.Html())
+	}
+}
@@ -2,24 +2,20 @@ package blog
 
 import (
 	"context"
-	"errors"
-	"sort"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/datastore"
-	"github.com/bluele/gcache"
 	"gitlab.com/montebo/security"
 	"google.golang.org/api/iterator"
 )
 
 func NewGaeBlogManager(client *datastore.Client, ctx context.Context, am security.AccessManager) *GaeBlogManager {
 	s := &GaeBlogManager{
-		client:     client,
-		ctx:        ctx,
-		am:         am,
-		entryCache: gcache.New(200).LRU().Expiration(time.Second * 3600).Build(),
-		slugCache:  gcache.New(200).LRU().Expiration(time.Second * 3600).Build(),
+		client: client,
+		ctx:    ctx,
+		am:     am,
+		cache:  NewMemoryCache(CacheOptions{}),
 	}
 
 	activateBlogPlugin(am)
@@ -28,11 +24,17 @@ func NewGaeBlogManager(client *datastore.Client, ctx context.Context, am securit
 }
 
 type GaeBlogManager struct {
-	client     *datastore.Client
-	ctx        context.Context
-	am         security.AccessManager
-	entryCache gcache.Cache
-	slugCache  gcache.Cache
+	client *datastore.Client
+	ctx    context.Context
+	am     security.AccessManager
+	cache  Cache
+}
+
+// SetCache replaces the cache used by GetEntryCached and
+// GetEntryBySlugCached, which holds 200 entries in process memory for an
+// hour by default. It must be called before the manager is used.
+func (em *GaeBlogManager) SetCache(cache Cache) {
+	em.cache = cache
 }
 
 func (em *GaeBlogManager) NewEntry() Entry {
@@ -43,16 +45,23 @@ func (em *GaeBlogManager) AccessManager() security.AccessManager {
 	return em.am
 }
 
-func (em *GaeBlogManager) GetEntry(uuid string, session security.Session) (Entry, error) {
+func (em *GaeBlogManager) GetEntryContext(ctx context.Context, uuid string, session security.Session) (Entry, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
 	item := new(GaeEntry)
 	k := datastore.NameKey("Entry", uuid, nil)
 	k.Namespace = session.Site()
-	err := em.client.Get(em.ctx, k, item)
+	err := em.client.Get(ctx, k, item)
 	if err == datastore.ErrNoSuchEntity {
-		return nil, nil
+		return nil, ErrNotFound
 	} else if err != nil {
 		return nil, err
 	}
+	if err := checkVisible(ctx, item, session); err != nil {
+		return nil, err
+	}
 	if item.authorUuid != "" {
 		item.author, err = em.am.GetPersonCached(item.authorUuid, session)
 		if err != nil {
@@ -62,12 +71,17 @@ func (em *GaeBlogManager) GetEntry(uuid string, session security.Session) (Entry
 	return item, nil
 }
 
-func (em *GaeBlogManager) GetEntries(session security.Session) ([]Entry, error) {
+func (em *GaeBlogManager) GetEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
 	var items []Entry
 	var err error
+	now := time.Now()
 
 	q := datastore.NewQuery("Entry").Namespace(session.Site()).Limit(2000)
-	it := em.client.Run(em.ctx, q)
+	it := em.client.Run(ctx, q)
 	for {
 		e := new(GaeEntry)
 		if _, err := it.Next(e); err == iterator.Done {
@@ -75,6 +89,9 @@ func (em *GaeBlogManager) GetEntries(session security.Session) ([]Entry, error)
 		} else if err != nil {
 			return nil, err
 		}
+		if !canSee(ctx, e, session, now) {
+			continue
+		}
 		if e.authorUuid != "" {
 			e.author, err = em.am.GetPersonCached(e.authorUuid, session)
 			if err != nil {
@@ -84,35 +101,34 @@ func (em *GaeBlogManager) GetEntries(session security.Session) ([]Entry, error)
 		items = append(items, e)
 	}
 
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date() != nil && items[j].Date() != nil {
-			return items[j].Date().Before(*items[i].Date())
-		}
-		if items[j].Date() != nil && items[i].Created() != nil {
-			return items[j].Date().Before(*items[i].Created())
-		}
-		if items[i].Date() != nil && items[j].Created() != nil {
-			return items[j].Created().Before(*items[i].Date())
-		}
-		return items[j].Created().Before(*items[i].Created())
-	})
+	sortEntries(items)
 
 	return items[:], nil
 }
 
-func (em *GaeBlogManager) GetRecentEntries(limit int, session security.Session) ([]Entry, error) {
+func (em *GaeBlogManager) GetRecentEntriesContext(ctx context.Context, limit int, session security.Session) ([]Entry, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
 	var items []Entry
 	var err error
+	now := time.Now()
 
-	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("Date <", time.Now()).Limit(limit)
-	it := em.client.Run(em.ctx, q)
-	for {
+	// Hidden entries are skipped, so read until the limit is reached
+	// rather than limiting the query.
+	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("Date <", now).Order("-Date")
+	it := em.client.Run(ctx, q)
+	for len(items) < limit {
 		e := new(GaeEntry)
 		if _, err := it.Next(e); err == iterator.Done {
 			break
 		} else if err != nil {
 			return nil, err
 		}
+		if !canSee(ctx, e, session, now) {
+			continue
+		}
 		if e.authorUuid != "" {
 			e.author, err = em.am.GetPersonCached(e.authorUuid, session)
 			if err != nil {
@@ -122,18 +138,7 @@ func (em *GaeBlogManager) GetRecentEntries(limit int, session security.Session)
 		items = append(items, e)
 	}
 
-	sort.Slice(items, func(i, j int) bool {
-		if items[i].Date() != nil && items[j].Date() != nil {
-			return items[j].Date().Before(*items[i].Date())
-		}
-		if items[j].Date() != nil && items[i].Created() != nil {
-			return items[j].Date().Before(*items[i].Created())
-		}
-		if items[i].Date() != nil && items[j].Created() != nil {
-			return items[j].Created().Before(*items[i].Date())
-		}
-		return items[j].Created().Before(*items[i].Created())
-	})
+	sortEntries(items)
 
 	if len(items) > limit {
 		return items[0:limit], nil
@@ -141,12 +146,17 @@ func (em *GaeBlogManager) GetRecentEntries(limit int, session security.Session)
 	return items[:], nil
 }
 
-func (em *GaeBlogManager) GetFutureEntries(session security.Session) ([]Entry, error) {
+func (em *GaeBlogManager) GetFutureEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
 	var items []Entry
 	var err error
+	now := time.Now()
 
-	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("Date >", time.Now())
-	it := em.client.Run(em.ctx, q)
+	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("Date >", now)
+	it := em.client.Run(ctx, q)
 	for {
 		e := new(GaeEntry)
 		if _, err := it.Next(e); err == iterator.Done {
@@ -154,6 +164,9 @@ func (em *GaeBlogManager) GetFutureEntries(session security.Session) ([]Entry, e
 		} else if err != nil {
 			return nil, err
 		}
+		if !canSee(ctx, e, session, now) {
+			continue
+		}
 		if e.authorUuid != "" {
 			e.author, err = em.am.GetPersonCached(e.authorUuid, session)
 			if err != nil {
@@ -163,20 +176,29 @@ func (em *GaeBlogManager) GetFutureEntries(session security.Session) ([]Entry, e
 		items = append(items, e)
 	}
 
+	sortEntries(items)
+
 	return items[:], nil
 }
 
-func (em *GaeBlogManager) GetEntryBySlug(slug string, session security.Session) (Entry, error) {
+func (em *GaeBlogManager) GetEntryBySlugContext(ctx context.Context, slug string, session security.Session) (Entry, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
 	var items []GaeEntry
 	var err error
 
 	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("Slug =", slug).Limit(1)
-	_, err = em.client.GetAll(em.ctx, q, &items)
+	_, err = em.client.GetAll(ctx, q, &items)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(items) > 0 {
+		if err := checkVisible(ctx, &items[0], session); err != nil {
+			return nil, err
+		}
 		if items[0].authorUuid != "" {
 			items[0].author, err = em.am.GetPersonCached(items[0].authorUuid, session)
 			if err != nil {
@@ -185,67 +207,89 @@ func (em *GaeBlogManager) GetEntryBySlug(slug string, session security.Session)
 		}
 		return &items[0], nil
 	}
-	return nil, nil
+	return nil, ErrNotFound
 }
 
-func (em *GaeBlogManager) GetEntryCached(uuid string, session security.Session) (Entry, error) {
+func (em *GaeBlogManager) GetEntryCachedContext(ctx context.Context, uuid string, session security.Session) (Entry, error) {
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
 
 	if uuid == "" {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 
-	v, _ := em.entryCache.Get(uuid)
-	if v != nil {
-		entry := v.(Entry)
+	entry, ok, err := cachedEntry(ctx, em.cache, entryCacheKey(session.Site(), uuid), em.am, session)
+	if err != nil {
+		return nil, err
+	} else if ok {
+		if err := checkVisible(ctx, entry, session); err != nil {
+			return nil, err
+		}
 		return entry, nil
 	}
 
-	entry, err := em.GetEntry(uuid, session)
+	entry, err = em.GetEntryContext(ctx, uuid, session)
 	if err != nil {
 		return nil, err
 	}
-	em.entryCache.Set(entry.Uuid(), entry)
-	em.slugCache.Set(entry.Slug(), entry)
+	cacheEntry(ctx, em.cache, session.Site(), entry)
 
 	return entry, nil
 }
 
-func (em *GaeBlogManager) GetEntryBySlugCached(slug string, session security.Session) (Entry, error) {
+func (em *GaeBlogManager) GetEntryBySlugCachedContext(ctx context.Context, slug string, session security.Session) (Entry, error) {
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
 
 	if slug == "" {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 
-	v, _ := em.slugCache.Get(slug)
-	if v != nil {
-		entry := v.(Entry)
+	entry, ok, err := cachedEntry(ctx, em.cache, slugCacheKey(session.Site(), slug), em.am, session)
+	if err != nil {
+		return nil, err
+	} else if ok {
+		if err := checkVisible(ctx, entry, session); err != nil {
+			return nil, err
+		}
 		return entry, nil
 	}
 
-	entry, err := em.GetEntryBySlug(slug, session)
+	entry, err = em.GetEntryBySlugContext(ctx, slug, session)
 	if err != nil {
 		return nil, err
 	}
-	if entry == nil {
-		return nil, nil
-	}
-	em.entryCache.Set(entry.Uuid(), entry)
-	em.slugCache.Set(entry.Slug(), entry)
+	cacheEntry(ctx, em.cache, session.Site(), entry)
 
 	return entry, nil
 }
 
-func (em *GaeBlogManager) AddEntry(entry Entry, session security.Session) error {
+func (em *GaeBlogManager) AddEntryContext(ctx context.Context, entry Entry, session security.Session) error {
 	if session == nil || !session.IsAuthenticated() {
 		return &security.ErrUnauthenticated{session}
 	}
+	if err := checkAuthor(entry.AuthorUUID(), session); err != nil {
+		return err
+	}
 
-	if entry.Title() == "" {
-		return errors.New("Entry must have a title")
+	if err := validateEntry(entry); err != nil {
+		return err
 	}
-	if entry.Text() == "" {
-		return errors.New("Entry must contain text")
+	if err := checkTransition("", entry.Status(), entry.Date(), session); err != nil {
+		return err
+	}
+
+	slug, err := uniqueSlug(entry.Slug(), entry.explicitSlug(), func(slug string) (bool, error) {
+		return em.reserveSlug(ctx, session.Site(), slug, entry.Uuid())
+	})
+	if err != nil {
+		return err
 	}
+	entry.setSlug(slug)
 
 	bulk := &security.GaeEntityAuditLogCollection{}
 	bulk.SetEntityUuidPersonUuid(entry.Uuid(), session.PersonUuid(), session.DisplayName())
@@ -278,56 +322,116 @@ func (em *GaeBlogManager) AddEntry(entry Entry, session security.Session) error
 		bulk.AddItem("Text", "", entry.Text())
 	}
 
+	if entry.Format() != FormatMarkdown {
+		bulk.AddItem("Format", "", entry.Format())
+	}
+
+	if entry.Language() != "" {
+		bulk.AddItem("Language", "", entry.Language())
+	}
+
+	if len(entry.Tags()) > 0 {
+		bulk.AddItem("Tags", "", strings.Join(entry.Tags(), ", "))
+	}
+
 	if entry.Author() != nil {
 		bulk.AddItem("Author", "", entry.Author().Uuid())
 	}
 
+	if entry.Deleted() {
+		bulk.AddBoolItem("Deleted", false, true)
+	}
+
+	if entry.Status() != StatusDraft {
+		bulk.AddItem("Status", "", entry.Status())
+	}
+
+	now := time.Now()
+	entry.setCreated(now)
+	entry.setUpdated(now)
+	if entry.Deleted() {
+		entry.setDeletedAt(&now)
+	} else {
+		entry.setDeletedAt(nil)
+	}
+
 	k := datastore.NameKey("Entry", entry.Uuid(), nil)
 	k.Namespace = session.Site()
 
 	// TODO: Technically should be in a transaction
 	if err := em.am.AddEntityChangeLog(bulk, session); err != nil {
+		em.releaseSlug(session.Site(), slug, entry.Uuid())
 		return err
 	}
-	if _, err := em.client.Put(em.ctx, k, entry.(*GaeEntry)); err != nil {
+	keys := []*datastore.Key{k, revisionKey(k, 1)}
+	items := []interface{}{entry.(*GaeEntry), newGaeRevision(1, entry, session)}
+	_, err = em.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		if _, err := tx.PutMulti(keys, items); err != nil {
+			return err
+		}
+		return countSearchDocuments(tx, session.Site(), 1)
+	})
+	if err != nil {
+		em.releaseSlug(session.Site(), slug, entry.Uuid())
+		return err
+	}
+	if err := em.updateSearchIndex(ctx, k, nil, entry); err != nil {
 		return err
 	}
 
-	em.entryCache.Set(entry.Uuid(), entry)
-	em.slugCache.Set(entry.Slug(), entry)
+	cacheEntry(ctx, em.cache, session.Site(), entry)
 
 	return nil
 }
 
-func (em *GaeBlogManager) UpdateEntry(entry Entry, session security.Session) error {
+func (em *GaeBlogManager) UpdateEntryContext(ctx context.Context, entry Entry, session security.Session) error {
 	if session == nil || !session.IsAuthenticated() {
 		return &security.ErrUnauthenticated{session}
 	}
 
-	if entry.Title() == "" {
-		return errors.New("Entry must have a title")
-	}
-	if entry.Text() == "" {
-		return errors.New("Entry must contain text")
+	if err := validateUpdate(ctx, entry); err != nil {
+		return err
 	}
 
 	k := datastore.NameKey("Entry", entry.Uuid(), nil)
 	k.Namespace = session.Site()
 
 	current := new(GaeEntry)
-	err := em.client.Get(em.ctx, k, current)
+	err := em.client.Get(ctx, k, current)
 	if err == datastore.ErrNoSuchEntity {
-		return errors.New("No entry has this uuid")
+		return ErrNotFound
 	} else if err != nil {
 		return err
 	}
+	if err := checkAuthor(current.AuthorUUID(), session); err != nil {
+		return err
+	}
+	if err := checkAuthor(entry.AuthorUUID(), session); err != nil {
+		return err
+	}
+	indexed := *current
 
 	bulk := &security.GaeEntityAuditLogCollection{}
 	bulk.SetEntityUuidPersonUuid(entry.Uuid(), session.PersonUuid(), session.DisplayName())
 
+	// A new date can publish a scheduled entry, so the status is compared
+	// as it was before any change.
+	status := current.Status()
 	if !security.MatchingDate(entry.Date(), current.Date()) {
 		bulk.AddDateItem("Date", current.Date(), entry.Date())
-		current.SetDate(*entry.Date())
+		if entry.Date() == nil {
+			current.date = nil
+		} else {
+			current.SetDate(*entry.Date())
+		}
+	}
+
+	if entry.Status() != status {
+		if err := checkTransition(status, entry.Status(), current.Date(), session); err != nil {
+			return err
+		}
+		bulk.AddItem("Status", status, entry.Status())
+		current.SetStatus(entry.Status())
 	}
 
 	if entry.Title() != current.Title() {
@@ -355,31 +459,119 @@ func (em *GaeBlogManager) UpdateEntry(entry Entry, session security.Session) err
 		current.SetText(entry.Text())
 	}
 
+	if entry.Format() != current.Format() {
+		bulk.AddItem("Format", current.Format(), entry.Format())
+		current.SetFormat(entry.Format())
+	}
+
+	if entry.Language() != current.Language() {
+		bulk.AddItem("Language", current.Language(), entry.Language())
+		current.SetLanguage(entry.Language())
+	}
+
 	if strings.Join(entry.Tags(), "|") != strings.Join(current.Tags(), "|") {
 		bulk.AddItem("Tags", strings.Join(current.Tags(), ", "), strings.Join(entry.Tags(), ", "))
 		current.SetTags(entry.Tags())
 	}
 
+	if entry.AuthorUUID() != current.AuthorUUID() {
+		bulk.AddItem("Author", current.AuthorUUID(), entry.AuthorUUID())
+		current.authorUuid = entry.AuthorUUID()
+		current.author = entry.Author()
+	}
+
+	wasDeleted := current.Deleted()
+	if entry.Deleted() != current.Deleted() {
+		bulk.AddBoolItem("Deleted", current.Deleted(), entry.Deleted())
+		current.SetDeleted(entry.Deleted())
+	}
+
+	// The new slug is claimed last, so it only needs releasing again if
+	// saving the entry fails.
+	previous := current.Slug()
+	release := func() {}
+	if entry.Slug() != current.Slug() {
+		slug, err := uniqueSlug(entry.Slug(), entry.explicitSlug(), func(slug string) (bool, error) {
+			return em.reserveSlug(ctx, session.Site(), slug, current.Uuid())
+		})
+		if err != nil {
+			return err
+		}
+		bulk.AddItem("Slug", current.Slug(), slug)
+		current.slug = slug
+		entry.setSlug(slug)
+		release = func() {
+			em.releaseSlug(session.Site(), slug, current.Uuid())
+		}
+	}
+
 	if bulk.HasUpdates() {
 		if err := em.am.AddEntityChangeLog(bulk, session); err != nil {
+			release()
 			return err
 		}
 
-		em.entryCache.Remove(entry.Uuid())
-		em.slugCache.Remove(entry.Slug())
-		if _, err := em.client.Put(em.ctx, k, current); err != nil {
+		revision, err := em.latestRevision(ctx, k)
+		if err != nil {
+			release()
 			return err
 		}
-		em.entryCache.Set(entry.Uuid(), entry)
-		em.slugCache.Set(entry.Slug(), entry)
+
+		now := time.Now()
+		current.updated = &now
+		if current.deleted != wasDeleted {
+			if current.deleted {
+				current.deletedAt = &now
+			} else {
+				current.deletedAt = nil
+			}
+		}
+		entry.setDeletedAt(current.deletedAt)
+
+		keys := []*datastore.Key{k, revisionKey(k, revision+1)}
+		items := []interface{}{current, newGaeRevision(revision+1, current, session)}
+		if current.Slug() != previous && previous != "" {
+			keys = append(keys, slugHistoryKey(session.Site(), previous))
+			items = append(items, &gaeSlugHistory{Uuid: current.Uuid(), Moved: now})
+		}
+		if _, err := em.client.PutMulti(ctx, keys, items); err != nil {
+			release()
+			return err
+		}
+		if current.Slug() != previous {
+			if err := em.releaseSlug(session.Site(), previous, current.Uuid()); err != nil {
+				return err
+			}
+		}
+		if err := em.updateSearchIndex(ctx, k, &indexed, current); err != nil {
+			return err
+		}
+		// Cached copies are reloaded with their author on next access
+		uncacheEntry(em.ctx, em.cache, session.Site(), current.Uuid(), previous, current.Slug())
 	}
 
 	return nil
 }
 
-func (em *GaeBlogManager) DeleteEntry(uuid string, session security.Session) error {
+// DeleteEntryContext moves a blog entry to the trash.
+func (em *GaeBlogManager) DeleteEntryContext(ctx context.Context, uuid string, session security.Session) error {
+	return trashEntry(ctx, em, uuid, true, session, em.storedEntry(ctx, session))
+}
+
+// RestoreEntryContext moves a blog entry out of the trash.
+func (em *GaeBlogManager) RestoreEntryContext(ctx context.Context, uuid string, session security.Session) error {
+	return trashEntry(ctx, em, uuid, false, session, em.storedEntry(ctx, session))
+}
+
+func (em *GaeBlogManager) GetDeletedEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
+	return deletedEntries(ctx, em, session)
+}
+
+// PurgeEntryContext removes a deleted blog entry and its revisions from
+// the datastore. Entity change history is retained by the access manager.
+func (em *GaeBlogManager) PurgeEntryContext(ctx context.Context, uuid string, session security.Session) error {
 	if uuid == "" {
-		return errors.New("Cannot delete entry without a uuid")
+		return ErrNotFound
 	}
 	if session == nil || !session.IsAuthenticated() {
 		return &security.ErrUnauthenticated{session}
@@ -387,95 +579,247 @@ func (em *GaeBlogManager) DeleteEntry(uuid string, session security.Session) err
 	k := datastore.NameKey("Entry", uuid, nil)
 	k.Namespace = session.Site()
 	var current GaeEntry
-	err := em.client.Get(em.ctx, k, &current)
+	err := em.client.Get(ctx, k, &current)
 	if err == datastore.ErrNoSuchEntity {
-		return errors.New("No entry has this uuid")
+		return ErrNotFound
 	} else if err != nil {
 		return err
 	}
+	if err := checkPurge(&current, session); err != nil {
+		return err
+	}
 
-	em.entryCache.Remove(current.Uuid())
-	em.slugCache.Remove(current.Slug())
+	q := datastore.NewQuery("EntryRevision").Namespace(session.Site()).Ancestor(k).KeysOnly()
+	keys, err := em.client.GetAll(ctx, q, nil)
+	if err != nil {
+		return err
+	}
+	if err := em.client.DeleteMulti(ctx, keys); err != nil {
+		return err
+	}
+	_, err = em.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		if err := tx.Delete(k); err != nil {
+			return err
+		}
+		return countSearchDocuments(tx, session.Site(), -1)
+	})
+	if err != nil {
+		return err
+	}
+	if err := em.releaseSlug(session.Site(), current.Slug(), uuid); err != nil {
+		return err
+	}
+	if err := em.updateSearchIndex(ctx, k, &current, nil); err != nil {
+		return err
+	}
+
+	uncacheEntry(em.ctx, em.cache, session.Site(), current.Uuid(), current.Slug())
 
 	return nil
 }
 
-func (em *GaeBlogManager) GetEntriesByAuthor(personUuid string, session security.Session) ([]Entry, error) {
-	items := make([]Entry, 0)
+// storedEntry returns a function that reads an entry on the session site
+// whether or not the session may see it.
+func (em *GaeBlogManager) storedEntry(ctx context.Context, session security.Session) func(uuid string) (Entry, error) {
+	return func(uuid string) (Entry, error) {
+		k := datastore.NameKey("Entry", uuid, nil)
+		k.Namespace = session.Site()
+		entry := new(GaeEntry)
+		err := em.client.Get(ctx, k, entry)
+		if err == datastore.ErrNoSuchEntity {
+			return nil, ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		return entry, nil
+	}
+}
 
-	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("Author =", personUuid).Limit(5000)
-	_, err := em.client.GetAll(em.ctx, q, &items)
+// ListEntriesContext returns a page of entries, most recent first, and the
+// cursor of the next page. The cursor is empty when there are no more
+// entries. Entries without a date are ordered by the time they were
+// created, and are only listed when no date range is given. Entries saved
+// before they were given a list time are not listed until BackfillListTime
+// is run.
+func (em *GaeBlogManager) ListEntriesContext(ctx context.Context, options ListOptions, session security.Session) ([]Entry, string, error) {
+	if session == nil {
+		return nil, "", ErrInvalidSession
+	}
+
+	limit := options.limit()
+	q := datastore.NewQuery("Entry").Namespace(session.Site())
+	if options.Author != "" {
+		q = q.Filter("Author =", options.Author)
+	}
+	if tag := options.tag(); tag != "" {
+		q = q.Filter("SearchTags =", "tag:"+tag)
+	}
+	if options.Before == nil && options.After == nil {
+		q = q.Order("-ListTime")
+	} else {
+		if options.Before != nil {
+			q = q.Filter("Date <", *options.Before)
+		}
+		if options.After != nil {
+			q = q.Filter("Date >", *options.After)
+		}
+		q = q.Order("-Date")
+	}
+	if options.Cursor != "" {
+		cursor, err := datastore.DecodeCursor(options.Cursor)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		q = q.Start(cursor)
+	}
+
+	// Hidden entries are skipped, so read until the page is full rather
+	// than limiting the query. The cursor then follows the last entry on
+	// the page.
+	var items []Entry
+	var err error
+	now := time.Now()
+	it := em.client.Run(ctx, q)
+	for len(items) < limit {
+		e := new(GaeEntry)
+		if _, err := it.Next(e); err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, "", err
+		}
+		if !canSee(ctx, e, session, now) {
+			continue
+		}
+		if e.authorUuid != "" {
+			e.author, err = em.am.GetPersonCached(e.authorUuid, session)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		items = append(items, e)
+	}
+
+	if len(items) < limit {
+		return items, "", nil
+	}
+	cursor, err := it.Cursor()
+	if err != nil {
+		return nil, "", err
+	}
+	return items, cursor.String(), nil
+}
+
+// BackfillListTime saves every entry on a site again, so that entries
+// saved before they were given a list time are listed by ListEntries. It
+// may be run again at any time.
+func (em *GaeBlogManager) BackfillListTime(ctx context.Context, site string) error {
+	var entries []*GaeEntry
+	keys, err := em.client.GetAll(ctx, datastore.NewQuery("Entry").Namespace(site), &entries)
+	if err != nil {
+		return err
+	}
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > gaeBatchSize {
+			n = gaeBatchSize
+		}
+		if _, err := em.client.PutMulti(ctx, keys[:n], entries[:n]); err != nil {
+			return err
+		}
+		keys, entries = keys[n:], entries[n:]
+	}
+	return nil
+}
+
+// GetEntriesByStatusContext returns all entries currently in a workflow
+// state, most recent first.
+func (em *GaeBlogManager) GetEntriesByStatusContext(ctx context.Context, status string, session security.Session) ([]Entry, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	// Scheduled entries change status when their date passes, so the
+	// status is checked after loading rather than in the query.
+	items, err := em.GetEntriesContext(ctx, session)
 	if err != nil {
 		return nil, err
 	}
 
-	return items[:], nil
+	return withStatus(items, status), nil
 }
 
-func (em *GaeBlogManager) SearchEntries(query string, session security.Session) ([]Entry, error) {
-	var err error
-	results := make([]Entry, 0)
+func (em *GaeBlogManager) GetEntriesByAuthorContext(ctx context.Context, personUuid string, session security.Session) ([]Entry, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
 
-	fields := strings.Fields(strings.ToLower(query))
-	sort.Slice(fields, func(i, j int) bool {
-		return len(fields[j]) < len(fields[i])
-	})
+	var items []Entry
+	var err error
+	now := time.Now()
 
-	if len(fields) == 0 {
-		return results, nil
-	} else if len(fields) == 1 {
-		q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("SearchTags =", fields[0]).Limit(50)
-		it := em.client.Run(em.ctx, q)
-		for {
-			e := new(GaeEntry)
-			if _, err := it.Next(e); err == iterator.Done {
-				break
-			} else if err != nil {
-				return nil, err
-			}
-			if e.authorUuid != "" {
-				e.author, err = em.am.GetPersonCached(e.authorUuid, session)
-				if err != nil {
-					return nil, err
-				}
-			}
-			results = append(results, e)
-		}
-	} else if len(fields) > 1 {
-		q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("SearchTags =", fields[0]).Filter("SearchTags =", fields[1]).Limit(50)
-		it := em.client.Run(em.ctx, q)
-		for {
-			e := new(GaeEntry)
-			if _, err := it.Next(e); err == iterator.Done {
-				break
-			} else if err != nil {
+	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("Author =", personUuid).Limit(5000)
+	it := em.client.Run(ctx, q)
+	for {
+		e := new(GaeEntry)
+		if _, err := it.Next(e); err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !canSee(ctx, e, session, now) {
+			continue
+		}
+		if e.authorUuid != "" {
+			e.author, err = em.am.GetPersonCached(e.authorUuid, session)
+			if err != nil {
 				return nil, err
 			}
-			if e.authorUuid != "" {
-				e.author, err = em.am.GetPersonCached(e.authorUuid, session)
-				if err != nil {
-					return nil, err
-				}
-			}
-			results = append(results, e)
 		}
+		items = append(items, e)
 	}
 
-	return results, nil
+	sortEntries(items)
+
+	return items[:], nil
 }
 
-func (em *GaeBlogManager) GetEntriesByTag(tag string, limit int, session security.Session) ([]Entry, error) {
+// SearchEntriesContext returns every entry matching a search query, most
+// relevant first.
+func (em *GaeBlogManager) SearchEntriesContext(ctx context.Context, query string, session security.Session) ([]Entry, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	return searchAll(ctx, &gaeSearchIndex{em, ctx, session}, query, session)
+}
 
-	tag = strings.ToLower(strings.TrimSpace(tag))
+// SearchContext returns a page of the entries matching a search query,
+// most relevant first.
+func (em *GaeBlogManager) SearchContext(ctx context.Context, query string, options SearchOptions, session security.Session) (*SearchResults, error) {
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	return search(ctx, &gaeSearchIndex{em, ctx, session}, query, options, session)
+}
+
+func (em *GaeBlogManager) GetEntriesByTagContext(ctx context.Context, tag string, limit int, session security.Session) ([]Entry, error) {
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	tag = tagKey(tag)
 	if tag == "" {
 		return nil, nil
 	}
 
 	var err error
 	results := make([]Entry, 0)
+	now := time.Now()
 
-	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("SearchTags =", "tag:"+tag).Limit(limit)
-	it := em.client.Run(em.ctx, q)
+	q := datastore.NewQuery("Entry").Namespace(session.Site()).Filter("SearchTags =", "tag:"+tag).Limit(2000)
+	it := em.client.Run(ctx, q)
 	for {
 		e := new(GaeEntry)
 		if _, err := it.Next(e); err == iterator.Done {
@@ -483,6 +827,9 @@ func (em *GaeBlogManager) GetEntriesByTag(tag string, limit int, session securit
 		} else if err != nil {
 			return nil, err
 		}
+		if e.date == nil || !e.date.Before(now) || !canSee(ctx, e, session, now) {
+			continue
+		}
 		if e.authorUuid != "" {
 			e.author, err = em.am.GetPersonCached(e.authorUuid, session)
 			if err != nil {
@@ -492,5 +839,355 @@ func (em *GaeBlogManager) GetEntriesByTag(tag string, limit int, session securit
 		results = append(results, e)
 	}
 
+	sortEntries(results)
+
+	if len(results) > limit {
+		return results[0:limit], nil
+	}
 	return results, nil
 }
+
+// gaeEntrySlug is an EntrySlug entity, keyed by slug, recording which entry
+// owns a slug on a site. Slugs are claimed in a transaction before an entry
+// is written, so two entries can never be saved with the same slug.
+type gaeEntrySlug struct {
+	Uuid string
+}
+
+func slugKey(site, slug string) *datastore.Key {
+	k := datastore.NameKey("EntrySlug", slug, nil)
+	k.Namespace = site
+	return k
+}
+
+// gaeSlugHistory is an EntrySlugHistory entity, keyed by slug, recording
+// the entry that most recently gave up a slug, so that links using a
+// previous slug can be redirected.
+type gaeSlugHistory struct {
+	Uuid  string
+	Moved time.Time
+}
+
+func slugHistoryKey(site, slug string) *datastore.Key {
+	k := datastore.NameKey("EntrySlugHistory", slug, nil)
+	k.Namespace = site
+	return k
+}
+
+func (em *GaeBlogManager) ResolveSlugContext(ctx context.Context, slug string, session security.Session) (Entry, string, error) {
+	return resolveSlug(ctx, em, slug, session, func(slug string) (string, error) {
+		var history gaeSlugHistory
+		err := em.client.Get(ctx, slugHistoryKey(session.Site(), slug), &history)
+		if err == datastore.ErrNoSuchEntity {
+			return "", nil
+		}
+		return history.Uuid, err
+	})
+}
+
+// reserveSlug claims a slug for an entry, returning false if another entry
+// already has it. Entries saved before slugs were claimed are found with a
+// query, as they have no EntrySlug entity.
+func (em *GaeBlogManager) reserveSlug(ctx context.Context, site, slug, uuid string) (bool, error) {
+	q := datastore.NewQuery("Entry").Namespace(site).Filter("Slug =", slug).KeysOnly().Limit(2)
+	keys, err := em.client.GetAll(ctx, q, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, k := range keys {
+		if k.Name != uuid {
+			return false, nil
+		}
+	}
+
+	reserved := false
+	_, err = em.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var owner gaeEntrySlug
+		err := tx.Get(slugKey(site, slug), &owner)
+		if err == datastore.ErrNoSuchEntity {
+			_, err = tx.Put(slugKey(site, slug), &gaeEntrySlug{Uuid: uuid})
+			reserved = err == nil
+			return err
+		} else if err != nil {
+			return err
+		}
+		reserved = owner.Uuid == uuid
+		return nil
+	})
+	return reserved, err
+}
+
+// releaseSlug gives up the claim an entry has on a slug. It uses the
+// context given to NewGaeBlogManager, as a cancelled request must not leave
+// the slug claimed.
+func (em *GaeBlogManager) releaseSlug(site, slug, uuid string) error {
+	_, err := em.client.RunInTransaction(em.ctx, func(tx *datastore.Transaction) error {
+		var owner gaeEntrySlug
+		err := tx.Get(slugKey(site, slug), &owner)
+		if err == datastore.ErrNoSuchEntity {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if owner.Uuid != uuid {
+			return nil
+		}
+		return tx.Delete(slugKey(site, slug))
+	})
+	return err
+}
+
+// gaeRevision stores a snapshot of an entry as an EntryRevision entity,
+// keyed by revision number under the entry it belongs to.
+type gaeRevision struct {
+	number     int
+	entry      GaeEntry
+	person     string
+	personName string
+	created    time.Time
+}
+
+func revisionKey(k *datastore.Key, number int) *datastore.Key {
+	rk := datastore.IDKey("EntryRevision", int64(number), k)
+	rk.Namespace = k.Namespace
+	return rk
+}
+
+func newGaeRevision(number int, entry Entry, session security.Session) *gaeRevision {
+	return &gaeRevision{
+		number:     number,
+		entry:      *snapshot(entry),
+		person:     session.PersonUuid(),
+		personName: session.DisplayName(),
+		created:    *entry.Updated(),
+	}
+}
+
+func (r *gaeRevision) LoadKey(k *datastore.Key) error {
+	if k != nil {
+		r.number = int(k.ID)
+		if k.Parent != nil {
+			r.entry.uuid = k.Parent.Name
+		}
+	}
+	return nil
+}
+
+func (r *gaeRevision) Load(ps []datastore.Property) error {
+	for _, i := range ps {
+		switch i.Name {
+		case "Person":
+			r.person = i.Value.(string)
+		case "PersonName":
+			r.personName = i.Value.(string)
+		case "RevisionCreated":
+			r.created = i.Value.(time.Time)
+		}
+	}
+	return r.entry.Load(ps)
+}
+
+func (r *gaeRevision) Save() ([]datastore.Property, error) {
+	ps, err := r.entry.Save()
+	if err != nil {
+		return nil, err
+	}
+	var props []datastore.Property
+	for _, p := range ps {
+		if p.Name == "Html" || p.Name == "SearchTags" || p.Name == "ListTime" {
+			continue
+		}
+		p.NoIndex = true
+		props = append(props, p)
+	}
+	props = append(props,
+		datastore.Property{Name: "Person", Value: r.person, NoIndex: true},
+		datastore.Property{Name: "PersonName", Value: r.personName, NoIndex: true},
+		datastore.Property{Name: "RevisionCreated", Value: r.created, NoIndex: true},
+	)
+	return props, nil
+}
+
+func (em *GaeBlogManager) revision(r *gaeRevision, session security.Session) (*Revision, error) {
+	var err error
+	entry := r.entry
+	if entry.authorUuid != "" {
+		entry.author, err = em.am.GetPersonCached(entry.authorUuid, session)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Revision{
+		Number:      r.number,
+		Entry:       &entry,
+		PersonUuid:  r.person,
+		DisplayName: r.personName,
+		Created:     r.created,
+	}, nil
+}
+
+// latestRevision returns the number of the most recent revision of an
+// entry, or zero if it has none.
+func (em *GaeBlogManager) latestRevision(ctx context.Context, k *datastore.Key) (int, error) {
+	q := datastore.NewQuery("EntryRevision").Namespace(k.Namespace).Ancestor(k).Order("-__key__").Limit(1).KeysOnly()
+	keys, err := em.client.GetAll(ctx, q, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return int(keys[0].ID), nil
+}
+
+// GetRevisionsContext returns every saved version of an entry, newest first.
+// Entries saved before revision history was introduced have no revisions
+// until they are next updated.
+func (em *GaeBlogManager) GetRevisionsContext(ctx context.Context, uuid string, session security.Session) ([]*Revision, error) {
+	if err := checkRevisions(uuid, session, em.storedEntry(ctx, session)); err != nil {
+		return nil, err
+	}
+
+	k := datastore.NameKey("Entry", uuid, nil)
+	k.Namespace = session.Site()
+
+	var items []*Revision
+	q := datastore.NewQuery("EntryRevision").Namespace(session.Site()).Ancestor(k).Order("-__key__")
+	it := em.client.Run(ctx, q)
+	for {
+		r := new(gaeRevision)
+		_, err := it.Next(r)
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		revision, err := em.revision(r, session)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, revision)
+	}
+
+	return items, nil
+}
+
+func (em *GaeBlogManager) GetRevisionContext(ctx context.Context, uuid string, revision int, session security.Session) (*Revision, error) {
+	if err := checkRevisions(uuid, session, em.storedEntry(ctx, session)); err != nil {
+		return nil, err
+	}
+
+	k := datastore.NameKey("Entry", uuid, nil)
+	k.Namespace = session.Site()
+
+	r := new(gaeRevision)
+	err := em.client.Get(ctx, revisionKey(k, revision), r)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return em.revision(r, session)
+}
+
+// RestoreRevisionContext saves the content of an earlier revision as the
+// current version of an entry.
+func (em *GaeBlogManager) RestoreRevisionContext(ctx context.Context, uuid string, revision int, session security.Session) error {
+	return restoreRevision(ctx, em, uuid, revision, session)
+}
+
+// The methods below call their Context variants with the context given to
+// NewGaeBlogManager.
+
+func (em *GaeBlogManager) GetEntry(uuid string, session security.Session) (Entry, error) {
+	return em.GetEntryContext(em.ctx, uuid, session)
+}
+
+func (em *GaeBlogManager) GetEntries(session security.Session) ([]Entry, error) {
+	return em.GetEntriesContext(em.ctx, session)
+}
+
+func (em *GaeBlogManager) GetRecentEntries(limit int, session security.Session) ([]Entry, error) {
+	return em.GetRecentEntriesContext(em.ctx, limit, session)
+}
+
+func (em *GaeBlogManager) GetFutureEntries(session security.Session) ([]Entry, error) {
+	return em.GetFutureEntriesContext(em.ctx, session)
+}
+
+func (em *GaeBlogManager) GetEntryBySlug(slug string, session security.Session) (Entry, error) {
+	return em.GetEntryBySlugContext(em.ctx, slug, session)
+}
+
+func (em *GaeBlogManager) GetEntryCached(uuid string, session security.Session) (Entry, error) {
+	return em.GetEntryCachedContext(em.ctx, uuid, session)
+}
+
+func (em *GaeBlogManager) GetEntryBySlugCached(slug string, session security.Session) (Entry, error) {
+	return em.GetEntryBySlugCachedContext(em.ctx, slug, session)
+}
+
+func (em *GaeBlogManager) AddEntry(entry Entry, session security.Session) error {
+	return em.AddEntryContext(em.ctx, entry, session)
+}
+
+func (em *GaeBlogManager) UpdateEntry(entry Entry, session security.Session) error {
+	return em.UpdateEntryContext(em.ctx, entry, session)
+}
+
+func (em *GaeBlogManager) DeleteEntry(uuid string, session security.Session) error {
+	return em.DeleteEntryContext(em.ctx, uuid, session)
+}
+
+func (em *GaeBlogManager) RestoreEntry(uuid string, session security.Session) error {
+	return em.RestoreEntryContext(em.ctx, uuid, session)
+}
+
+func (em *GaeBlogManager) GetDeletedEntries(session security.Session) ([]Entry, error) {
+	return em.GetDeletedEntriesContext(em.ctx, session)
+}
+
+func (em *GaeBlogManager) PurgeEntry(uuid string, session security.Session) error {
+	return em.PurgeEntryContext(em.ctx, uuid, session)
+}
+
+func (em *GaeBlogManager) ListEntries(options ListOptions, session security.Session) ([]Entry, string, error) {
+	return em.ListEntriesContext(em.ctx, options, session)
+}
+
+func (em *GaeBlogManager) GetEntriesByStatus(status string, session security.Session) ([]Entry, error) {
+	return em.GetEntriesByStatusContext(em.ctx, status, session)
+}
+
+func (em *GaeBlogManager) GetEntriesByAuthor(personUuid string, session security.Session) ([]Entry, error) {
+	return em.GetEntriesByAuthorContext(em.ctx, personUuid, session)
+}
+
+func (em *GaeBlogManager) SearchEntries(query string, session security.Session) ([]Entry, error) {
+	return em.SearchEntriesContext(em.ctx, query, session)
+}
+
+func (em *GaeBlogManager) Search(query string, options SearchOptions, session security.Session) (*SearchResults, error) {
+	return em.SearchContext(em.ctx, query, options, session)
+}
+
+func (em *GaeBlogManager) GetEntriesByTag(tag string, limit int, session security.Session) ([]Entry, error) {
+	return em.GetEntriesByTagContext(em.ctx, tag, limit, session)
+}
+
+func (em *GaeBlogManager) ResolveSlug(slug string, session security.Session) (Entry, string, error) {
+	return em.ResolveSlugContext(em.ctx, slug, session)
+}
+
+func (em *GaeBlogManager) GetRevisions(uuid string, session security.Session) ([]*Revision, error) {
+	return em.GetRevisionsContext(em.ctx, uuid, session)
+}
+
+func (em *GaeBlogManager) GetRevision(uuid string, revision int, session security.Session) (*Revision, error) {
+	return em.GetRevisionContext(em.ctx, uuid, revision, session)
+}
+
+func (em *GaeBlogManager) RestoreRevision(uuid string, revision int, session security.Session) error {
+	return em.RestoreRevisionContext(em.ctx, uuid, revision, session)
+}
@@ -0,0 +1,210 @@
+package blog
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"cloud.google.com/go/datastore"
+	"gitlab.com/montebo/security"
+)
+
+// gaeSearchTerm is the search index entity recording where a term occurs
+// in an entry. It is a child of the entry, named by the term.
+type gaeSearchTerm struct {
+	Term      string
+	Weight    float64 `datastore:",noindex"`
+	Positions []int   `datastore:",noindex"`
+}
+
+// gaeSearchDocuments is the search index entity counting the entries in a
+// namespace, which weighs search terms by how few entries contain them.
+// It is written in the same transaction as each entry that is added or
+// purged.
+type gaeSearchDocuments struct {
+	Entries int `datastore:",noindex"`
+}
+
+func searchDocumentsKey(site string) *datastore.Key {
+	k := datastore.NameKey("SearchDocuments", "entries", nil)
+	k.Namespace = site
+	return k
+}
+
+// countSearchDocuments adds n to the number of entries on a site. The
+// count is left missing until it is first needed by a search.
+func countSearchDocuments(tx *datastore.Transaction, site string, n int) error {
+	var count gaeSearchDocuments
+	err := tx.Get(searchDocumentsKey(site), &count)
+	if err == datastore.ErrNoSuchEntity {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	count.Entries += n
+	_, err = tx.Put(searchDocumentsKey(site), &count)
+	return err
+}
+
+// backfillSearchDocuments counts the entries on a site and saves the
+// count. Entries added or purged while it runs may be miscounted.
+func (em *GaeBlogManager) backfillSearchDocuments(ctx context.Context, site string) (int, error) {
+	n, err := em.client.Count(ctx, datastore.NewQuery("Entry").Namespace(site).KeysOnly())
+	if err != nil {
+		return 0, err
+	}
+	_, err = em.client.Put(ctx, searchDocumentsKey(site), &gaeSearchDocuments{Entries: n})
+	return n, err
+}
+
+// gaeBatchSize is the largest number of entities read or written at once.
+const gaeBatchSize = 500
+
+func searchTermKey(k *datastore.Key, term string) *datastore.Key {
+	tk := datastore.NameKey("SearchTerm", term, k)
+	tk.Namespace = k.Namespace
+	return tk
+}
+
+// updateSearchIndex moves the search index entities of an entry from its
+// previous version to its current version. previous is nil for a new entry
+// and current is nil for a purged entry. The entities are written after
+// the entry, so an error leaves the index out of date until the entry is
+// saved again or BackfillSearch is run.
+func (em *GaeBlogManager) updateSearchIndex(ctx context.Context, k *datastore.Key, previous, current Entry) error {
+	before := searchPostings(previous)
+	after := searchPostings(current)
+
+	var removed []*datastore.Key
+	for term := range before {
+		if after[term] == nil {
+			removed = append(removed, searchTermKey(k, term))
+		}
+	}
+	var keys []*datastore.Key
+	var items []*gaeSearchTerm
+	for term, p := range after {
+		if !samePosting(before[term], p) {
+			keys = append(keys, searchTermKey(k, term))
+			items = append(items, &gaeSearchTerm{Term: term, Weight: p.weight, Positions: p.positions})
+		}
+	}
+
+	for len(removed) > 0 {
+		n := len(removed)
+		if n > gaeBatchSize {
+			n = gaeBatchSize
+		}
+		if err := em.client.DeleteMulti(ctx, removed[:n]); err != nil {
+			return err
+		}
+		removed = removed[n:]
+	}
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > gaeBatchSize {
+			n = gaeBatchSize
+		}
+		if _, err := em.client.PutMulti(ctx, keys[:n], items[:n]); err != nil {
+			return err
+		}
+		keys, items = keys[n:], items[n:]
+	}
+	return nil
+}
+
+// gaeSearchIndex reads the search index of the session site.
+type gaeSearchIndex struct {
+	em      *GaeBlogManager
+	ctx     context.Context
+	session security.Session
+}
+
+func (index *gaeSearchIndex) postings(term string, prefix bool) ([]posting, error) {
+	q := datastore.NewQuery("SearchTerm").Namespace(index.session.Site())
+	if prefix {
+		q = q.Filter("Term >=", term).Filter("Term <", term+string(utf8.MaxRune))
+	} else {
+		q = q.Filter("Term =", term)
+	}
+
+	var found []*gaeSearchTerm
+	keys, err := index.em.client.GetAll(index.ctx, q, &found)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]posting, len(keys))
+	for i, k := range keys {
+		items[i] = posting{term: found[i].Term, uuid: k.Parent.Name, weight: found[i].Weight, positions: found[i].Positions}
+	}
+	return items, nil
+}
+
+func (index *gaeSearchIndex) documents() (int, error) {
+	var count gaeSearchDocuments
+	err := index.em.client.Get(index.ctx, searchDocumentsKey(index.session.Site()), &count)
+	if err == datastore.ErrNoSuchEntity {
+		return index.em.backfillSearchDocuments(index.ctx, index.session.Site())
+	}
+	return count.Entries, err
+}
+
+func (index *gaeSearchIndex) entries(uuids []string) (map[string]Entry, error) {
+	items := make(map[string]Entry)
+	for len(uuids) > 0 {
+		n := len(uuids)
+		if n > gaeBatchSize {
+			n = gaeBatchSize
+		}
+
+		keys := make([]*datastore.Key, n)
+		entries := make([]*GaeEntry, n)
+		for i, uuid := range uuids[:n] {
+			keys[i] = datastore.NameKey("Entry", uuid, nil)
+			keys[i].Namespace = index.session.Site()
+			entries[i] = new(GaeEntry)
+		}
+		err := index.em.client.GetMulti(index.ctx, keys, entries)
+		missing, _ := err.(datastore.MultiError)
+		if err != nil && missing == nil {
+			return nil, err
+		}
+
+		for i, e := range entries {
+			if missing != nil && missing[i] != nil {
+				// Index entities may briefly outlive their entry
+				if missing[i] == datastore.ErrNoSuchEntity {
+					continue
+				}
+				return nil, missing[i]
+			}
+			if e.authorUuid != "" {
+				e.author, err = index.em.am.GetPersonCached(e.authorUuid, index.session)
+				if err != nil {
+					return nil, err
+				}
+			}
+			items[e.Uuid()] = e
+		}
+		uuids = uuids[n:]
+	}
+	return items, nil
+}
+
+// BackfillSearch writes the search index entities of every entry on a
+// site, and counts them. Entries saved before the search index was
+// introduced are not found by Search until this is run, and it may be run
+// again at any time to repair the index.
+func (em *GaeBlogManager) BackfillSearch(ctx context.Context, site string) error {
+	var entries []*GaeEntry
+	keys, err := em.client.GetAll(ctx, datastore.NewQuery("Entry").Namespace(site), &entries)
+	if err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if err := em.updateSearchIndex(ctx, keys[i], nil, e); err != nil {
+			return err
+		}
+	}
+	_, err = em.backfillSearchDocuments(ctx, site)
+	return err
+}
@@ -10,9 +10,10 @@ require (
 	github.com/gocql/gocql v0.0.0-20211015133455-b225f9b53fa1
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/golang/snappy v0.0.4 // indirect
-	github.com/microcosm-cc/bluemonday v1.0.16 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.16
 	github.com/nicksnyder/go-i18n/v2 v2.1.2
 	github.com/stripe/stripe-go/v71 v71.48.0 // indirect
+	github.com/yuin/goldmark v1.4.12
 	github.com/zaddok/base62 v0.0.3
 	github.com/zaddok/log v0.0.0-20181204025159-298eaace4328
 	gitlab.com/montebo/security v0.131.15
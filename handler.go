@@ -0,0 +1,365 @@
+package blog
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/gocql/gocql"
+	"gitlab.com/montebo/security"
+)
+
+// A Handler serves the public pages of a blog:
+//
+//	/blog                 the most recent entries
+//	/blog/{slug}          a single entry
+//	/blog/tag/{tag}       entries with a tag
+//	/blog/author/{uuid}   entries written by a person
+//	/blog/search?q=...    entries matching a search query, most relevant first
+//
+// List pages are paginated with a "cursor" query parameter. Only published
+// entries dated in the past are shown. Requests for a missing entry receive
+// 404 Not Found, and requests for a deleted entry receive 410 Gone. Requests
+// using a slug an entry used to have are permanently redirected to its
+// current slug.
+type Handler struct {
+	// Manager supplies the blog entries.
+	Manager BlogManager
+
+	// Prefix is the path the blog is mounted at, "/blog" by default.
+	Prefix string
+
+	// Session returns the session used to read entries for a request,
+	// which determines the site the entries are read from.
+	Session func(r *http.Request) (security.Session, error)
+
+	// Templates render the pages. They must define "list", "entry",
+	// "search" and "error", each of which is executed with a *Page, and
+	// are parsed with TemplateFuncs. They are never executed directly, so
+	// may be extended while the handler is in use.
+	Templates *template.Template
+
+	// PageSize is the number of entries on each list page.
+	PageSize int
+}
+
+// A Page is the data a Handler template is executed with.
+type Page struct {
+	// Prefix is the path the blog is mounted at.
+	Prefix string
+
+	// Title of the page.
+	Title string
+
+	// Entry is the entry shown by the "entry" template.
+	Entry Entry
+
+	// Entries are shown by the "list" template.
+	Entries []Entry
+
+	// Hits are the search results shown by the "search" template.
+	Hits []*SearchHit
+
+	// Tag, Author and Query describe what a list page is showing.
+	Tag    string
+	Author security.Person
+	Query  string
+
+	// Next is the URL of the following page, or empty on the last page.
+	Next string
+
+	// Status is the HTTP status of an "error" page.
+	Status int
+
+	// Request is the request being served.
+	Request *http.Request
+}
+
+// NewHandler returns a Handler mounted at /blog using the default
+// templates.
+func NewHandler(bm BlogManager, session func(r *http.Request) (security.Session, error)) *Handler {
+	return &Handler{
+		Manager:   bm,
+		Prefix:    "/blog",
+		Session:   session,
+		Templates: DefaultTemplates(),
+		PageSize:  DefaultListLimit,
+	}
+}
+
+// TemplateFuncs are the functions available to Handler templates. "content"
+// returns the rendered and sanitized text of an entry, and "path" returns
+// the path of an entry.
+func TemplateFuncs(prefix string) template.FuncMap {
+	return template.FuncMap{
+		"content": func(e Entry) template.HTML {
+			return template.HTML(e.Html())
+		},
+		"path": func(e Entry) string {
+			return prefix + "/" + url.PathEscape(e.Slug())
+		},
+		"date": func(t *time.Time) string {
+			if t == nil {
+				return ""
+			}
+			return t.Format("2 January 2006")
+		},
+		"author": func(e Entry) string {
+			return authorName(e, "")
+		},
+	}
+}
+
+// DefaultTemplates returns a new copy of the default page templates. Parse
+// replacement definitions into the copy to override individual templates.
+func DefaultTemplates() *template.Template {
+	return template.Must(template.New("blog").Funcs(TemplateFuncs("/blog")).Parse(defaultTemplates))
+}
+
+func (h *Handler) prefix() string {
+	if h.Prefix == "" {
+		return "/blog"
+	}
+	return strings.TrimSuffix(h.Prefix, "/")
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.error(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	prefix := h.prefix()
+	if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		h.error(w, r, http.StatusNotFound)
+		return
+	}
+	route := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	session, err := h.Session(r)
+	if err != nil || session == nil {
+		h.error(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	parts := strings.Split(route, "/")
+	switch {
+	case route == "":
+		h.list(w, r, session, &Page{}, ListOptions{})
+	case route == "search":
+		h.search(w, r, session)
+	case len(parts) == 2 && parts[0] == "tag":
+		h.list(w, r, session, &Page{Title: parts[1], Tag: parts[1]}, ListOptions{Tag: parts[1]})
+	case len(parts) == 2 && parts[0] == "author":
+		h.author(w, r, session, parts[1])
+	case len(parts) == 1:
+		h.entry(w, r, session, parts[0])
+	default:
+		h.error(w, r, http.StatusNotFound)
+	}
+}
+
+// list shows a page of public entries selected by options.
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, session security.Session, page *Page, options ListOptions) {
+	now := time.Now()
+	options.Before = &now
+	options.Cursor = r.URL.Query().Get("cursor")
+	first := options.Cursor == ""
+	options.Limit = h.PageSize
+
+	var err error
+	page.Entries, options.Cursor, err = h.Manager.ListEntriesContext(r.Context(), options, session)
+	if err == ErrInvalidCursor {
+		h.error(w, r, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		h.error(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	if page.Tag != "" && len(page.Entries) == 0 && first {
+		h.error(w, r, http.StatusNotFound)
+		return
+	}
+	if options.Cursor != "" {
+		q := r.URL.Query()
+		q.Set("cursor", options.Cursor)
+		page.Next = r.URL.Path + "?" + q.Encode()
+	}
+
+	h.render(w, r, "list", http.StatusOK, page)
+}
+
+func (h *Handler) author(w http.ResponseWriter, r *http.Request, session security.Session, personUuid string) {
+	author, err := h.Manager.AccessManager().GetPersonCached(personUuid, session)
+	if err != nil && !personNotFound(err) {
+		h.error(w, r, http.StatusInternalServerError)
+		return
+	}
+	if author == nil || err != nil {
+		h.error(w, r, http.StatusNotFound)
+		return
+	}
+
+	page := &Page{Title: authorName(&GaeEntry{author: author}, ""), Author: author}
+	h.list(w, r, session, page, ListOptions{Author: personUuid})
+}
+
+// personNotFound reports whether an access manager error means that no
+// person has the requested uuid, rather than that the lookup failed.
+func personNotFound(err error) bool {
+	return errors.Is(err, datastore.ErrNoSuchEntity) || errors.Is(err, gocql.ErrNotFound) || errors.Is(err, ErrNotFound)
+}
+
+func (h *Handler) search(w http.ResponseWriter, r *http.Request, session security.Session) {
+	page := &Page{Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+	page.Title = page.Query
+
+	if page.Query != "" {
+		options := SearchOptions{Cursor: r.URL.Query().Get("cursor"), Limit: h.PageSize}
+		results, err := h.Manager.SearchContext(r.Context(), page.Query, options, session)
+		if err == ErrInvalidCursor {
+			h.error(w, r, http.StatusBadRequest)
+			return
+		} else if err != nil {
+			h.error(w, r, http.StatusInternalServerError)
+			return
+		}
+		page.Hits = results.Hits
+		if results.Next != "" {
+			q := r.URL.Query()
+			q.Set("cursor", results.Next)
+			page.Next = r.URL.Path + "?" + q.Encode()
+		}
+	}
+
+	h.render(w, r, "search", http.StatusOK, page)
+}
+
+func (h *Handler) entry(w http.ResponseWriter, r *http.Request, session security.Session, slug string) {
+	e, moved, err := h.Manager.ResolveSlugContext(r.Context(), slug, session)
+	if errors.Is(err, ErrDeleted) {
+		h.error(w, r, http.StatusGone)
+		return
+	} else if errors.Is(err, ErrNotFound) {
+		h.error(w, r, http.StatusNotFound)
+		return
+	} else if err != nil {
+		h.error(w, r, http.StatusInternalServerError)
+		return
+	}
+	if moved != "" {
+		redirect(w, r, h.prefix()+"/"+url.PathEscape(moved))
+		return
+	}
+
+	h.render(w, r, "entry", http.StatusOK, &Page{Title: e.Title(), Entry: e})
+}
+
+// redirect permanently redirects a request to a path, keeping its query.
+func redirect(w http.ResponseWriter, r *http.Request, path string) {
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, path, http.StatusMovedPermanently)
+}
+
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, status int) {
+	h.render(w, r, "error", status, &Page{Title: http.StatusText(status), Status: status})
+}
+
+// render executes a template into a buffer first, so that a template
+// error can still be reported with a 500 response. Templates are cloned so
+// that the template functions can refer to the handler prefix without
+// modifying templates shared by concurrent requests.
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, name string, status int, page *Page) {
+	page.Prefix = h.prefix()
+	page.Request = r
+
+	t := h.Templates
+	if t == nil {
+		t = DefaultTemplates()
+	}
+	t, err := t.Clone()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := t.Funcs(TemplateFuncs(page.Prefix)).ExecuteTemplate(&buf, name, page); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+}
+
+const defaultTemplates = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Title}}{{.Title}} - {{end}}Blog</title>
+</head>
+<body>
+<header><a href="{{.Prefix}}">Blog</a>
+<form action="{{.Prefix}}/search" method="get"><input type="search" name="q" value="{{.Query}}"></form>
+</header>
+<main>
+{{end}}
+
+{{define "footer"}}</main>
+</body>
+</html>
+{{end}}
+
+{{define "summary"}}<article>
+<h2><a href="{{path .}}">{{.Title}}</a></h2>
+<p>{{date .Date}}{{with author .}} &middot; {{.}}{{end}}</p>
+{{with .Description}}<p>{{.}}</p>{{end}}
+</article>
+{{end}}
+
+{{define "list"}}{{template "header" .}}
+{{with .Title}}<h1>{{.}}</h1>{{end}}
+{{range .Entries}}{{template "summary" .}}{{else}}<p>There are no entries.</p>{{end}}
+{{with .Next}}<nav><a href="{{.}}" rel="next">Older entries</a></nav>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "search"}}{{template "header" .}}
+{{if .Query}}<h1>{{.Query}}</h1>
+{{range .Hits}}<article>
+<h2><a href="{{path .Entry}}">{{.Entry.Title}}</a></h2>
+<p>{{date .Entry.Date}}{{with author .Entry}} &middot; {{.}}{{end}}</p>
+{{with .Snippet}}<p>{{.}}</p>{{end}}
+</article>
+{{else}}<p>No entries match your search.</p>{{end}}
+{{with .Next}}<nav><a href="{{.}}" rel="next">More results</a></nav>{{end}}{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "entry"}}{{template "header" .}}
+{{with .Entry}}<article>
+{{with .Cover}}<img src="{{.}}" alt="">{{end}}
+<h1>{{.Title}}</h1>
+<p>{{date .Date}}{{with author .}} &middot; {{.}}{{end}}</p>
+{{content .}}
+{{with .Tags}}<ul>{{range .}}<li><a href="{{$.Prefix}}/tag/{{.}}">{{.}}</a></li>{{end}}</ul>{{end}}
+</article>{{end}}
+{{template "footer" .}}{{end}}
+
+{{define "error"}}{{template "header" .}}
+<h1>{{.Title}}</h1>
+{{if eq .Status 410}}<p>This entry has been removed.</p>{{else if eq .Status 404}}<p>This page could not be found.</p>{{end}}
+{{template "footer" .}}{{end}}
+`
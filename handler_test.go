@@ -0,0 +1,211 @@
+package blog
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/gocql/gocql"
+	"gitlab.com/montebo/security"
+)
+
+func newTestHandler(t *testing.T) (*Handler, map[string]Entry) {
+	t.Helper()
+
+	am := newTestAccessManager()
+	bm := NewMemoryBlogManager(am)
+	session := &testSession{site: "handler.com", personUuid: "p0", authenticated: true, roles: []string{RoleEditor}}
+	p1 := am.addPerson("p1", "Jane", "Li")
+
+	entries := make(map[string]Entry)
+	add := func(slug, date, status string, deleted bool, tags ...string) {
+		e := bm.NewEntry()
+		e.SetTitle(slug)
+		e.SetText("Text of *" + slug + "*")
+		e.SetDate(*StringToDatePointer(date))
+		e.SetAuthor(p1)
+		e.SetTags(tags)
+		e.SetStatus(status)
+		e.SetDeleted(deleted)
+		if err := bm.AddEntry(e, session); err != nil {
+			t.Fatalf("AddEntry(%q) failed: %v", slug, err)
+		}
+		entries[slug] = e
+	}
+	add("first", "2001/1/1", StatusPublished, false, "news")
+	add("second", "2002/1/1", StatusPublished, false, "news", "go")
+	add("third", "2003/1/1", StatusPublished, false)
+	add("draft", "2004/1/1", StatusDraft, false, "news")
+	add("future", "2100/1/1", StatusPublished, false, "news")
+	add("removed", "2005/1/1", StatusPublished, true)
+
+	h := NewHandler(bm, func(r *http.Request) (security.Session, error) {
+		return &testSession{site: "handler.com"}, nil
+	})
+	h.PageSize = 2
+	return h, entries
+}
+
+func get(h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	cases := []struct {
+		path    string
+		status  int
+		want    []string
+		exclude []string
+	}{
+		{"/blog", http.StatusOK, []string{`href="/blog/third"`, `href="/blog/second"`, `rel="next"`}, []string{"first", "draft", "future"}},
+		{"/blog/", http.StatusOK, []string{"third"}, nil},
+		{"/blog/second", http.StatusOK, []string{"<em>second</em>", `href="/blog/tag/go"`, "Jane Li"}, nil},
+		{"/blog/tag/news", http.StatusOK, []string{"second", "first"}, []string{"draft", "future"}},
+		{"/blog/tag/missing", http.StatusNotFound, nil, nil},
+		{"/blog/author/p1", http.StatusOK, []string{"Jane Li", "third"}, nil},
+		{"/blog/author/p9", http.StatusNotFound, nil, nil},
+		{"/blog/search?q=second", http.StatusOK, []string{`href="/blog/second"`}, []string{`href="/blog/first"`}},
+		{"/blog/search", http.StatusOK, nil, nil},
+		{"/blog/search?q=text", http.StatusOK, []string{"<mark>Text</mark>", `rel="next"`}, nil},
+		{"/blog/search?q=text&cursor=bad", http.StatusBadRequest, nil, nil},
+		{"/blog/missing", http.StatusNotFound, nil, nil},
+		{"/blog/removed", http.StatusGone, []string{"removed"}, nil},
+		{"/blog/draft", http.StatusNotFound, nil, nil},
+		{"/blog/future", http.StatusNotFound, nil, nil},
+		{"/blog/a/b/c", http.StatusNotFound, nil, nil},
+		{"/other", http.StatusNotFound, nil, nil},
+		{"/blog?cursor=bad", http.StatusBadRequest, nil, nil},
+	}
+
+	for _, c := range cases {
+		w := get(h, c.path)
+		if w.Code != c.status {
+			t.Errorf("GET %s returned %d, want %d", c.path, w.Code, c.status)
+			continue
+		}
+		body := w.Body.String()
+		for _, s := range c.want {
+			if !strings.Contains(body, s) {
+				t.Errorf("GET %s should contain %q:\n%s", c.path, s, body)
+			}
+		}
+		for _, s := range c.exclude {
+			if strings.Contains(body, `href="/blog/`+s+`"`) {
+				t.Errorf("GET %s should not link to %q", c.path, s)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/blog", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /blog returned %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHandlerAuthor(t *testing.T) {
+	am := newTestAccessManager()
+	am.errs = map[string]error{
+		"gone":    datastore.ErrNoSuchEntity,
+		"missing": gocql.ErrNotFound,
+		"broken":  errors.New("connection refused"),
+	}
+	h := NewHandler(NewMemoryBlogManager(am), func(r *http.Request) (security.Session, error) {
+		return &testSession{site: "handler.com"}, nil
+	})
+
+	cases := []struct {
+		path   string
+		status int
+	}{
+		{"/blog/author/nobody", http.StatusNotFound},
+		{"/blog/author/gone", http.StatusNotFound},
+		{"/blog/author/missing", http.StatusNotFound},
+		{"/blog/author/broken", http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		if w := get(h, c.path); w.Code != c.status {
+			t.Errorf("GET %s returned %d, want %d", c.path, w.Code, c.status)
+		}
+	}
+}
+
+func TestHandlerRedirect(t *testing.T) {
+	h, entries := newTestHandler(t)
+	session := &testSession{site: "handler.com", personUuid: "p0", authenticated: true, roles: []string{RoleEditor}}
+
+	for _, slug := range []string{"renamed", "latest"} {
+		e, err := h.Manager.GetEntry(entries["first"].Uuid(), session)
+		if err != nil {
+			t.Fatalf("GetEntry() failed: %v", err)
+		}
+		e.SetSlug(slug)
+		if err := h.Manager.UpdateEntry(e, session); err != nil {
+			t.Fatalf("UpdateEntry() failed: %v", err)
+		}
+	}
+
+	for _, path := range []string{"/blog/first?ref=feed", "/blog/renamed?ref=feed"} {
+		w := get(h, path)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/blog/latest?ref=feed" {
+			t.Errorf("GET %s returned %d to %q, want a 301 to /blog/latest?ref=feed", path, w.Code, w.Header().Get("Location"))
+		}
+	}
+	if w := get(h, "/blog/latest"); w.Code != http.StatusOK {
+		t.Errorf("GET /blog/latest returned %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHandlerPagination(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	var seen []string
+	next := "/blog"
+	for pages := 0; next != "" && pages < 5; pages++ {
+		w := get(h, next)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s returned %d", next, w.Code)
+		}
+		body := w.Body.String()
+		for _, part := range strings.Split(body, `<h2><a href="/blog/`)[1:] {
+			seen = append(seen, part[:strings.Index(part, `"`)])
+		}
+		next = ""
+		if i := strings.Index(body, `<a href="`); i >= 0 {
+			if j := strings.Index(body, `" rel="next"`); j > i {
+				start := strings.LastIndex(body[:j], `"`) + 1
+				next = strings.ReplaceAll(body[start:j], "&amp;", "&")
+			}
+		}
+	}
+	if strings.Join(seen, ",") != "third,second,first" {
+		t.Errorf("pages listed %v", seen)
+	}
+}
+
+func TestHandlerTemplates(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Prefix = "/news/"
+	h.Templates = template.Must(DefaultTemplates().Parse(`{{define "entry"}}custom {{.Entry.Title}} {{path .Entry}}{{end}}`))
+
+	w := get(h, "/news/second")
+	if w.Code != http.StatusOK || w.Body.String() != "custom second /news/second" {
+		t.Errorf("GET /news/second returned %d %q", w.Code, w.Body.String())
+	}
+	if w := get(h, "/blog/second"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /blog/second with prefix /news returned %d", w.Code)
+	}
+
+	w = get(h, "/news")
+	if !strings.Contains(w.Body.String(), `href="/news/third"`) {
+		t.Errorf("GET /news should link entries under the prefix:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,161 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"gitlab.com/montebo/security"
+	"golang.org/x/text/language"
+)
+
+// translations holds every message registered by the blog, so that the
+// blog's own pages can be localised without depending on how the security
+// package stores its translations.
+var translations = i18n.NewBundle(language.English)
+
+// registerTranslations registers messages with the security package, for
+// menus and pages it renders, and with the blog's own bundle.
+func registerTranslations(tag language.Tag, messages ...*i18n.Message) {
+	security.RegisterTranslations(tag, messages...)
+	translations.AddMessages(tag, messages...)
+}
+
+// localizer returns a localizer for the languages accepted by a request.
+func localizer(r *http.Request) *i18n.Localizer {
+	return i18n.NewLocalizer(translations, r.Header.Get("Accept-Language"))
+}
+
+// translate returns a localised message, or the message id if it has not
+// been translated.
+func translate(l *i18n.Localizer, id string) string {
+	if l == nil {
+		return id
+	}
+	s, err := l.Localize(&i18n.LocalizeConfig{MessageID: id})
+	if err != nil || s == "" {
+		return id
+	}
+	return s
+}
+
+func registerBlogTranslations() {
+	registerTranslations(language.English,
+		&i18n.Message{ID: "blog", Other: "Blog"},
+		&i18n.Message{ID: "manage-blog", Other: "Manage Blog"},
+		&i18n.Message{ID: "blog-entries", Other: "Entries"},
+		&i18n.Message{ID: "blog-scheduled", Other: "Scheduled"},
+		&i18n.Message{ID: "blog-trash", Other: "Trash"},
+		&i18n.Message{ID: "blog-new-entry", Other: "New entry"},
+		&i18n.Message{ID: "blog-edit-entry", Other: "Edit entry"},
+		&i18n.Message{ID: "blog-title", Other: "Title"},
+		&i18n.Message{ID: "blog-slug", Other: "Slug"},
+		&i18n.Message{ID: "blog-description", Other: "Description"},
+		&i18n.Message{ID: "blog-text", Other: "Text"},
+		&i18n.Message{ID: "blog-format", Other: "Format"},
+		&i18n.Message{ID: "blog-language", Other: "Language"},
+		&i18n.Message{ID: "blog-date", Other: "Date"},
+		&i18n.Message{ID: "blog-tags", Other: "Tags"},
+		&i18n.Message{ID: "blog-author", Other: "Author"},
+		&i18n.Message{ID: "blog-thumbnail", Other: "Thumbnail"},
+		&i18n.Message{ID: "blog-cover", Other: "Cover image"},
+		&i18n.Message{ID: "blog-status", Other: "Status"},
+		&i18n.Message{ID: "blog-deleted", Other: "Deleted"},
+		&i18n.Message{ID: "blog-any", Other: "Any"},
+		&i18n.Message{ID: "blog-filter", Other: "Filter"},
+		&i18n.Message{ID: "blog-save", Other: "Save"},
+		&i18n.Message{ID: "blog-edit", Other: "Edit"},
+		&i18n.Message{ID: "blog-delete", Other: "Delete"},
+		&i18n.Message{ID: "blog-restore", Other: "Restore"},
+		&i18n.Message{ID: "blog-purge", Other: "Delete permanently"},
+		&i18n.Message{ID: "blog-older", Other: "Older entries"},
+		&i18n.Message{ID: "blog-no-entries", Other: "There are no entries."},
+		&i18n.Message{ID: "blog-forbidden", Other: "You do not have permission to manage blog entries."},
+		&i18n.Message{ID: "blog-not-found", Other: "This entry could not be found."},
+		&i18n.Message{ID: "blog-invalid-form", Other: "This form has expired. Please try again."},
+		&i18n.Message{ID: "blog-status-draft", Other: "Draft"},
+		&i18n.Message{ID: "blog-status-in_review", Other: "In review"},
+		&i18n.Message{ID: "blog-status-scheduled", Other: "Scheduled"},
+		&i18n.Message{ID: "blog-status-published", Other: "Published"},
+		&i18n.Message{ID: "blog-status-archived", Other: "Archived"},
+	)
+
+	registerTranslations(language.TraditionalChinese,
+		&i18n.Message{ID: "blog", Other: "部落格"},
+		&i18n.Message{ID: "manage-blog", Other: "Manage 部落格"},
+		&i18n.Message{ID: "blog-entries", Other: "文章"},
+		&i18n.Message{ID: "blog-scheduled", Other: "已排程"},
+		&i18n.Message{ID: "blog-trash", Other: "垃圾桶"},
+		&i18n.Message{ID: "blog-new-entry", Other: "新增文章"},
+		&i18n.Message{ID: "blog-edit-entry", Other: "編輯文章"},
+		&i18n.Message{ID: "blog-title", Other: "標題"},
+		&i18n.Message{ID: "blog-slug", Other: "網址代稱"},
+		&i18n.Message{ID: "blog-description", Other: "描述"},
+		&i18n.Message{ID: "blog-text", Other: "內文"},
+		&i18n.Message{ID: "blog-format", Other: "格式"},
+		&i18n.Message{ID: "blog-language", Other: "語言"},
+		&i18n.Message{ID: "blog-date", Other: "日期"},
+		&i18n.Message{ID: "blog-tags", Other: "標籤"},
+		&i18n.Message{ID: "blog-author", Other: "作者"},
+		&i18n.Message{ID: "blog-thumbnail", Other: "縮圖"},
+		&i18n.Message{ID: "blog-cover", Other: "封面圖片"},
+		&i18n.Message{ID: "blog-status", Other: "狀態"},
+		&i18n.Message{ID: "blog-deleted", Other: "已刪除"},
+		&i18n.Message{ID: "blog-any", Other: "全部"},
+		&i18n.Message{ID: "blog-filter", Other: "篩選"},
+		&i18n.Message{ID: "blog-save", Other: "儲存"},
+		&i18n.Message{ID: "blog-edit", Other: "編輯"},
+		&i18n.Message{ID: "blog-delete", Other: "刪除"},
+		&i18n.Message{ID: "blog-restore", Other: "還原"},
+		&i18n.Message{ID: "blog-purge", Other: "永久刪除"},
+		&i18n.Message{ID: "blog-older", Other: "較舊的文章"},
+		&i18n.Message{ID: "blog-no-entries", Other: "沒有文章。"},
+		&i18n.Message{ID: "blog-forbidden", Other: "您沒有管理部落格文章的權限。"},
+		&i18n.Message{ID: "blog-not-found", Other: "找不到這篇文章。"},
+		&i18n.Message{ID: "blog-invalid-form", Other: "此表單已過期，請再試一次。"},
+		&i18n.Message{ID: "blog-status-draft", Other: "草稿"},
+		&i18n.Message{ID: "blog-status-in_review", Other: "審核中"},
+		&i18n.Message{ID: "blog-status-scheduled", Other: "已排程"},
+		&i18n.Message{ID: "blog-status-published", Other: "已發佈"},
+		&i18n.Message{ID: "blog-status-archived", Other: "已封存"},
+	)
+
+	registerTranslations(language.SimplifiedChinese,
+		&i18n.Message{ID: "blog", Other: "博客"},
+		&i18n.Message{ID: "manage-blog", Other: "Manage 博客"},
+		&i18n.Message{ID: "blog-entries", Other: "文章"},
+		&i18n.Message{ID: "blog-scheduled", Other: "已排期"},
+		&i18n.Message{ID: "blog-trash", Other: "回收站"},
+		&i18n.Message{ID: "blog-new-entry", Other: "新建文章"},
+		&i18n.Message{ID: "blog-edit-entry", Other: "编辑文章"},
+		&i18n.Message{ID: "blog-title", Other: "标题"},
+		&i18n.Message{ID: "blog-slug", Other: "网址别名"},
+		&i18n.Message{ID: "blog-description", Other: "描述"},
+		&i18n.Message{ID: "blog-text", Other: "正文"},
+		&i18n.Message{ID: "blog-format", Other: "格式"},
+		&i18n.Message{ID: "blog-language", Other: "语言"},
+		&i18n.Message{ID: "blog-date", Other: "日期"},
+		&i18n.Message{ID: "blog-tags", Other: "标签"},
+		&i18n.Message{ID: "blog-author", Other: "作者"},
+		&i18n.Message{ID: "blog-thumbnail", Other: "缩略图"},
+		&i18n.Message{ID: "blog-cover", Other: "封面图片"},
+		&i18n.Message{ID: "blog-status", Other: "状态"},
+		&i18n.Message{ID: "blog-deleted", Other: "已删除"},
+		&i18n.Message{ID: "blog-any", Other: "全部"},
+		&i18n.Message{ID: "blog-filter", Other: "筛选"},
+		&i18n.Message{ID: "blog-save", Other: "保存"},
+		&i18n.Message{ID: "blog-edit", Other: "编辑"},
+		&i18n.Message{ID: "blog-delete", Other: "删除"},
+		&i18n.Message{ID: "blog-restore", Other: "恢复"},
+		&i18n.Message{ID: "blog-purge", Other: "永久删除"},
+		&i18n.Message{ID: "blog-older", Other: "较早的文章"},
+		&i18n.Message{ID: "blog-no-entries", Other: "没有文章。"},
+		&i18n.Message{ID: "blog-forbidden", Other: "您没有管理博客文章的权限。"},
+		&i18n.Message{ID: "blog-not-found", Other: "找不到这篇文章。"},
+		&i18n.Message{ID: "blog-invalid-form", Other: "此表单已过期，请重试。"},
+		&i18n.Message{ID: "blog-status-draft", Other: "草稿"},
+		&i18n.Message{ID: "blog-status-in_review", Other: "审核中"},
+		&i18n.Message{ID: "blog-status-scheduled", Other: "已排期"},
+		&i18n.Message{ID: "blog-status-published", Other: "已发布"},
+		&i18n.Message{ID: "blog-status-archived", Other: "已归档"},
+	)
+}
@@ -0,0 +1,120 @@
+package blog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitlab.com/montebo/security"
+)
+
+// JSONFeedVersion identifies the version of the JSON Feed specification
+// written by Feed.JSON.
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// LoadPage sets the feed entries to one page of published entries selected
+// by ListEntries, and sets Next to the cursor of the following page. Entries
+// dated in the future are never included.
+func (f *Feed) LoadPage(bm BlogManager, options ListOptions, session security.Session) error {
+	now := time.Now()
+	if options.Before == nil || options.Before.After(now) {
+		options.Before = &now
+	}
+
+	items, next, err := bm.ListEntries(options, session)
+	if err != nil {
+		return err
+	}
+	if err := f.load(items, len(items), nil, session); err != nil {
+		return err
+	}
+	f.Next = next
+	return nil
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	NextURL     string           `json:"next_url,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	BannerImage   string           `json:"banner_image,omitempty"`
+	DatePublished string           `json:"date_published,omitempty"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+// JSON returns the feed as a JSON Feed 1.1 document. When Next is set the
+// document links to the next page with a "cursor" parameter added to Self.
+func (f *Feed) JSON() ([]byte, error) {
+	doc := jsonFeed{
+		Version:     JSONFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.Self,
+		Description: f.Description,
+		Language:    f.Language,
+		Items:       []jsonFeedItem{},
+	}
+	if f.Author != "" {
+		doc.Authors = []jsonFeedAuthor{{f.Author}}
+	}
+	if f.Next != "" && f.Self != "" {
+		u, err := url.Parse(f.Self)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		q.Set("cursor", f.Next)
+		u.RawQuery = q.Encode()
+		doc.NextURL = u.String()
+	}
+
+	for _, e := range f.Entries {
+		item := jsonFeedItem{
+			ID:           EntryID(f.Site, e),
+			URL:          f.link(e),
+			Title:        e.Title(),
+			ContentHTML:  e.Html(),
+			Summary:      e.Description(),
+			Image:        e.Thumbnail(),
+			BannerImage:  e.Cover(),
+			DateModified: entryUpdated(e).UTC().Format(time.RFC3339),
+			Tags:         e.Tags(),
+		}
+		if e.Date() != nil {
+			item.DatePublished = e.Date().UTC().Format(time.RFC3339)
+		}
+		if name := authorName(e, ""); name != "" {
+			item.Authors = []jsonFeedAuthor{{name}}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// ServeJSON writes the feed as a JSON Feed 1.1 response, or a 304 Not
+// Modified response if the client already has the current version.
+func (f *Feed) ServeJSON(w http.ResponseWriter, r *http.Request) {
+	f.serve(w, r, "application/feed+json; charset=utf-8", f.JSON)
+}
@@ -0,0 +1,65 @@
+package blog
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestFeedJSON(t *testing.T) {
+	f, bm, session := newTestFeed(t)
+
+	var titles []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		if err := f.LoadPage(bm, ListOptions{Limit: 1, Tag: "news", Cursor: cursor}, session); err != nil {
+			t.Fatalf("LoadPage() failed: %v", err)
+		}
+
+		data, err := f.JSON()
+		if err != nil {
+			t.Fatalf("JSON() failed: %v", err)
+		}
+		var doc struct {
+			Version string `json:"version"`
+			NextURL string `json:"next_url"`
+			Items   []struct {
+				ID          string   `json:"id"`
+				URL         string   `json:"url"`
+				Title       string   `json:"title"`
+				ContentHTML string   `json:"content_html"`
+				BannerImage string   `json:"banner_image"`
+				Published   string   `json:"date_published"`
+				Tags        []string `json:"tags"`
+				Authors     []struct {
+					Name string `json:"name"`
+				} `json:"authors"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("JSON() is not valid JSON: %v\n%s", err, data)
+		}
+		if doc.Version != JSONFeedVersion {
+			t.Errorf("JSON() version %q", doc.Version)
+		}
+		for _, i := range doc.Items {
+			titles = append(titles, i.Title)
+			if i.ID == "" || i.URL == "" || i.ContentHTML == "" || i.Published == "" || len(i.Authors) != 1 || i.Authors[0].Name != "Jane Li" {
+				t.Errorf("JSON() item is incomplete: %s", data)
+			}
+		}
+		if doc.NextURL == "" {
+			break
+		}
+		u, err := url.Parse(doc.NextURL)
+		if err != nil || u.Path != "/blog/feed" {
+			t.Fatalf("JSON() next_url %q", doc.NextURL)
+		}
+		cursor = u.Query().Get("cursor")
+	}
+
+	// The draft and the future entry are never included
+	if len(titles) != 2 || titles[0] != "Second & last" || titles[1] != "First" {
+		t.Errorf("JSON() pages contained %v", titles)
+	}
+}
@@ -0,0 +1,108 @@
+package blog
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// DefaultListLimit is the page size used by ListEntries when no limit is
+// given, and MaxListLimit is the largest page size it returns.
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 1000
+)
+
+// ListOptions selects a page of entries returned by ListEntries.
+type ListOptions struct {
+	// Limit is the maximum number of entries in the page.
+	Limit int
+
+	// Cursor is the next page token returned with the previous page, or
+	// empty for the first page.
+	Cursor string
+
+	// Tag restricts the page to entries with this tag.
+	Tag string
+
+	// Author restricts the page to entries written by the person with this
+	// uuid.
+	Author string
+
+	// Before and After restrict the page to entries dated strictly before
+	// or after a time.
+	Before *time.Time
+	After  *time.Time
+}
+
+// ErrInvalidCursor is returned by ListEntries when the cursor was not
+// returned by an earlier call.
+var ErrInvalidCursor = errors.New("Invalid page cursor")
+
+// limit returns the page size requested, within the allowed range.
+func (o ListOptions) limit() int {
+	if o.Limit <= 0 {
+		return DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		return MaxListLimit
+	}
+	return o.Limit
+}
+
+// tag returns the requested tag in the form stored in search tags.
+func (o ListOptions) tag() string {
+	return tagKey(o.Tag)
+}
+
+// tagKey returns a tag in the form stored in search tags and tag indexes.
+func tagKey(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), " ", "-"))
+}
+
+// match reports whether an entry satisfies the tag, author and date
+// restrictions.
+func (o ListOptions) match(e Entry) bool {
+	if o.Author != "" && e.AuthorUUID() != o.Author {
+		return false
+	}
+	if tag := o.tag(); tag != "" {
+		found := false
+		for _, t := range e.Tags() {
+			if tagKey(t) == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if o.Before != nil || o.After != nil {
+		if e.Date() == nil {
+			return false
+		}
+		if o.Before != nil && !e.Date().Before(*o.Before) {
+			return false
+		}
+		if o.After != nil && !e.Date().After(*o.After) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeCursor and decodeCursor convert native cursors and page states to
+// and from tokens that are safe to use in a URL.
+func encodeCursor(state []byte) string {
+	return base64.RawURLEncoding.EncodeToString(state)
+}
+
+func decodeCursor(cursor string) ([]byte, error) {
+	state, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return state, nil
+}
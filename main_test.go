@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -38,6 +39,13 @@ const testSmtpPort = 8928
 const testSmtpHostname = "127.0.0.1"
 
 func TestMain(m *testing.M) {
+	// In short mode only tests that do not need the datastore emulator or
+	// cassandra are run.
+	flag.Parse()
+	if testing.Short() {
+		os.Exit(m.Run())
+	}
+
 	if os.Getenv("CASSANDRA_HOSTNAME") != "" {
 		testCassandraHostname = os.Getenv("CASSANDRA_HOSTNAME")
 		fmt.Println("Cassandra hostname: ", testCassandraHostname)
@@ -155,6 +163,17 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+// EmulatorProjectId returns the project id of the datastore emulator started
+// by TestMain, for use by tests in package blog_test.
+func EmulatorProjectId() string {
+	return projectId
+}
+
+// CassandraHostname returns the cassandra host used by the tests.
+func CassandraHostname() string {
+	return testCassandraHostname
+}
+
 func requireEnv(name string, t *testing.T) string {
 	if name == "GOOGLE_CLOUD_PROJECT" {
 		return projectId
@@ -0,0 +1,641 @@
+package blog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"gitlab.com/montebo/security"
+)
+
+// csrfCookie is the cookie holding the token that every form submitted to a
+// ManageHandler must repeat in its "csrf" field.
+const csrfCookie = "blog_csrf"
+
+// A ManageHandler serves the blog management pages linked from the
+// "manage-blog" menu item:
+//
+//	/blog/manage                the entries, filtered by status, tag or author
+//	/blog/manage/scheduled      entries dated in the future
+//	/blog/manage/new            a form to create an entry
+//	/blog/manage/edit/{uuid}    a form to change an entry
+//	/blog/manage/trash          deleted entries, most recently deleted first
+//	/blog/manage/delete/{uuid}  moves an entry to the trash
+//	/blog/manage/restore/{uuid} restores an entry from the trash
+//	/blog/manage/purge/{uuid}   permanently removes an entry from the trash
+//
+// Editors may manage every entry, and authors may manage the entries they
+// wrote. Forms are protected from cross site request forgery with a token
+// held in a cookie, and pages are translated to the language the browser
+// prefers.
+type ManageHandler struct {
+	// Manager supplies the blog entries.
+	Manager BlogManager
+
+	// Prefix is the path the pages are mounted at, "/blog/manage" by
+	// default.
+	Prefix string
+
+	// Session returns the session of the person making a request.
+	Session func(r *http.Request) (security.Session, error)
+
+	// Templates render the pages. They must define "manage", "form" and
+	// "manage-error", each of which is executed with a *ManagePage, and are
+	// parsed with ManageTemplateFuncs.
+	Templates *template.Template
+
+	// Location is the time zone of dates entered in the form, UTC by
+	// default.
+	Location *time.Location
+
+	// PageSize is the number of entries on each list page.
+	PageSize int
+}
+
+// A ManagePage is the data a ManageHandler template is executed with.
+type ManagePage struct {
+	// Prefix is the path the management pages are mounted at.
+	Prefix string
+
+	// Title is the message id of the page title.
+	Title string
+
+	// Entries are shown by the "manage" template.
+	Entries []Entry
+
+	// Status, Tag and Author are the filters applied to Entries.
+	Status string
+	Tag    string
+	Author string
+
+	// Next is the URL of the following page, or empty on the last page.
+	Next string
+
+	// Trash is set when Entries are the deleted entries.
+	Trash bool
+
+	// Entry is the entry edited by the "form" template, and Action is the
+	// URL the form is submitted to.
+	Entry  Entry
+	Action string
+
+	// Error describes why a form could not be saved, or why an
+	// "manage-error" page was shown.
+	Error string
+
+	// Code is the HTTP status of the response.
+	Code int
+
+	// Editor is set when the session may manage every entry.
+	Editor bool
+
+	// Statuses and Formats are the choices offered by the form.
+	Statuses []string
+	Formats  []string
+
+	// CSRF is the token every submitted form must include as "csrf".
+	CSRF string
+
+	// Request is the request being served.
+	Request *http.Request
+}
+
+// NewManageHandler returns a ManageHandler mounted at /blog/manage using
+// the default templates.
+func NewManageHandler(bm BlogManager, session func(r *http.Request) (security.Session, error)) *ManageHandler {
+	return &ManageHandler{
+		Manager:   bm,
+		Prefix:    "/blog/manage",
+		Session:   session,
+		Templates: DefaultManageTemplates(),
+		Location:  time.UTC,
+		PageSize:  DefaultListLimit,
+	}
+}
+
+// ManageTemplateFuncs are the functions available to ManageHandler
+// templates. "t" translates a message id, "status" translates an entry
+// status, and "datetime" formats a date for a datetime-local input.
+func ManageTemplateFuncs(l *i18n.Localizer, location *time.Location) template.FuncMap {
+	return template.FuncMap{
+		"t": func(id string) string {
+			return translate(l, id)
+		},
+		"status": func(status string) string {
+			return translate(l, "blog-status-"+status)
+		},
+		"datetime": func(t *time.Time) string {
+			if t == nil {
+				return ""
+			}
+			return t.In(location).Format("2006-01-02T15:04")
+		},
+		"date": func(t *time.Time) string {
+			if t == nil {
+				return ""
+			}
+			return t.In(location).Format("2006-01-02 15:04")
+		},
+		"join": func(items []string) string {
+			return strings.Join(items, ", ")
+		},
+	}
+}
+
+// DefaultManageTemplates returns a new copy of the default management page
+// templates.
+func DefaultManageTemplates() *template.Template {
+	return template.Must(template.New("manage").Funcs(ManageTemplateFuncs(nil, time.UTC)).Parse(defaultManageTemplates))
+}
+
+func (h *ManageHandler) prefix() string {
+	if h.Prefix == "" {
+		return "/blog/manage"
+	}
+	return strings.TrimSuffix(h.Prefix, "/")
+}
+
+func (h *ManageHandler) location() *time.Location {
+	if h.Location == nil {
+		return time.UTC
+	}
+	return h.Location
+}
+
+func (h *ManageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := h.prefix()
+	if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		h.error(w, r, http.StatusNotFound, "")
+		return
+	}
+	route := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	session, err := h.Session(r)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	if session == nil || !session.IsAuthenticated() {
+		h.error(w, r, http.StatusUnauthorized, "")
+		return
+	}
+	if !session.HasRole(RoleEditor, RoleAuthor) {
+		h.error(w, r, http.StatusForbidden, "blog-forbidden")
+		return
+	}
+	r = r.WithContext(ShowHidden(r.Context()))
+
+	page := &ManagePage{
+		Editor:   session.HasRole(RoleEditor),
+		Statuses: Statuses,
+		Formats:  Formats(),
+		CSRF:     h.csrfToken(w, r),
+	}
+
+	if r.Method == http.MethodPost {
+		if !validCSRF(r) {
+			h.error(w, r, http.StatusForbidden, "blog-invalid-form")
+			return
+		}
+	} else if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		h.error(w, r, http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	parts := strings.Split(route, "/")
+	switch {
+	case route == "" && r.Method != http.MethodPost:
+		h.list(w, r, session, page)
+	case route == "scheduled" && r.Method != http.MethodPost:
+		h.scheduled(w, r, session, page)
+	case route == "trash" && r.Method != http.MethodPost:
+		h.trash(w, r, session, page)
+	case route == "new":
+		h.edit(w, r, session, page, h.Manager.NewEntry(), true)
+	case len(parts) == 2 && parts[0] == "edit":
+		e := h.load(w, r, session, parts[1])
+		if e != nil {
+			h.edit(w, r, session, page, e, false)
+		}
+	case len(parts) == 2 && (parts[0] == "delete" || parts[0] == "restore" || parts[0] == "purge"):
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			h.error(w, r, http.StatusMethodNotAllowed, "")
+			return
+		}
+		e := h.load(w, r, session, parts[1])
+		if e != nil {
+			h.change(w, r, session, e, parts[0])
+		}
+	default:
+		h.error(w, r, http.StatusNotFound, "")
+	}
+}
+
+// load returns the entry with a uuid if the session may manage it, and
+// otherwise writes an error page and returns nil.
+func (h *ManageHandler) load(w http.ResponseWriter, r *http.Request, session security.Session, uuid string) Entry {
+	e, err := h.Manager.GetEntryContext(r.Context(), uuid, session)
+	if errors.Is(err, ErrNotFound) {
+		h.error(w, r, http.StatusNotFound, "blog-not-found")
+		return nil
+	} else if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "")
+		return nil
+	}
+	if !canManage(e, session) {
+		h.error(w, r, http.StatusForbidden, "blog-forbidden")
+		return nil
+	}
+	return e
+}
+
+// canManage reports whether a session may change an entry. Editors may
+// change any entry, and authors may change their own entries.
+func canManage(e Entry, session security.Session) bool {
+	return checkAuthor(e.AuthorUUID(), session) == nil
+}
+
+// list shows a page of entries. A status filter reads every entry with the
+// status, other filters are paginated with a "cursor" query parameter.
+// Authors only see their own entries.
+func (h *ManageHandler) list(w http.ResponseWriter, r *http.Request, session security.Session, page *ManagePage) {
+	q := r.URL.Query()
+	page.Title = "blog-entries"
+	page.Status = q.Get("status")
+	options := ListOptions{
+		Tag:    strings.TrimSpace(q.Get("tag")),
+		Author: strings.TrimSpace(q.Get("author")),
+		Cursor: q.Get("cursor"),
+		Limit:  h.PageSize,
+	}
+	if !page.Editor {
+		options.Author = session.PersonUuid()
+	}
+	page.Tag = options.Tag
+	page.Author = options.Author
+
+	if page.Status != "" {
+		if !ValidStatus(page.Status) {
+			h.error(w, r, http.StatusBadRequest, "")
+			return
+		}
+		items, err := h.Manager.GetEntriesByStatusContext(r.Context(), page.Status, session)
+		if err != nil {
+			h.error(w, r, http.StatusInternalServerError, "")
+			return
+		}
+		for _, e := range items {
+			if options.match(e) {
+				page.Entries = append(page.Entries, e)
+			}
+		}
+		h.render(w, r, "manage", http.StatusOK, page)
+		return
+	}
+
+	items, next, err := h.Manager.ListEntriesContext(r.Context(), options, session)
+	if err == ErrInvalidCursor {
+		h.error(w, r, http.StatusBadRequest, "")
+		return
+	} else if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	page.Entries = items
+	if next != "" {
+		q.Set("cursor", next)
+		page.Next = r.URL.Path + "?" + q.Encode()
+	}
+
+	h.render(w, r, "manage", http.StatusOK, page)
+}
+
+// scheduled shows the entries dated in the future.
+func (h *ManageHandler) scheduled(w http.ResponseWriter, r *http.Request, session security.Session, page *ManagePage) {
+	page.Title = "blog-scheduled"
+	items, err := h.Manager.GetFutureEntriesContext(r.Context(), session)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	for _, e := range items {
+		if canManage(e, session) {
+			page.Entries = append(page.Entries, e)
+		}
+	}
+
+	h.render(w, r, "manage", http.StatusOK, page)
+}
+
+// trash shows the deleted entries the session may manage.
+func (h *ManageHandler) trash(w http.ResponseWriter, r *http.Request, session security.Session, page *ManagePage) {
+	page.Title = "blog-trash"
+	page.Trash = true
+	items, err := h.Manager.GetDeletedEntriesContext(r.Context(), session)
+	if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+	page.Entries = items
+
+	h.render(w, r, "manage", http.StatusOK, page)
+}
+
+// edit shows the form for an entry, and saves the entry when the form is
+// submitted. A form that can not be saved is shown again with the reason.
+func (h *ManageHandler) edit(w http.ResponseWriter, r *http.Request, session security.Session, page *ManagePage, e Entry, create bool) {
+	page.Entry = e
+	if create {
+		page.Title = "blog-new-entry"
+		page.Action = h.prefix() + "/new"
+	} else {
+		page.Title = "blog-edit-entry"
+		page.Action = h.prefix() + "/edit/" + url.PathEscape(e.Uuid())
+	}
+
+	if r.Method != http.MethodPost {
+		h.render(w, r, "form", http.StatusOK, page)
+		return
+	}
+
+	// The form is read into a copy, the entry may be shared with a cache
+	// and must not change when the form can not be saved.
+	if !create {
+		e = cloneEntry(e)
+		page.Entry = e
+	}
+	err := h.readForm(r, e, session, create)
+	if err == nil && create {
+		err = h.Manager.AddEntryContext(r.Context(), e, session)
+	} else if err == nil {
+		err = h.Manager.UpdateEntryContext(r.Context(), e, session)
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		var forbidden *ErrForbidden
+		if errors.As(err, &forbidden) {
+			status = http.StatusForbidden
+		}
+		page.Error = err.Error()
+		h.render(w, r, "form", status, page)
+		return
+	}
+
+	http.Redirect(w, r, h.prefix(), http.StatusSeeOther)
+}
+
+// readForm copies the submitted form fields to an entry. An empty date
+// field clears the date. Only editors may choose the author of an entry,
+// other entries are written by the session person.
+func (h *ManageHandler) readForm(r *http.Request, e Entry, session security.Session, create bool) error {
+	e.SetTitle(strings.TrimSpace(r.PostFormValue("title")))
+	if _, ok := r.PostForm["slug"]; ok {
+		if slug := strings.TrimSpace(r.PostFormValue("slug")); slug != e.Slug() {
+			e.SetSlug(slug)
+		}
+	}
+	e.SetDescription(strings.TrimSpace(r.PostFormValue("description")))
+	e.SetThumbnail(strings.TrimSpace(r.PostFormValue("thumbnail")))
+	e.SetCover(strings.TrimSpace(r.PostFormValue("cover")))
+	e.SetText(r.PostFormValue("text"))
+	e.SetLanguage(strings.TrimSpace(r.PostFormValue("language")))
+	e.SetDeleted(r.PostFormValue("deleted") != "")
+
+	var tags []string
+	for _, tag := range strings.Split(r.PostFormValue("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	e.SetTags(tags)
+
+	if format := r.PostFormValue("format"); format != "" {
+		e.SetFormat(format)
+	}
+
+	if status := r.PostFormValue("status"); status != "" {
+		if !ValidStatus(status) {
+			return invalid("Status", "Unknown entry status "+status)
+		}
+		e.SetStatus(status)
+	}
+
+	if _, ok := r.PostForm["date"]; ok {
+		if value := strings.TrimSpace(r.PostFormValue("date")); value == "" {
+			e.setDate(nil)
+		} else {
+			date, err := time.ParseInLocation("2006-01-02T15:04", value, h.location())
+			if err != nil {
+				return invalid("Date", "Invalid entry date "+value)
+			}
+			e.SetDate(date)
+		}
+	}
+
+	author := strings.TrimSpace(r.PostFormValue("author"))
+	if !session.HasRole(RoleEditor) {
+		if !create {
+			return nil
+		}
+		author = session.PersonUuid()
+	}
+	if author == "" || author == e.AuthorUUID() {
+		return nil
+	}
+	person, err := h.Manager.AccessManager().GetPersonCached(author, session)
+	if err != nil {
+		return err
+	}
+	if person == nil {
+		return invalid("Author", "No person has uuid "+author)
+	}
+	e.SetAuthor(person)
+	return nil
+}
+
+// change moves an entry to the trash, restores it from the trash or
+// purges it, as named by action.
+func (h *ManageHandler) change(w http.ResponseWriter, r *http.Request, session security.Session, e Entry, action string) {
+	var err error
+	next := h.prefix()
+	switch action {
+	case "delete":
+		err = h.Manager.DeleteEntryContext(r.Context(), e.Uuid(), session)
+	case "restore":
+		err = h.Manager.RestoreEntryContext(r.Context(), e.Uuid(), session)
+	case "purge":
+		err = h.Manager.PurgeEntryContext(r.Context(), e.Uuid(), session)
+		next += "/trash"
+	}
+	var forbidden *ErrForbidden
+	var invalid *ErrValidation
+	if errors.As(err, &forbidden) {
+		h.error(w, r, http.StatusForbidden, "blog-forbidden")
+		return
+	} else if errors.As(err, &invalid) {
+		h.error(w, r, http.StatusBadRequest, "")
+		return
+	} else if err != nil {
+		h.error(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// csrfToken returns the token of the request cookie, setting a new cookie
+// if the request has none.
+func (h *ManageHandler) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) >= 32 {
+		return c.Value
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     h.prefix(),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// validCSRF reports whether a submitted form repeats the token held in the
+// request cookie.
+func validCSRF(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil || len(c.Value) < 32 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.PostFormValue("csrf"))) == 1
+}
+
+// error shows an error page, with an optional message id explaining the
+// error.
+func (h *ManageHandler) error(w http.ResponseWriter, r *http.Request, code int, message string) {
+	h.render(w, r, "manage-error", code, &ManagePage{Title: http.StatusText(code), Error: message, Code: code})
+}
+
+// render executes a template into a buffer first, so that a template
+// error can still be reported with a 500 response. Templates are cloned so
+// that they can be translated for each request.
+func (h *ManageHandler) render(w http.ResponseWriter, r *http.Request, name string, code int, page *ManagePage) {
+	page.Prefix = h.prefix()
+	page.Code = code
+	page.Request = r
+
+	t := h.Templates
+	if t == nil {
+		t = DefaultManageTemplates()
+	}
+	t, err := t.Clone()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := t.Funcs(ManageTemplateFuncs(localizer(r), h.location())).ExecuteTemplate(&buf, name, page); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+}
+
+const defaultManageTemplates = `
+{{define "manage-header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{t .Title}} - {{t "manage-blog"}}</title>
+</head>
+<body>
+<header><h1>{{t "manage-blog"}}</h1>
+<nav><a href="{{.Prefix}}">{{t "blog-entries"}}</a> <a href="{{.Prefix}}/scheduled">{{t "blog-scheduled"}}</a> <a href="{{.Prefix}}/trash">{{t "blog-trash"}}</a> <a href="{{.Prefix}}/new">{{t "blog-new-entry"}}</a></nav>
+</header>
+<main>
+{{end}}
+
+{{define "manage-footer"}}</main>
+</body>
+</html>
+{{end}}
+
+{{define "manage"}}{{template "manage-header" .}}
+<h2>{{t .Title}}</h2>
+{{if not .Trash}}<form action="{{.Prefix}}" method="get">
+<label>{{t "blog-status"}} <select name="status"><option value="">{{t "blog-any"}}</option>{{range .Statuses}}<option value="{{.}}"{{if eq . $.Status}} selected{{end}}>{{status .}}</option>{{end}}</select></label>
+<label>{{t "blog-tags"}} <input name="tag" value="{{.Tag}}"></label>
+{{if .Editor}}<label>{{t "blog-author"}} <input name="author" value="{{.Author}}"></label>{{end}}
+<button>{{t "blog-filter"}}</button>
+</form>{{end}}
+<table>
+<tr><th>{{t "blog-title"}}</th><th>{{t "blog-date"}}</th><th>{{t "blog-author"}}</th><th>{{t "blog-status"}}</th><th></th></tr>
+{{range .Entries}}<tr>
+<td><a href="{{$.Prefix}}/edit/{{.Uuid}}">{{.Title}}</a></td>
+<td>{{date .Date}}</td>
+<td>{{with .Author}}{{.DisplayName}}{{end}}</td>
+<td>{{status .Status}}{{if .Deleted}} ({{t "blog-deleted"}}){{end}}</td>
+<td>{{if .Deleted}}<form action="{{$.Prefix}}/restore/{{.Uuid}}" method="post"><input type="hidden" name="csrf" value="{{$.CSRF}}"><button>{{t "blog-restore"}}</button></form> <form action="{{$.Prefix}}/purge/{{.Uuid}}" method="post"><input type="hidden" name="csrf" value="{{$.CSRF}}"><button>{{t "blog-purge"}}</button></form>{{else}}<form action="{{$.Prefix}}/delete/{{.Uuid}}" method="post"><input type="hidden" name="csrf" value="{{$.CSRF}}"><button>{{t "blog-delete"}}</button></form>{{end}}</td>
+</tr>{{else}}<tr><td colspan="5">{{t "blog-no-entries"}}</td></tr>{{end}}
+</table>
+{{with .Next}}<nav><a href="{{.}}" rel="next">{{t "blog-older"}}</a></nav>{{end}}
+{{template "manage-footer" .}}{{end}}
+
+{{define "form"}}{{template "manage-header" .}}
+<h2>{{t .Title}}</h2>
+{{with .Error}}<p role="alert">{{.}}</p>{{end}}
+<form action="{{.Action}}" method="post">
+<input type="hidden" name="csrf" value="{{.CSRF}}">
+{{with .Entry}}<label>{{t "blog-title"}} <input name="title" value="{{.Title}}" required></label>
+<label>{{t "blog-slug"}} <input name="slug" value="{{.Slug}}"></label>
+<label>{{t "blog-description"}} <input name="description" value="{{.Description}}"></label>
+<label>{{t "blog-date"}} <input type="datetime-local" name="date" value="{{datetime .Date}}"></label>
+<label>{{t "blog-tags"}} <input name="tags" value="{{join .Tags}}"></label>
+{{if $.Editor}}<label>{{t "blog-author"}} <input name="author" value="{{.AuthorUUID}}"></label>{{end}}
+<label>{{t "blog-thumbnail"}} <input type="url" name="thumbnail" value="{{.Thumbnail}}"></label>
+<label>{{t "blog-cover"}} <input type="url" name="cover" value="{{.Cover}}"></label>
+<label>{{t "blog-language"}} <input name="language" value="{{.Language}}" placeholder="en"></label>
+<label>{{t "blog-format"}} <select name="format">{{$format := .Format}}{{range $.Formats}}<option{{if eq . $format}} selected{{end}}>{{.}}</option>{{end}}</select></label>
+<label>{{t "blog-status"}} <select name="status">{{$status := .Status}}{{range $.Statuses}}<option value="{{.}}"{{if eq . $status}} selected{{end}}>{{status .}}</option>{{end}}</select></label>
+<label><input type="checkbox" name="deleted" value="1"{{if .Deleted}} checked{{end}}> {{t "blog-deleted"}}</label>
+<label>{{t "blog-text"}} <textarea name="text" rows="20" required>{{.Text}}</textarea></label>{{end}}
+<button>{{t "blog-save"}}</button>
+</form>
+{{template "manage-footer" .}}{{end}}
+
+{{define "manage-error"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{with .Error}}<p>{{t .}}</p>{{end}}
+</body>
+</html>
+{{end}}
+`
@@ -0,0 +1,200 @@
+package blog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gitlab.com/montebo/security"
+)
+
+func TestManageHandler(t *testing.T) {
+	am := newTestAccessManager()
+	bm := NewMemoryBlogManager(am)
+	hidden := ShowHidden(context.Background())
+	editor := &testSession{site: "manage.com", personUuid: "p1", authenticated: true, roles: []string{RoleEditor}}
+	author := &testSession{site: "manage.com", personUuid: "p2", authenticated: true, roles: []string{RoleAuthor}}
+	p1 := am.addPerson("p1", "Jane", "Li")
+	am.addPerson("p2", "William", "Wang")
+
+	published := bm.NewEntry()
+	published.SetTitle("Published post")
+	published.SetText("Some text")
+	published.SetDate(*StringToDatePointer("2001/1/1"))
+	published.SetAuthor(p1)
+	published.SetStatus(StatusPublished)
+	if err := bm.AddEntry(published, editor); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+	future := bm.NewEntry()
+	future.SetTitle("Future post")
+	future.SetText("Some text")
+	future.SetDate(*StringToDatePointer("2100/1/1"))
+	future.SetAuthor(p1)
+	if err := bm.AddEntry(future, editor); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+
+	var session security.Session
+	h := NewManageHandler(bm, func(r *http.Request) (security.Session, error) {
+		return session, nil
+	})
+
+	const token = "0123456789abcdef0123456789abcdef"
+	do := func(method, target string, form url.Values, header ...string) *httptest.ResponseRecorder {
+		var r *http.Request
+		if form != nil {
+			r = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(method, target, nil)
+		}
+		r.AddCookie(&http.Cookie{Name: csrfCookie, Value: token})
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	session = &testSession{site: "manage.com"}
+	if w := do("GET", "/blog/manage", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("GET by anonymous session returned %d", w.Code)
+	}
+	session = &testSession{site: "manage.com", personUuid: "p3", authenticated: true}
+	if w := do("GET", "/blog/manage", nil); w.Code != http.StatusForbidden {
+		t.Errorf("GET by session without a blog role returned %d", w.Code)
+	}
+
+	session = editor
+	w := do("GET", "/blog/manage", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Published post") || !strings.Contains(w.Body.String(), "Future post") {
+		t.Errorf("GET /blog/manage returned %d %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/blog/manage?status=draft", nil); strings.Contains(w.Body.String(), "Published post") || !strings.Contains(w.Body.String(), "Future post") {
+		t.Errorf("status filter returned %s", w.Body.String())
+	}
+	if w := do("GET", "/blog/manage/scheduled", nil); strings.Contains(w.Body.String(), "Published post") || !strings.Contains(w.Body.String(), "Future post") {
+		t.Errorf("scheduled entries returned %s", w.Body.String())
+	}
+	if w := do("GET", "/blog/manage", nil, "Accept-Language", "zh-TW"); !strings.Contains(w.Body.String(), "文章") {
+		t.Errorf("page was not translated: %s", w.Body.String())
+	}
+
+	form := url.Values{
+		"title":     {"New post"},
+		"text":      {"New *text*"},
+		"date":      {"2002-03-04T05:06"},
+		"tags":      {"go, news"},
+		"author":    {"p2"},
+		"status":    {StatusPublished},
+		"format":    {FormatMarkdown},
+		"thumbnail": {"https://example.com/t.png"},
+	}
+	if w := do("POST", "/blog/manage/new", form); w.Code != http.StatusForbidden {
+		t.Errorf("POST without a CSRF token returned %d", w.Code)
+	}
+	form.Set("csrf", "fedcba9876543210fedcba9876543210")
+	if w := do("POST", "/blog/manage/new", form); w.Code != http.StatusForbidden {
+		t.Errorf("POST with the wrong CSRF token returned %d", w.Code)
+	}
+	form.Set("csrf", token)
+	if w := do("POST", "/blog/manage/new", form); w.Code != http.StatusSeeOther {
+		t.Fatalf("POST /blog/manage/new returned %d %s", w.Code, w.Body.String())
+	}
+	created, err := bm.GetEntryBySlug("new-post", editor)
+	if err != nil || created == nil {
+		t.Fatalf("POST /blog/manage/new did not create an entry: %v", err)
+	}
+	if created.AuthorUUID() != "p2" || created.Status() != StatusPublished || strings.Join(created.Tags(), "|") != "go|news" ||
+		created.Date().Format("2006-01-02 15:04") != "2002-03-04 05:06" || created.Thumbnail() != "https://example.com/t.png" {
+		t.Errorf("POST /blog/manage/new saved %+v", created)
+	}
+
+	form.Set("title", "")
+	if w := do("POST", "/blog/manage/edit/"+created.Uuid(), form); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Entry must have a title") {
+		t.Errorf("invalid form returned %d %s", w.Code, w.Body.String())
+	}
+	form.Set("title", "New post")
+	form.Set("date", "not a date")
+	form.Set("tags", "changed")
+	if w := do("POST", "/blog/manage/edit/"+created.Uuid(), form); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid entry date") {
+		t.Errorf("invalid date returned %d %s", w.Code, w.Body.String())
+	}
+	if e, _ := bm.GetEntryContext(hidden, created.Uuid(), editor); strings.Join(e.Tags(), "|") != "go|news" || e.Date() == nil {
+		t.Errorf("form that was not saved changed the entry to %+v", e)
+	}
+	form.Set("tags", "go, news")
+	form.Set("status", StatusDraft)
+	form.Set("date", "")
+	if w := do("POST", "/blog/manage/edit/"+created.Uuid(), form); w.Code != http.StatusSeeOther {
+		t.Fatalf("POST edit without a date returned %d %s", w.Code, w.Body.String())
+	}
+	if e, _ := bm.GetEntryContext(hidden, created.Uuid(), editor); e.Date() != nil {
+		t.Errorf("empty date field did not clear the date, found %v", e.Date())
+	}
+	form.Set("status", StatusPublished)
+	form.Set("date", "2002-03-04T05:06")
+	form.Set("slug", "manage")
+	if w := do("POST", "/blog/manage/edit/"+created.Uuid(), form); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "reserved") {
+		t.Errorf("reserved slug returned %d %s", w.Code, w.Body.String())
+	}
+	form.Set("slug", "chosen-slug")
+	if w := do("POST", "/blog/manage/edit/"+created.Uuid(), form); w.Code != http.StatusSeeOther {
+		t.Fatalf("POST edit returned %d %s", w.Code, w.Body.String())
+	}
+	if e, _ := bm.GetEntryContext(hidden, created.Uuid(), editor); e.Slug() != "chosen-slug" {
+		t.Errorf("POST edit did not change the slug, found %q", e.Slug())
+	}
+
+	if w := do("POST", "/blog/manage/delete/"+created.Uuid(), url.Values{"csrf": {token}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("POST delete returned %d", w.Code)
+	}
+	if e, _ := bm.GetEntryContext(hidden, created.Uuid(), editor); !e.Deleted() {
+		t.Errorf("POST delete did not delete the entry")
+	}
+	if w := do("POST", "/blog/manage/restore/"+created.Uuid(), url.Values{"csrf": {token}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("POST restore returned %d", w.Code)
+	}
+	if e, _ := bm.GetEntryContext(hidden, created.Uuid(), editor); e.Deleted() {
+		t.Errorf("POST restore did not restore the entry")
+	}
+	if w := do("GET", "/blog/manage/delete/"+created.Uuid(), nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET delete returned %d", w.Code)
+	}
+
+	if w := do("POST", "/blog/manage/purge/"+future.Uuid(), url.Values{"csrf": {token}}); w.Code != http.StatusBadRequest {
+		t.Errorf("POST purge of an entry not in the trash returned %d", w.Code)
+	}
+	if w := do("POST", "/blog/manage/delete/"+future.Uuid(), url.Values{"csrf": {token}}); w.Code != http.StatusSeeOther {
+		t.Fatalf("POST delete returned %d", w.Code)
+	}
+	if w := do("GET", "/blog/manage/trash", nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Future post") || strings.Contains(w.Body.String(), "New post") {
+		t.Errorf("GET trash returned %d %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/blog/manage/purge/"+future.Uuid(), url.Values{"csrf": {token}}); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/blog/manage/trash" {
+		t.Fatalf("POST purge returned %d", w.Code)
+	}
+	if _, err := bm.GetEntryContext(hidden, future.Uuid(), editor); err != ErrNotFound {
+		t.Errorf("POST purge did not remove the entry: %v", err)
+	}
+
+	session = author
+	w = do("GET", "/blog/manage", nil)
+	if strings.Contains(w.Body.String(), "Published post") || !strings.Contains(w.Body.String(), "New post") {
+		t.Errorf("author should only see their own entries: %s", w.Body.String())
+	}
+	if w := do("GET", "/blog/manage/edit/"+published.Uuid(), nil); w.Code != http.StatusForbidden {
+		t.Errorf("author editing another person's entry returned %d", w.Code)
+	}
+	if w := do("GET", "/blog/manage/edit/"+created.Uuid(), nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `value="New post"`) {
+		t.Errorf("author editing their entry returned %d", w.Code)
+	}
+	if w := do("GET", "/blog/manage/edit/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("editing a missing entry returned %d", w.Code)
+	}
+}
@@ -0,0 +1,933 @@
+package blog
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/montebo/security"
+)
+
+// NewMemoryBlogManager returns a BlogManager that keeps every entry in
+// process memory. It has the same semantics as the Datastore and Cassandra
+// implementations and is intended for unit tests and local development.
+// Its Context methods fail if the context is done when they are called, but
+// are otherwise too quick to be worth interrupting.
+func NewMemoryBlogManager(am security.AccessManager) *MemoryBlogManager {
+	s := &MemoryBlogManager{
+		am:        am,
+		sites:     make(map[string]map[string]*GaeEntry),
+		revisions: make(map[string]map[string][]*Revision),
+		moved:     make(map[string]map[string]string),
+	}
+
+	activateBlogPlugin(am)
+
+	return s
+}
+
+type MemoryBlogManager struct {
+	am        security.AccessManager
+	lock      sync.RWMutex
+	sites     map[string]map[string]*GaeEntry
+	revisions map[string]map[string][]*Revision
+	moved     map[string]map[string]string // site -> previous slug -> uuid
+}
+
+func (bm *MemoryBlogManager) NewEntry() Entry {
+	return &GaeEntry{}
+}
+
+func (bm *MemoryBlogManager) AccessManager() security.AccessManager {
+	return bm.am
+}
+
+// copyEntry returns a copy of a stored entry so that callers can not modify
+// the stored record without calling UpdateEntry.
+func (bm *MemoryBlogManager) copyEntry(e *GaeEntry, session security.Session) (*GaeEntry, error) {
+	entry := e.clone()
+	entry.author = nil
+
+	if entry.authorUuid != "" {
+		author, err := bm.am.GetPersonCached(entry.authorUuid, session)
+		if err != nil {
+			return nil, err
+		}
+		entry.author = author
+	}
+
+	return entry, nil
+}
+
+// filter returns a copy of every entry on the session site that a read
+// with ctx may return and that is accepted by the match function, sorted
+// most recent first.
+func (bm *MemoryBlogManager) filter(ctx context.Context, session security.Session, match func(e *GaeEntry) bool) ([]Entry, error) {
+	bm.lock.RLock()
+	defer bm.lock.RUnlock()
+
+	now := time.Now()
+	var items []Entry
+	for _, e := range bm.sites[session.Site()] {
+		if !canSee(ctx, e, session, now) || !match(e) {
+			continue
+		}
+		entry, err := bm.copyEntry(e, session)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entry)
+	}
+
+	sortEntries(items)
+
+	return items, nil
+}
+
+func (bm *MemoryBlogManager) GetEntryContext(ctx context.Context, uuid string, session security.Session) (Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	bm.lock.RLock()
+	defer bm.lock.RUnlock()
+
+	e, ok := bm.sites[session.Site()][uuid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := checkVisible(ctx, e, session); err != nil {
+		return nil, err
+	}
+
+	return bm.copyEntry(e, session)
+}
+
+func (bm *MemoryBlogManager) GetEntryCachedContext(ctx context.Context, uuid string, session security.Session) (Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	if uuid == "" {
+		return nil, ErrNotFound
+	}
+
+	return bm.GetEntryContext(ctx, uuid, session)
+}
+
+func (bm *MemoryBlogManager) GetEntryBySlugContext(ctx context.Context, slug string, session security.Session) (Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	bm.lock.RLock()
+	defer bm.lock.RUnlock()
+
+	for _, e := range bm.sites[session.Site()] {
+		if e.slug != slug {
+			continue
+		}
+		if err := checkVisible(ctx, e, session); err != nil {
+			return nil, err
+		}
+		return bm.copyEntry(e, session)
+	}
+
+	return nil, ErrNotFound
+}
+
+func (bm *MemoryBlogManager) GetEntryBySlugCachedContext(ctx context.Context, slug string, session security.Session) (Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	if slug == "" {
+		return nil, ErrNotFound
+	}
+
+	return bm.GetEntryBySlugContext(ctx, slug, session)
+}
+
+func (bm *MemoryBlogManager) ResolveSlugContext(ctx context.Context, slug string, session security.Session) (Entry, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return resolveSlug(ctx, bm, slug, session, func(slug string) (string, error) {
+		bm.lock.RLock()
+		defer bm.lock.RUnlock()
+		return bm.moved[session.Site()][slug], nil
+	})
+}
+
+func (bm *MemoryBlogManager) GetEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	return bm.filter(ctx, session, func(e *GaeEntry) bool {
+		return true
+	})
+}
+
+func (bm *MemoryBlogManager) GetRecentEntriesContext(ctx context.Context, limit int, session security.Session) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	now := time.Now()
+	items, err := bm.filter(ctx, session, func(e *GaeEntry) bool {
+		return e.date != nil && e.date.Before(now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) > limit {
+		return items[0:limit], nil
+	}
+	return items, nil
+}
+
+func (bm *MemoryBlogManager) GetFutureEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	now := time.Now()
+	return bm.filter(ctx, session, func(e *GaeEntry) bool {
+		return e.date != nil && e.date.After(now)
+	})
+}
+
+func (bm *MemoryBlogManager) GetEntriesByTagContext(ctx context.Context, tag string, limit int, session security.Session) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	tag = tagKey(tag)
+	if tag == "" {
+		return nil, nil
+	}
+
+	now := time.Now()
+	items, err := bm.filter(ctx, session, func(e *GaeEntry) bool {
+		return e.date != nil && e.date.Before(now) && containsString(e.SearchTags(), "tag:"+tag)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) > limit {
+		return items[0:limit], nil
+	}
+	return items, nil
+}
+
+// ListEntriesContext returns a page of entries, most recent first, and the
+// cursor of the next page. The cursor is empty on the last page.
+func (bm *MemoryBlogManager) ListEntriesContext(ctx context.Context, options ListOptions, session security.Session) ([]Entry, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if session == nil {
+		return nil, "", ErrInvalidSession
+	}
+
+	offset := 0
+	if options.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(options.Cursor)
+		if err != nil || offset < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	items, err := bm.filter(ctx, session, func(e *GaeEntry) bool {
+		return options.match(e)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if offset >= len(items) {
+		return nil, "", nil
+	}
+	items = items[offset:]
+	if len(items) > options.limit() {
+		return items[:options.limit()], strconv.Itoa(offset + options.limit()), nil
+	}
+	return items, "", nil
+}
+
+// GetEntriesByStatusContext returns all entries currently in a workflow
+// state, most recent first.
+func (bm *MemoryBlogManager) GetEntriesByStatusContext(ctx context.Context, status string, session security.Session) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	return bm.filter(ctx, session, func(e *GaeEntry) bool {
+		return e.Status() == status
+	})
+}
+
+func (bm *MemoryBlogManager) GetEntriesByAuthorContext(ctx context.Context, personUuid string, session security.Session) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	return bm.filter(ctx, session, func(e *GaeEntry) bool {
+		return e.authorUuid == personUuid
+	})
+}
+
+// SearchEntriesContext returns every entry matching a search query, most
+// relevant first.
+func (bm *MemoryBlogManager) SearchEntriesContext(ctx context.Context, query string, session security.Session) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	return searchAll(ctx, bm.searchIndex(session), query, session)
+}
+
+// SearchContext returns a page of the entries matching a search query,
+// most relevant first.
+func (bm *MemoryBlogManager) SearchContext(ctx context.Context, query string, options SearchOptions, session security.Session) (*SearchResults, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if session == nil {
+		return nil, ErrInvalidSession
+	}
+
+	return search(ctx, bm.searchIndex(session), query, options, session)
+}
+
+// memorySearchIndex is the search index of the entries on a site, built
+// when a search is made.
+type memorySearchIndex struct {
+	bm      *MemoryBlogManager
+	session security.Session
+	terms   map[string][]posting
+	count   int
+}
+
+func (bm *MemoryBlogManager) searchIndex(session security.Session) *memorySearchIndex {
+	bm.lock.RLock()
+	defer bm.lock.RUnlock()
+
+	index := &memorySearchIndex{bm: bm, session: session, terms: make(map[string][]posting)}
+	for _, e := range bm.sites[session.Site()] {
+		for term, p := range searchPostings(e) {
+			index.terms[term] = append(index.terms[term], *p)
+		}
+		index.count++
+	}
+	return index
+}
+
+func (index *memorySearchIndex) postings(term string, prefix bool) ([]posting, error) {
+	if !prefix {
+		return append([]posting{}, index.terms[term]...), nil
+	}
+	var items []posting
+	for t, postings := range index.terms {
+		if strings.HasPrefix(t, term) {
+			items = append(items, postings...)
+		}
+	}
+	return items, nil
+}
+
+func (index *memorySearchIndex) documents() (int, error) {
+	return index.count, nil
+}
+
+func (index *memorySearchIndex) entries(uuids []string) (map[string]Entry, error) {
+	index.bm.lock.RLock()
+	defer index.bm.lock.RUnlock()
+
+	items := make(map[string]Entry)
+	for _, uuid := range uuids {
+		if e, ok := index.bm.sites[index.session.Site()][uuid]; ok {
+			entry, err := index.bm.copyEntry(e, index.session)
+			if err != nil {
+				return nil, err
+			}
+			items[uuid] = entry
+		}
+	}
+	return items, nil
+}
+
+func (bm *MemoryBlogManager) AddEntryContext(ctx context.Context, entry Entry, session security.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if session == nil || !session.IsAuthenticated() {
+		return &security.ErrUnauthenticated{session}
+	}
+	if err := checkAuthor(entry.AuthorUUID(), session); err != nil {
+		return err
+	}
+
+	if err := validateEntry(entry); err != nil {
+		return err
+	}
+	if err := checkTransition("", entry.Status(), entry.Date(), session); err != nil {
+		return err
+	}
+
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	slug, err := uniqueSlug(entry.Slug(), entry.explicitSlug(), func(slug string) (bool, error) {
+		return bm.slugAvailable(session.Site(), slug, entry.Uuid()), nil
+	})
+	if err != nil {
+		return err
+	}
+	entry.setSlug(slug)
+
+	bulk := &security.GaeEntityAuditLogCollection{}
+	bulk.SetEntityUuidPersonUuid(entry.Uuid(), session.PersonUuid(), session.DisplayName())
+
+	if entry.Title() != "" {
+		bulk.AddItem("Title", "", entry.Title())
+	}
+
+	if entry.Description() != "" {
+		bulk.AddItem("Description", "", entry.Description())
+	}
+
+	if entry.Slug() != "" {
+		bulk.AddItem("Slug", "", entry.Slug())
+	}
+
+	if entry.Date() != nil {
+		bulk.AddDateItem("Date", nil, entry.Date())
+	}
+
+	if entry.Text() != "" {
+		bulk.AddItem("Text", "", entry.Text())
+	}
+
+	if entry.Format() != FormatMarkdown {
+		bulk.AddItem("Format", "", entry.Format())
+	}
+
+	if entry.Language() != "" {
+		bulk.AddItem("Language", "", entry.Language())
+	}
+
+	if entry.Thumbnail() != "" {
+		bulk.AddItem("Thumbnail", "", entry.Thumbnail())
+	}
+
+	if entry.Cover() != "" {
+		bulk.AddItem("Cover", "", entry.Cover())
+	}
+
+	if len(entry.Tags()) > 0 {
+		bulk.AddItem("Tags", "", strings.Join(entry.Tags(), ", "))
+	}
+
+	if entry.Author() != nil {
+		bulk.AddItem("Author", "", entry.Author().Uuid())
+	}
+
+	if entry.Deleted() {
+		bulk.AddBoolItem("Deleted", false, true)
+	}
+
+	if entry.Status() != StatusDraft {
+		bulk.AddItem("Status", "", entry.Status())
+	}
+
+	now := time.Now()
+	entry.setCreated(now)
+	entry.setUpdated(now)
+	if entry.Deleted() {
+		entry.setDeletedAt(&now)
+	} else {
+		entry.setDeletedAt(nil)
+	}
+
+	if err := bm.am.AddEntityChangeLog(bulk, session); err != nil {
+		return err
+	}
+
+	stored := &GaeEntry{
+		uuid:        entry.Uuid(),
+		title:       entry.Title(),
+		slug:        entry.Slug(),
+		description: entry.Description(),
+		thumbnail:   entry.Thumbnail(),
+		cover:       entry.Cover(),
+		date:        entry.Date(),
+		authorUuid:  entry.AuthorUUID(),
+		text:        entry.Text(),
+		html:        entry.Html(),
+		format:      entry.Format(),
+		language:    entry.Language(),
+		created:     entry.Created(),
+		updated:     entry.Updated(),
+		deleted:     entry.Deleted(),
+		deletedAt:   entry.DeletedAt(),
+		status:      entry.Status(),
+	}
+	if len(entry.Tags()) > 0 {
+		stored.tags = append([]string{}, entry.Tags()...)
+	}
+
+	site := bm.sites[session.Site()]
+	if site == nil {
+		site = make(map[string]*GaeEntry)
+		bm.sites[session.Site()] = site
+	}
+	site[stored.uuid] = stored
+	bm.addRevision(stored, session)
+
+	return nil
+}
+
+func (bm *MemoryBlogManager) UpdateEntryContext(ctx context.Context, entry Entry, session security.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if session == nil || !session.IsAuthenticated() {
+		return &security.ErrUnauthenticated{session}
+	}
+
+	if err := validateUpdate(ctx, entry); err != nil {
+		return err
+	}
+
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	stored, ok := bm.sites[session.Site()][entry.Uuid()]
+	if !ok {
+		return ErrNotFound
+	}
+	current := *stored
+	if err := checkAuthor(current.AuthorUUID(), session); err != nil {
+		return err
+	}
+	if err := checkAuthor(entry.AuthorUUID(), session); err != nil {
+		return err
+	}
+
+	bulk := &security.GaeEntityAuditLogCollection{}
+	bulk.SetEntityUuidPersonUuid(entry.Uuid(), session.PersonUuid(), session.DisplayName())
+
+	// A new date can publish a scheduled entry, so the status is compared
+	// as it was before any change.
+	status := current.Status()
+	if !security.MatchingDate(entry.Date(), current.Date()) {
+		bulk.AddDateItem("Date", current.Date(), entry.Date())
+		if entry.Date() == nil {
+			current.date = nil
+		} else {
+			current.SetDate(*entry.Date())
+		}
+	}
+
+	if entry.Status() != status {
+		if err := checkTransition(status, entry.Status(), current.Date(), session); err != nil {
+			return err
+		}
+		bulk.AddItem("Status", status, entry.Status())
+		current.SetStatus(entry.Status())
+	}
+
+	if entry.Slug() != current.Slug() {
+		slug, err := uniqueSlug(entry.Slug(), entry.explicitSlug(), func(slug string) (bool, error) {
+			return bm.slugAvailable(session.Site(), slug, current.uuid), nil
+		})
+		if err != nil {
+			return err
+		}
+		bulk.AddItem("Slug", current.Slug(), slug)
+		current.slug = slug
+		entry.setSlug(slug)
+	}
+
+	if entry.Title() != current.Title() {
+		bulk.AddItem("Title", current.Title(), entry.Title())
+		current.SetTitle(entry.Title())
+	}
+
+	if entry.Description() != current.Description() {
+		bulk.AddItem("Description", current.Description(), entry.Description())
+		current.SetDescription(entry.Description())
+	}
+
+	if entry.Text() != current.Text() {
+		bulk.AddItem("Text", current.Text(), entry.Text())
+		current.SetText(entry.Text())
+	}
+
+	if entry.Format() != current.Format() {
+		bulk.AddItem("Format", current.Format(), entry.Format())
+		current.SetFormat(entry.Format())
+	}
+
+	if entry.Language() != current.Language() {
+		bulk.AddItem("Language", current.Language(), entry.Language())
+		current.SetLanguage(entry.Language())
+	}
+
+	if entry.Thumbnail() != current.Thumbnail() {
+		bulk.AddItem("Thumbnail", current.Thumbnail(), entry.Thumbnail())
+		current.SetThumbnail(entry.Thumbnail())
+	}
+
+	if entry.Cover() != current.Cover() {
+		bulk.AddItem("Cover", current.Cover(), entry.Cover())
+		current.SetCover(entry.Cover())
+	}
+
+	if strings.Join(entry.Tags(), "|") != strings.Join(current.Tags(), "|") {
+		bulk.AddItem("Tags", strings.Join(current.Tags(), ", "), strings.Join(entry.Tags(), ", "))
+		current.SetTags(append([]string{}, entry.Tags()...))
+	}
+
+	if entry.AuthorUUID() != current.AuthorUUID() {
+		bulk.AddItem("Author", current.AuthorUUID(), entry.AuthorUUID())
+		current.authorUuid = entry.AuthorUUID()
+	}
+
+	if entry.Deleted() != current.Deleted() {
+		bulk.AddBoolItem("Deleted", current.Deleted(), entry.Deleted())
+		current.SetDeleted(entry.Deleted())
+	}
+
+	if bulk.HasUpdates() {
+		if err := bm.am.AddEntityChangeLog(bulk, session); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		current.updated = &now
+		if current.deleted != stored.deleted {
+			if current.deleted {
+				current.deletedAt = &now
+			} else {
+				current.deletedAt = nil
+			}
+		}
+		entry.setDeletedAt(current.deletedAt)
+		current.html = current.Html()
+		if current.slug != stored.slug && stored.slug != "" {
+			if bm.moved[session.Site()] == nil {
+				bm.moved[session.Site()] = make(map[string]string)
+			}
+			bm.moved[session.Site()][stored.slug] = current.uuid
+		}
+		*stored = current
+		bm.addRevision(stored, session)
+	}
+
+	return nil
+}
+
+// DeleteEntryContext moves a blog entry to the trash.
+func (bm *MemoryBlogManager) DeleteEntryContext(ctx context.Context, uuid string, session security.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return trashEntry(ctx, bm, uuid, true, session, bm.storedEntry(session))
+}
+
+// RestoreEntryContext moves a blog entry out of the trash.
+func (bm *MemoryBlogManager) RestoreEntryContext(ctx context.Context, uuid string, session security.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return trashEntry(ctx, bm, uuid, false, session, bm.storedEntry(session))
+}
+
+func (bm *MemoryBlogManager) GetDeletedEntriesContext(ctx context.Context, session security.Session) ([]Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return deletedEntries(ctx, bm, session)
+}
+
+// PurgeEntryContext removes a deleted blog entry from memory. Entity change
+// history is retained by the access manager.
+func (bm *MemoryBlogManager) PurgeEntryContext(ctx context.Context, uuid string, session security.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if uuid == "" {
+		return ErrNotFound
+	}
+	if session == nil || !session.IsAuthenticated() {
+		return &security.ErrUnauthenticated{session}
+	}
+
+	bm.lock.Lock()
+	defer bm.lock.Unlock()
+
+	stored, ok := bm.sites[session.Site()][uuid]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkPurge(stored, session); err != nil {
+		return err
+	}
+	delete(bm.sites[session.Site()], uuid)
+	delete(bm.revisions[session.Site()], uuid)
+
+	return nil
+}
+
+// storedEntry returns a function that reads a copy of an entry on the
+// session site whether or not the session may see it.
+func (bm *MemoryBlogManager) storedEntry(session security.Session) func(uuid string) (Entry, error) {
+	return func(uuid string) (Entry, error) {
+		bm.lock.RLock()
+		defer bm.lock.RUnlock()
+
+		e, ok := bm.sites[session.Site()][uuid]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		return bm.copyEntry(e, session)
+	}
+}
+
+// slugAvailable reports whether no entry other than uuid has a slug. The
+// caller must hold the lock.
+func (bm *MemoryBlogManager) slugAvailable(site, slug, uuid string) bool {
+	for _, e := range bm.sites[site] {
+		if e.slug == slug && e.uuid != uuid {
+			return false
+		}
+	}
+	return true
+}
+
+// addRevision records a snapshot of an entry. The caller must hold the
+// write lock.
+func (bm *MemoryBlogManager) addRevision(entry *GaeEntry, session security.Session) {
+	site := bm.revisions[session.Site()]
+	if site == nil {
+		site = make(map[string][]*Revision)
+		bm.revisions[session.Site()] = site
+	}
+	site[entry.uuid] = append(site[entry.uuid], &Revision{
+		Number:      len(site[entry.uuid]) + 1,
+		Entry:       snapshot(entry),
+		PersonUuid:  session.PersonUuid(),
+		DisplayName: session.DisplayName(),
+		Created:     *entry.Updated(),
+	})
+}
+
+// GetRevisionsContext returns every saved version of an entry, newest first.
+func (bm *MemoryBlogManager) GetRevisionsContext(ctx context.Context, uuid string, session security.Session) ([]*Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := checkRevisions(uuid, session, bm.storedEntry(session)); err != nil {
+		return nil, err
+	}
+
+	bm.lock.RLock()
+	defer bm.lock.RUnlock()
+
+	var items []*Revision
+	revisions := bm.revisions[session.Site()][uuid]
+	for i := len(revisions) - 1; i >= 0; i-- {
+		entry, err := bm.copyEntry(revisions[i].Entry.(*GaeEntry), session)
+		if err != nil {
+			return nil, err
+		}
+		r := *revisions[i]
+		r.Entry = entry
+		items = append(items, &r)
+	}
+
+	return items, nil
+}
+
+func (bm *MemoryBlogManager) GetRevisionContext(ctx context.Context, uuid string, revision int, session security.Session) (*Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	revisions, err := bm.GetRevisionsContext(ctx, uuid, session)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range revisions {
+		if r.Number == revision {
+			return r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// RestoreRevisionContext saves the content of an earlier revision as the
+// current version of an entry.
+func (bm *MemoryBlogManager) RestoreRevisionContext(ctx context.Context, uuid string, revision int, session security.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return restoreRevision(ctx, bm, uuid, revision, session)
+}
+
+// The methods below call their Context variants with a background context.
+
+func (bm *MemoryBlogManager) GetEntry(uuid string, session security.Session) (Entry, error) {
+	return bm.GetEntryContext(context.Background(), uuid, session)
+}
+
+func (bm *MemoryBlogManager) GetEntryCached(uuid string, session security.Session) (Entry, error) {
+	return bm.GetEntryCachedContext(context.Background(), uuid, session)
+}
+
+func (bm *MemoryBlogManager) GetEntryBySlug(slug string, session security.Session) (Entry, error) {
+	return bm.GetEntryBySlugContext(context.Background(), slug, session)
+}
+
+func (bm *MemoryBlogManager) GetEntryBySlugCached(slug string, session security.Session) (Entry, error) {
+	return bm.GetEntryBySlugCachedContext(context.Background(), slug, session)
+}
+
+func (bm *MemoryBlogManager) ResolveSlug(slug string, session security.Session) (Entry, string, error) {
+	return bm.ResolveSlugContext(context.Background(), slug, session)
+}
+
+func (bm *MemoryBlogManager) GetEntries(session security.Session) ([]Entry, error) {
+	return bm.GetEntriesContext(context.Background(), session)
+}
+
+func (bm *MemoryBlogManager) GetRecentEntries(limit int, session security.Session) ([]Entry, error) {
+	return bm.GetRecentEntriesContext(context.Background(), limit, session)
+}
+
+func (bm *MemoryBlogManager) GetFutureEntries(session security.Session) ([]Entry, error) {
+	return bm.GetFutureEntriesContext(context.Background(), session)
+}
+
+func (bm *MemoryBlogManager) GetEntriesByTag(tag string, limit int, session security.Session) ([]Entry, error) {
+	return bm.GetEntriesByTagContext(context.Background(), tag, limit, session)
+}
+
+func (bm *MemoryBlogManager) ListEntries(options ListOptions, session security.Session) ([]Entry, string, error) {
+	return bm.ListEntriesContext(context.Background(), options, session)
+}
+
+func (bm *MemoryBlogManager) GetEntriesByStatus(status string, session security.Session) ([]Entry, error) {
+	return bm.GetEntriesByStatusContext(context.Background(), status, session)
+}
+
+func (bm *MemoryBlogManager) GetEntriesByAuthor(personUuid string, session security.Session) ([]Entry, error) {
+	return bm.GetEntriesByAuthorContext(context.Background(), personUuid, session)
+}
+
+func (bm *MemoryBlogManager) SearchEntries(query string, session security.Session) ([]Entry, error) {
+	return bm.SearchEntriesContext(context.Background(), query, session)
+}
+
+func (bm *MemoryBlogManager) Search(query string, options SearchOptions, session security.Session) (*SearchResults, error) {
+	return bm.SearchContext(context.Background(), query, options, session)
+}
+
+func (bm *MemoryBlogManager) AddEntry(entry Entry, session security.Session) error {
+	return bm.AddEntryContext(context.Background(), entry, session)
+}
+
+func (bm *MemoryBlogManager) UpdateEntry(entry Entry, session security.Session) error {
+	return bm.UpdateEntryContext(context.Background(), entry, session)
+}
+
+func (bm *MemoryBlogManager) DeleteEntry(uuid string, session security.Session) error {
+	return bm.DeleteEntryContext(context.Background(), uuid, session)
+}
+
+func (bm *MemoryBlogManager) RestoreEntry(uuid string, session security.Session) error {
+	return bm.RestoreEntryContext(context.Background(), uuid, session)
+}
+
+func (bm *MemoryBlogManager) GetDeletedEntries(session security.Session) ([]Entry, error) {
+	return bm.GetDeletedEntriesContext(context.Background(), session)
+}
+
+func (bm *MemoryBlogManager) PurgeEntry(uuid string, session security.Session) error {
+	return bm.PurgeEntryContext(context.Background(), uuid, session)
+}
+
+func (bm *MemoryBlogManager) GetRevisions(uuid string, session security.Session) ([]*Revision, error) {
+	return bm.GetRevisionsContext(context.Background(), uuid, session)
+}
+
+func (bm *MemoryBlogManager) GetRevision(uuid string, revision int, session security.Session) (*Revision, error) {
+	return bm.GetRevisionContext(context.Background(), uuid, revision, session)
+}
+
+func (bm *MemoryBlogManager) RestoreRevision(uuid string, revision int, session security.Session) error {
+	return bm.RestoreRevisionContext(context.Background(), uuid, revision, session)
+}
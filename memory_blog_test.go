@@ -0,0 +1,268 @@
+package blog
+
+import (
+	"context"
+	"testing"
+
+	"gitlab.com/montebo/security"
+)
+
+// TestMemoryBlogEntry tests the in-memory blog manager without needing any
+// external services.
+func TestMemoryBlogEntry(t *testing.T) {
+	am := newTestAccessManager()
+	bm := NewMemoryBlogManager(am)
+
+	hidden := ShowHidden(context.Background())
+	session := &testSession{site: "memory.com", personUuid: "p0", authenticated: true, roles: []string{RoleEditor}}
+	other := &testSession{site: "other.com", personUuid: "p0", authenticated: true, roles: []string{RoleEditor}}
+
+	p1 := am.addPerson("p1", "Jane", "Li")
+	p2 := am.addPerson("p2", "William", "Wang")
+
+	entry0 := bm.NewEntry()
+	entry0.SetStatus(StatusPublished)
+	entry0.SetTitle("A Title")
+	entry0.SetDescription("Simple description")
+	entry0.SetText("Does _this_ blog entry need some *text*?")
+	entry0.SetDate(*StringToDatePointer("2000/1/1"))
+	entry0.SetAuthor(p1)
+	entry0.SetTags([]string{"a", "b"})
+	if err := bm.AddEntry(entry0, session); err != nil {
+		t.Fatalf("AddEntry() failed unexpectedly: %v", err)
+	}
+
+	entry1 := bm.NewEntry()
+	entry1.SetStatus(StatusPublished)
+	entry1.SetTitle("First entry")
+	entry1.SetText("Some *text* for this blog.")
+	entry1.SetDate(*StringToDatePointer("2000/1/2"))
+	entry1.SetTags([]string{"b", "c"})
+	entry1.SetAuthor(p2)
+	if err := bm.AddEntry(entry1, session); err != nil {
+		t.Fatalf("AddEntry() failed unexpectedly: %v", err)
+	}
+
+	entry2 := bm.NewEntry()
+	entry2.SetStatus(StatusPublished)
+	entry2.SetTitle("Second entry")
+	entry2.SetText("Sample _text_ for blog.")
+	entry2.SetDate(*StringToDatePointer("2100/1/1"))
+	entry2.SetAuthor(p2)
+	if err := bm.AddEntry(entry2, session); err != nil {
+		t.Fatalf("AddEntry() failed unexpectedly: %v", err)
+	}
+
+	if len(am.changes) != 3 {
+		t.Fatalf("AddEntry() should write 3 change logs, not %d", len(am.changes))
+	}
+
+	if err := bm.AddEntry(bm.NewEntry(), session); err == nil {
+		t.Fatalf("AddEntry() should fail for an entry without a title")
+	}
+	if err := bm.AddEntry(bm.NewEntry(), &testSession{site: "memory.com"}); err == nil {
+		t.Fatalf("AddEntry() should fail for an unauthenticated session")
+	}
+
+	{
+		ev, err := bm.GetEntry(entry0.Uuid(), session)
+		if err != nil {
+			t.Fatalf("GetEntry() failed unexpectedly: %v", err)
+		}
+		if ev == nil || ev.Title() != "A Title" {
+			t.Fatalf("GetEntry() returned %v", ev)
+		}
+		if ev.Author() == nil || ev.Author().FirstName() != "Jane" {
+			t.Fatalf("GetEntry() did not load the entry author")
+		}
+		ev, err = bm.GetEntry(entry0.Uuid(), other)
+		if err != ErrNotFound {
+			t.Fatalf("GetEntry() returned %v, want ErrNotFound", err)
+		}
+		if ev != nil {
+			t.Fatalf("GetEntry() returned an entry belonging to a different site")
+		}
+	}
+
+	{
+		ev, err := bm.GetEntryBySlugCached("a-title", session)
+		if err != nil {
+			t.Fatalf("GetEntryBySlugCached() failed unexpectedly: %v", err)
+		}
+		if ev == nil || ev.Uuid() != entry0.Uuid() {
+			t.Fatalf("GetEntryBySlugCached() returned %v", ev)
+		}
+		ev, err = bm.GetEntryBySlug("a-title-archie", session)
+		if err != ErrNotFound {
+			t.Fatalf("GetEntryBySlug() returned %v, want ErrNotFound", err)
+		}
+		if ev != nil {
+			t.Fatalf("GetEntryBySlug() should return nil")
+		}
+	}
+
+	{
+		items, err := bm.GetRecentEntries(10, session)
+		if err != nil {
+			t.Fatalf("GetRecentEntries() failed unexpectedly: %v", err)
+		}
+		if len(items) != 2 || items[0].Uuid() != entry1.Uuid() || items[1].Uuid() != entry0.Uuid() {
+			t.Fatalf("GetRecentEntries() returned incorrect entries: %v", items)
+		}
+		items, _ = bm.GetRecentEntries(1, session)
+		if len(items) != 1 {
+			t.Fatalf("GetRecentEntries() should respect limit, returned %d", len(items))
+		}
+		items, _ = bm.GetFutureEntriesContext(hidden, session)
+		if len(items) != 1 || items[0].Uuid() != entry2.Uuid() {
+			t.Fatalf("GetFutureEntries() returned incorrect entries: %v", items)
+		}
+		items, _ = bm.GetEntries(other)
+		if len(items) != 0 {
+			t.Fatalf("GetEntries() returned %d entries belonging to a different site", len(items))
+		}
+	}
+
+	{
+		items, _ := bm.GetEntriesByTag(" B ", 10, session)
+		if len(items) != 2 {
+			t.Fatalf("GetEntriesByTag() should return 2 entries, not %d", len(items))
+		}
+		items, _ = bm.GetEntriesByAuthorContext(hidden, p2.Uuid(), session)
+		if len(items) != 2 || items[0].Uuid() != entry2.Uuid() {
+			t.Fatalf("GetEntriesByAuthor() returned incorrect entries: %v", items)
+		}
+		items, _ = bm.SearchEntries("First ENTRY", session)
+		if len(items) != 1 || items[0].Uuid() != entry1.Uuid() {
+			t.Fatalf("SearchEntries() returned incorrect entries: %v", items)
+		}
+	}
+
+	{
+		ev, _ := bm.GetEntry(entry1.Uuid(), session)
+		ev.SetTitle("Updated title")
+		ev.SetText("t2")
+		if err := bm.UpdateEntry(ev, session); err != nil {
+			t.Fatalf("UpdateEntry() failed unexpectedly: %v", err)
+		}
+		if len(am.changes) != 4 {
+			t.Fatalf("UpdateEntry() should write a change log")
+		}
+		ev, _ = bm.GetEntry(entry1.Uuid(), session)
+		if ev.Title() != "Updated title" || ev.Text() != "t2" {
+			t.Fatalf("UpdateEntry() did not save changes: %v %v", ev.Title(), ev.Text())
+		}
+		if ev.Slug() != "first-entry" {
+			t.Fatalf("UpdateEntry() should not change the slug, returned %v", ev.Slug())
+		}
+		if err := bm.UpdateEntry(ev, other); err == nil {
+			t.Fatalf("UpdateEntry() should fail for an entry belonging to a different site")
+		}
+	}
+
+	{
+		if err := bm.DeleteEntry(entry2.Uuid(), session); err != nil {
+			t.Fatalf("DeleteEntry() failed unexpectedly: %v", err)
+		}
+		if err := bm.DeleteEntry("missing", session); err == nil {
+			t.Fatalf("DeleteEntry() should fail for a missing entry")
+		}
+		items, _ := bm.GetEntries(session)
+		if len(items) != 2 {
+			t.Fatalf("DeleteEntry() did not hide the entry")
+		}
+		items, _ = bm.GetDeletedEntries(session)
+		if len(items) != 1 || items[0].Uuid() != entry2.Uuid() {
+			t.Fatalf("DeleteEntry() did not move the entry to the trash")
+		}
+	}
+
+	{
+		// Entries saved before they had to be valid can still be moved
+		// into and out of the trash.
+		bm.sites[session.Site()][entry1.Uuid()].text = ""
+		changes := len(am.changes)
+		if err := bm.DeleteEntry(entry1.Uuid(), session); err != nil {
+			t.Fatalf("DeleteEntry() of an invalid entry failed: %v", err)
+		}
+		if err := bm.RestoreEntry(entry1.Uuid(), session); err != nil {
+			t.Fatalf("RestoreEntry() of an invalid entry failed: %v", err)
+		}
+		if len(am.changes) != changes+2 {
+			t.Fatalf("DeleteEntry() and RestoreEntry() should write 2 change logs, not %d", len(am.changes)-changes)
+		}
+		ev, _ := bm.GetEntry(entry1.Uuid(), session)
+		if err := bm.UpdateEntry(ev, session); err == nil {
+			t.Fatalf("UpdateEntry() of an invalid entry should fail")
+		}
+	}
+}
+
+// testAccessManager implements the parts of security.AccessManager used by
+// the blog package.
+type testAccessManager struct {
+	security.AccessManager
+	people  map[string]security.Person
+	errs    map[string]error
+	changes []*security.GaeEntityAuditLogCollection
+}
+
+func newTestAccessManager() *testAccessManager {
+	return &testAccessManager{people: make(map[string]security.Person)}
+}
+
+func (am *testAccessManager) addPerson(uuid, firstName, lastName string) security.Person {
+	p := &testPerson{uuid: uuid, firstName: firstName, lastName: lastName}
+	am.people[uuid] = p
+	return p
+}
+
+func (am *testAccessManager) GetPersonCached(uuid string, session security.Session) (security.Person, error) {
+	if err := am.errs[uuid]; err != nil {
+		return nil, err
+	}
+	return am.people[uuid], nil
+}
+
+func (am *testAccessManager) AddEntityChangeLog(ec *security.GaeEntityAuditLogCollection, session security.Session) error {
+	am.changes = append(am.changes, ec)
+	return nil
+}
+
+type testPerson struct {
+	security.Person
+	uuid      string
+	firstName string
+	lastName  string
+}
+
+func (p *testPerson) Uuid() string      { return p.uuid }
+func (p *testPerson) FirstName() string { return p.firstName }
+func (p *testPerson) LastName() string  { return p.lastName }
+func (p *testPerson) DisplayName() string {
+	return p.firstName + " " + p.lastName
+}
+
+type testSession struct {
+	security.Session
+	site          string
+	personUuid    string
+	authenticated bool
+	roles         []string
+	locale        string
+}
+
+func (s *testSession) Site() string          { return s.site }
+func (s *testSession) PersonUuid() string    { return s.personUuid }
+func (s *testSession) DisplayName() string   { return s.personUuid }
+func (s *testSession) IsAuthenticated() bool { return s.authenticated }
+func (s *testSession) Locale() string        { return s.locale }
+
+func (s *testSession) HasRole(uid ...string) bool {
+	for _, r := range uid {
+		if containsString(s.roles, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,424 @@
+package blog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zaddok/log"
+)
+
+// Cache keys are stored in Redis with redisKeyPrefix, and removed keys are
+// published to every process on redisInvalidateChannel.
+const (
+	redisKeyPrefix         = "blog:"
+	redisInvalidateChannel = "blog:invalidate"
+)
+
+// redisTimeout limits how long a Redis command may take when the context
+// has no earlier deadline, redisRetry is how long to wait before
+// reconnecting a lost subscription, and redisConns is the most idle
+// connections kept open.
+const (
+	redisTimeout = 5 * time.Second
+	redisRetry   = time.Second
+	redisConns   = 8
+)
+
+var errRedisClosed = errors.New("Redis cache is closed")
+
+// RedisCache is a Cache shared by every process connected to the same
+// Redis server, or any server that speaks the Redis protocol. Entries are
+// also held in process memory. When a process removes an entry, the key is
+// published to the other processes so that they drop their copy.
+type RedisCache struct {
+	addr  string
+	ttl   time.Duration
+	local *memoryCache
+	log   log.Log
+	conns chan *redisConn
+
+	lock   sync.Mutex
+	sub    *redisConn
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewRedisCache connects to the Redis server at addr and subscribes to
+// invalidation messages. options.Size limits the entries held in process
+// memory, and options.TTL is the expiry of entries both in memory and in
+// Redis. Cache failures are logged to log if it is not nil.
+func NewRedisCache(addr string, options CacheOptions, log log.Log) (*RedisCache, error) {
+	c := &RedisCache{
+		addr:  addr,
+		ttl:   options.ttl(),
+		local: NewMemoryCache(options).(*memoryCache),
+		log:   log,
+		conns: make(chan *redisConn, redisConns),
+		done:  make(chan struct{}),
+	}
+
+	if _, err := c.do(context.Background(), "PING"); err != nil {
+		return nil, err
+	}
+	sub, err := c.subscribe()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.sub = sub
+
+	c.wg.Add(1)
+	go c.listen(sub)
+
+	return c, nil
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (Entry, bool) {
+	if entry, ok := c.local.Get(ctx, key); ok {
+		return entry, true
+	}
+
+	reply, err := c.do(ctx, "GET", redisKeyPrefix+key)
+	if err != nil {
+		c.warning("Blog cache read failed. %v", err)
+		return nil, false
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, false
+	}
+	entry, err := decodeCachedEntry(data)
+	if err != nil {
+		c.warning("Blog cache entry %s is invalid. %v", key, err)
+		return nil, false
+	}
+
+	c.local.Set(ctx, key, entry)
+	return entry, true
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, entry Entry) {
+	c.local.Set(ctx, key, entry)
+
+	data, err := encodeCachedEntry(entry)
+	if err != nil {
+		c.warning("Blog cache entry %s can not be stored. %v", key, err)
+		return
+	}
+	ttl := strconv.FormatInt(int64(c.ttl/time.Millisecond), 10)
+	if _, err := c.do(ctx, "SET", redisKeyPrefix+key, string(data), "PX", ttl); err != nil {
+		c.warning("Blog cache write failed. %v", err)
+	}
+}
+
+func (c *RedisCache) Remove(ctx context.Context, key string) {
+	c.local.Remove(ctx, key)
+
+	if _, err := c.do(ctx, "DEL", redisKeyPrefix+key); err != nil {
+		c.warning("Blog cache removal of %s failed. %v", key, err)
+		return
+	}
+	if _, err := c.do(ctx, "PUBLISH", redisInvalidateChannel, key); err != nil {
+		c.warning("Blog cache invalidation of %s failed. %v", key, err)
+	}
+}
+
+// Close stops listening for invalidation messages and closes every
+// connection to the server.
+func (c *RedisCache) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	if c.sub != nil {
+		c.sub.Close()
+	}
+	c.lock.Unlock()
+
+	c.wg.Wait()
+	for {
+		select {
+		case conn := <-c.conns:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *RedisCache) warning(format string, a ...interface{}) {
+	if c.log != nil {
+		c.log.Warning(format, a...)
+	}
+}
+
+// do sends a command on a pooled connection and returns the reply.
+func (c *RedisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var conn *redisConn
+	select {
+	case <-c.done:
+		return nil, errRedisClosed
+	case conn = <-c.conns:
+	default:
+		var err error
+		if conn, err = dialRedis(ctx, c.addr); err != nil {
+			return nil, err
+		}
+	}
+
+	deadline := time.Now().Add(redisTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	reply, err := conn.do(deadline, args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// The connection may be part way through a reply.
+		conn.Close()
+		return nil, err
+	}
+
+	select {
+	case c.conns <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// subscribe opens a connection subscribed to invalidation messages.
+func (c *RedisCache) subscribe() (*redisConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	conn, err := dialRedis(ctx, c.addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.do(time.Now().Add(redisTimeout), "SUBSCRIBE", redisInvalidateChannel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// listen removes the keys published by other processes from memory until
+// the cache is closed, reconnecting whenever the subscription is lost.
+func (c *RedisCache) listen(conn *redisConn) {
+	defer c.wg.Done()
+
+	for {
+		reply, err := conn.receive()
+		if err != nil {
+			conn.Close()
+			if conn = c.resubscribe(err); conn == nil {
+				return
+			}
+			continue
+		}
+
+		message, ok := reply.([]interface{})
+		if !ok || len(message) != 3 {
+			continue
+		}
+		kind, _ := message[0].([]byte)
+		key, _ := message[2].([]byte)
+		if string(kind) == "message" {
+			c.local.Remove(context.Background(), string(key))
+		}
+	}
+}
+
+// resubscribe replaces a lost subscription, returning nil once the cache is
+// closed. Messages published while disconnected are lost, so every entry
+// held in memory is dropped.
+func (c *RedisCache) resubscribe(cause error) *redisConn {
+	for {
+		select {
+		case <-c.done:
+			return nil
+		default:
+		}
+		c.warning("Blog cache subscription lost. %v", cause)
+
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(redisRetry):
+		}
+
+		conn, err := c.subscribe()
+		if err != nil {
+			cause = err
+			continue
+		}
+
+		c.lock.Lock()
+		if c.closed {
+			c.lock.Unlock()
+			conn.Close()
+			return nil
+		}
+		c.sub = conn
+		c.lock.Unlock()
+
+		c.local.cache.Purge()
+		return conn
+	}
+}
+
+// redisError is an error reply from the server. The connection remains
+// usable after one is received.
+type redisError string
+
+func (e redisError) Error() string {
+	return "Redis: " + string(e)
+}
+
+// redisConn is a connection speaking the Redis serialization protocol.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialRedis(ctx context.Context, addr string) (*redisConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &redisConn{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+// do sends a command and waits for its reply.
+func (c *redisConn) do(deadline time.Time, args ...string) (interface{}, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.receive()
+}
+
+// send writes a command as an array of bulk strings.
+func (c *redisConn) send(args ...string) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := c.conn.Write(b.Bytes())
+	return err
+}
+
+// receive reads a reply. Simple strings are returned as a string, integers
+// as an int64, bulk strings as a []byte and arrays as an []interface{}.
+// Null bulk strings and arrays are returned as nil.
+func (c *redisConn) receive() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("Invalid Redis reply " + strconv.Quote(line))
+	}
+	body := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.receive(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, errors.New("Invalid Redis reply " + strconv.Quote(line))
+}
+
+// encodeCachedEntry returns the JSON stored in Redis for an entry. Unlike
+// the API representation it keeps the stored status and rendered html, and
+// does not mark the slug as chosen when read back.
+func encodeCachedEntry(entry Entry) ([]byte, error) {
+	e, ok := entry.(*GaeEntry)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported entry type %T", entry)
+	}
+	doc := e.toJSON()
+	doc.Uuid = e.Uuid()
+	doc.Status = e.status
+	doc.Html = e.html
+	return json.Marshal(doc)
+}
+
+// decodeCachedEntry reads an entry stored by encodeCachedEntry. The author
+// is not loaded.
+func decodeCachedEntry(data []byte) (*GaeEntry, error) {
+	var doc gaeEntryJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &GaeEntry{
+		uuid:        doc.Uuid,
+		title:       doc.Title,
+		slug:        doc.Slug,
+		description: doc.Description,
+		thumbnail:   doc.Thumbnail,
+		cover:       doc.Cover,
+		tags:        doc.Tags,
+		language:    doc.Language,
+		date:        doc.Date,
+		authorUuid:  doc.Author,
+		text:        doc.Text,
+		format:      doc.Format,
+		html:        doc.Html,
+		status:      doc.Status,
+		deleted:     doc.Deleted,
+		deletedAt:   doc.DeletedAt,
+		created:     doc.Created,
+		updated:     doc.Updated,
+	}, nil
+}
@@ -0,0 +1,263 @@
+package blog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisStandIn is a server implementing the few Redis commands used by
+// RedisCache, so that it can be tested without Redis.
+type redisStandIn struct {
+	listener net.Listener
+
+	lock        sync.Mutex
+	values      map[string]string
+	expires     map[string]time.Time
+	subscribers map[string][]net.Conn
+	conns       []net.Conn
+}
+
+func newRedisStandIn(t *testing.T) *redisStandIn {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %v", err)
+	}
+	s := &redisStandIn{
+		listener:    l,
+		values:      make(map[string]string),
+		expires:     make(map[string]time.Time),
+		subscribers: make(map[string][]net.Conn),
+	}
+	go s.serve()
+	t.Cleanup(s.close)
+	return s
+}
+
+func (s *redisStandIn) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *redisStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns = append(s.conns, conn)
+		s.lock.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// dropSubscribers closes every subscribed connection, as happens when a
+// server restarts.
+func (s *redisStandIn) dropSubscribers() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conns := range s.subscribers {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	s.subscribers = make(map[string][]net.Conn)
+}
+
+func (s *redisStandIn) subscriberCount(channel string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.subscribers[channel])
+}
+
+func (s *redisStandIn) close() {
+	s.listener.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *redisStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	for {
+		request, err := c.receive()
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range request.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+		s.lock.Lock()
+		reply := s.command(conn, args)
+		s.lock.Unlock()
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func bulk(value string) string {
+	return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+}
+
+// command runs a command with the lock held and returns the reply.
+func (s *redisStandIn) command(conn net.Conn, args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := s.values[args[1]]
+		if expires, ok := s.expires[args[1]]; ok && time.Now().After(expires) {
+			delete(s.values, args[1])
+			value = ""
+		}
+		if !ok || value == "" {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "SET":
+		s.values[args[1]] = args[2]
+		delete(s.expires, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := s.values[args[1]]
+		delete(s.values, args[1])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "PUBLISH":
+		message := "*3\r\n" + bulk("message") + bulk(args[1]) + bulk(args[2])
+		for _, sub := range s.subscribers[args[1]] {
+			sub.Write([]byte(message))
+		}
+		return fmt.Sprintf(":%d\r\n", len(s.subscribers[args[1]]))
+	case "SUBSCRIBE":
+		s.subscribers[args[1]] = append(s.subscribers[args[1]], conn)
+		return "*3\r\n" + bulk("subscribe") + bulk(args[1]) + ":1\r\n"
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func newTestRedisCache(t *testing.T, addr string, options CacheOptions) *RedisCache {
+	t.Helper()
+
+	c, err := NewRedisCache(addr, options, nil)
+	if err != nil {
+		t.Fatalf("NewRedisCache() failed: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// eventually waits for a condition that depends on a published message.
+func eventually(t *testing.T, message string, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	t.Errorf(message)
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	server := newRedisStandIn(t)
+	a := newTestRedisCache(t, server.addr(), CacheOptions{})
+	b := newTestRedisCache(t, server.addr(), CacheOptions{})
+
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := &GaeEntry{uuid: "u1", title: "Shared", slug: "shared", text: "Some *text*", date: &date,
+		authorUuid: "p1", tags: []string{"go"}, language: "zh-Hant", status: StatusScheduled}
+	entry.author = &testPerson{uuid: "p1", firstName: "Jane"}
+	key := entryCacheKey("redis.com", "u1")
+	a.Set(ctx, key, entry)
+
+	e, ok := b.Get(ctx, key)
+	if !ok {
+		t.Fatalf("Get() did not find an entry set by another process")
+	}
+	g := e.(*GaeEntry)
+	if g.Uuid() != "u1" || g.Title() != "Shared" || g.Slug() != "shared" || g.AuthorUUID() != "p1" ||
+		g.Date() == nil || !g.Date().Equal(date) || strings.Join(g.Tags(), "|") != "go" || g.Language() != "zh-Hant" ||
+		g.status != StatusScheduled {
+		t.Errorf("Get() returned %+v", g)
+	}
+	if g.Author() != nil || g.explicitSlug() {
+		t.Errorf("Get() should not restore the author or mark the slug as chosen")
+	}
+	if g.Html() != "<p>Some <em>text</em></p>\n" {
+		t.Errorf("Get() returned html %q", g.Html())
+	}
+
+	// b now holds the entry in memory, and must drop it when a removes it.
+	server.lock.Lock()
+	delete(server.values, redisKeyPrefix+key)
+	server.lock.Unlock()
+	if e, ok := b.Get(ctx, key); !ok || e == g || e.Title() != "Shared" {
+		t.Errorf("Get() should return a copy of the entry held in memory")
+	}
+	a.Remove(ctx, key)
+	eventually(t, "Remove() was not published to the other process", func() bool {
+		_, ok := b.Get(ctx, key)
+		return !ok
+	})
+
+	// Losing the subscription drops everything held in memory, as removals
+	// may have been missed.
+	b.Set(ctx, key, entry)
+	server.dropSubscribers()
+	eventually(t, "entries held in memory were not dropped after reconnecting", func() bool {
+		_, ok := b.local.Get(ctx, key)
+		return !ok && server.subscriberCount(redisInvalidateChannel) == 2
+	})
+	b.local.Set(ctx, key, entry)
+	a.Remove(ctx, key)
+	eventually(t, "Remove() was not published after reconnecting", func() bool {
+		_, ok := b.local.Get(ctx, key)
+		return !ok
+	})
+}
+
+func TestRedisCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	server := newRedisStandIn(t)
+	c := newTestRedisCache(t, server.addr(), CacheOptions{TTL: 20 * time.Millisecond})
+
+	c.Set(ctx, "key", &GaeEntry{uuid: "u1", title: "Expiring"})
+	if _, ok := c.Get(ctx, "key"); !ok {
+		t.Fatalf("Get() did not find the entry")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := c.Get(ctx, "key"); ok {
+		t.Errorf("Get() returned an expired entry")
+	}
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	server := newRedisStandIn(t)
+	addr := server.addr()
+	server.close()
+
+	if _, err := NewRedisCache(addr, CacheOptions{}, nil); err == nil {
+		t.Errorf("NewRedisCache() should fail when the server is unavailable")
+	}
+}
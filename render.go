@@ -0,0 +1,50 @@
+package blog
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// markdown converts CommonMark with the GitHub Flavoured Markdown extensions
+// (tables, strikethrough, autolinks and task lists) and footnotes. Raw HTML
+// is passed through, and removed later by the sanitizer if it is unsafe.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, extension.Footnote),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// sanitizer permits the markup that users may put in a blog entry, plus the
+// attributes used by heading anchors, footnotes, table alignment, task lists
+// and fenced code block language hints.
+var sanitizer = newSanitizer()
+
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").OnElements("h1", "h2", "h3", "h4", "h5", "h6", "li", "sup")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(footnotes|footnote-ref|footnote-backref)$`)).OnElements("section", "div", "a")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-[a-z]+$`)).OnElements("section", "a")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("style").Matching(regexp.MustCompile(`^text-align:(left|center|right);?$`)).OnElements("th", "td")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowElements("section")
+	return p
+}
+
+// RenderMarkdown converts Markdown text into sanitized HTML.
+func RenderMarkdown(text string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(text), &buf); err != nil {
+		return "<p>" + template.HTMLEscapeString(text) + "</p>"
+	}
+	return sanitizer.Sanitize(buf.String())
+}
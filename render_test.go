@@ -0,0 +1,73 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		contains []string
+		excludes []string
+	}{
+		{"emphasis", "Does _this_ blog entry need some *text*?",
+			[]string{"<p>Does <em>this</em> blog entry need some <em>text</em>?</p>"}, nil},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 |",
+			[]string{"<table>", "<th", ">a</th>", "<td", ">2</td>"}, nil},
+		{"fenced code", "```go\nfmt.Println(\"<hi>\")\n```",
+			[]string{`<pre><code class="language-go">`, "&lt;hi&gt;"}, nil},
+		{"footnote", "Text[^1].\n\n[^1]: The note.",
+			[]string{`href="#fn:1"`, `id="fn:1"`, "The note."}, nil},
+		{"heading", "# Hello World",
+			[]string{`<h1 id="hello-world">Hello World</h1>`}, nil},
+		{"strikethrough", "~~gone~~",
+			[]string{"<del>gone</del>"}, nil},
+		{"script", "Hello <script>alert(1)</script>",
+			[]string{"Hello"}, []string{"<script", "alert(1)"}},
+		{"javascript link", "[click](javascript:alert(1))",
+			[]string{"click"}, []string{"javascript:"}},
+		{"event handler", `<img src="a.png" onerror="alert(1)">`,
+			[]string{`<img src="a.png"`}, []string{"onerror"}},
+	}
+
+	for _, c := range cases {
+		html := RenderMarkdown(c.text)
+		for _, s := range c.contains {
+			if !strings.Contains(html, s) {
+				t.Errorf("%s: RenderMarkdown() should contain %q, returned %q", c.name, s, html)
+			}
+		}
+		for _, s := range c.excludes {
+			if strings.Contains(html, s) {
+				t.Errorf("%s: RenderMarkdown() should not contain %q, returned %q", c.name, s, html)
+			}
+		}
+	}
+}
+
+func TestEntryHtml(t *testing.T) {
+	e := &GaeEntry{}
+	e.SetText("Some *text*")
+	if e.Html() != "<p>Some <em>text</em></p>\n" {
+		t.Fatalf("Html() returned %q", e.Html())
+	}
+
+	// Stored html is served without rendering again
+	e.html = "<p>stored</p>"
+	if e.Html() != "<p>stored</p>" {
+		t.Fatalf("Html() should return stored html, returned %q", e.Html())
+	}
+
+	e.SetText("New _text_")
+	if e.Html() != "<p>New <em>text</em></p>\n" {
+		t.Fatalf("Html() should render changed text, returned %q", e.Html())
+	}
+
+	// Entries saved before rendering was introduced stored the raw text
+	legacy := &GaeEntry{text: "Old *text*", html: "Old *text*"}
+	if legacy.Html() != "<p>Old <em>text</em></p>\n" {
+		t.Fatalf("Html() should render legacy entries, returned %q", legacy.Html())
+	}
+}
@@ -0,0 +1,253 @@
+package blog
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gitlab.com/montebo/security"
+)
+
+// A Revision is a snapshot of a blog entry as it was saved by AddEntry or
+// UpdateEntry. Revisions are numbered from 1 in the order they were saved.
+// The status of the entry is not part of a revision.
+type Revision struct {
+	Number      int
+	Entry       Entry
+	PersonUuid  string
+	DisplayName string
+	Created     time.Time
+}
+
+// snapshot returns a copy of the fields of an entry that are kept in each
+// revision.
+func snapshot(entry Entry) *GaeEntry {
+	s := &GaeEntry{
+		uuid:        entry.Uuid(),
+		title:       entry.Title(),
+		slug:        entry.Slug(),
+		description: entry.Description(),
+		thumbnail:   entry.Thumbnail(),
+		cover:       entry.Cover(),
+		date:        entry.Date(),
+		authorUuid:  entry.AuthorUUID(),
+		text:        entry.Text(),
+		format:      entry.Format(),
+		language:    entry.Language(),
+		created:     entry.Created(),
+		updated:     entry.Updated(),
+		deleted:     entry.Deleted(),
+	}
+	if len(entry.Tags()) > 0 {
+		s.tags = append([]string{}, entry.Tags()...)
+	}
+	return s
+}
+
+// checkRevisions returns an error unless the session may read the
+// revisions of an entry. Revisions include hidden versions of an entry, so
+// they are only shown to people who may change it. The entry is read with
+// load, which must return it whether or not the session may see it.
+func checkRevisions(uuid string, session security.Session, load func(uuid string) (Entry, error)) error {
+	if session == nil || !session.IsAuthenticated() {
+		return &security.ErrUnauthenticated{session}
+	}
+	entry, err := load(uuid)
+	if err != nil {
+		return err
+	}
+	return checkAuthor(entry.AuthorUUID(), session)
+}
+
+// restoreRevision copies the content of an earlier revision onto the current
+// entry and saves it with UpdateEntry, so that the restore is recorded in the
+// change log and as a new revision. The status and slug of the current entry
+// are kept: restoring content must not publish an entry or break its links.
+func restoreRevision(ctx context.Context, bm BlogManager, uuid string, number int, session security.Session) error {
+	revision, err := bm.GetRevisionContext(ctx, uuid, number, session)
+	if err != nil {
+		return err
+	}
+
+	current, err := bm.GetEntryContext(ShowHidden(ctx), uuid, session)
+	if err != nil {
+		return err
+	}
+
+	r := revision.Entry
+	current.SetTitle(r.Title())
+	current.SetDescription(r.Description())
+	current.SetThumbnail(r.Thumbnail())
+	current.SetCover(r.Cover())
+	current.SetTags(r.Tags())
+	current.setDate(r.Date())
+	current.SetText(r.Text())
+	current.SetFormat(r.Format())
+	current.SetLanguage(r.Language())
+
+	return bm.UpdateEntryContext(ctx, current, session)
+}
+
+// DiffOp identifies whether a line of a diff is unchanged, added or removed.
+type DiffOp int
+
+const (
+	DiffEqual DiffOp = iota
+	DiffInsert
+	DiffDelete
+)
+
+// A DiffLine is one line of a line-level diff.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// String returns the line prefixed in the style of a unified diff.
+func (d DiffLine) String() string {
+	switch d.Op {
+	case DiffInsert:
+		return "+" + d.Text
+	case DiffDelete:
+		return "-" + d.Text
+	}
+	return " " + d.Text
+}
+
+// DiffRevisions returns a line-level diff of the text of two revisions.
+// Other fields, such as the slug, are compared by the caller.
+func DiffRevisions(from, to *Revision) []DiffLine {
+	return DiffText(from.Entry.Text(), to.Entry.Text())
+}
+
+// DiffText returns the lines removed from and added to before to produce
+// after. It finds a shortest diff in space proportional to the number of
+// lines, so that long entries can be compared.
+func DiffText(before, after string) []DiffLine {
+	return diffLines(nil, splitLines(before), splitLines(after))
+}
+
+// maxDiffSteps is the number of changes from each end of a part of two
+// texts that middleSnake looks through for the middle of a shortest diff.
+const maxDiffSteps = 512
+
+// diffLines appends the diff of a and b to diff. Lines at the start and
+// end of both are unchanged, and the lines between are split at the
+// middle snake of a shortest diff and diffed in two halves.
+func diffLines(diff []DiffLine, a, b []string) []DiffLine {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		diff = append(diff, DiffLine{DiffEqual, a[n]})
+		n++
+	}
+	a, b = a[n:], b[n:]
+
+	n = 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	suffix := a[len(a)-n:]
+	a, b = a[:len(a)-n], b[:len(b)-n]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			diff = append(diff, DiffLine{DiffInsert, line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			diff = append(diff, DiffLine{DiffDelete, line})
+		}
+	default:
+		x, y, u, v := middleSnake(a, b)
+		diff = diffLines(diff, a[:x], b[:y])
+		for _, line := range a[x:u] {
+			diff = append(diff, DiffLine{DiffEqual, line})
+		}
+		diff = diffLines(diff, a[u:], b[v:])
+	}
+
+	for _, line := range suffix {
+		diff = append(diff, DiffLine{DiffEqual, line})
+	}
+	return diff
+}
+
+// middleSnake returns the run of unchanged lines, from a[x:u] and b[y:v],
+// in the middle of a shortest diff of a and b, found by following the
+// diff from both ends at once (Myers, "An O(ND) Difference Algorithm and
+// Its Variations", 1986). a and b must not start or end with the same
+// line, so that the run splits them into smaller parts.
+//
+// The time taken grows with the square of the length of the diff, so when
+// the ends are more than maxDiffSteps changes apart the run reached by the
+// furthest diff from the start is returned instead. Diffs of texts that
+// were mostly rewritten are then longer than they need be.
+func middleSnake(a, b []string) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	max := (n + m + 1) / 2
+	if max > maxDiffSteps {
+		max = maxDiffSteps
+	}
+	var best [4]int
+
+	// forward[k] is how far along a the furthest diff from the start
+	// reaches on diagonal k, where k is the index in a less the index in
+	// b. backward[k] is the same for diffs from the end, counting lines
+	// from the end of a, on diagonal k from the end.
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+	at := func(k int) int { return k + max + 1 }
+
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && forward[at(k-1)] < forward[at(k+1)]) {
+				x = forward[at(k+1)]
+			} else {
+				x = forward[at(k-1)] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			forward[at(k)] = u
+			if u+v > best[2]+best[3] {
+				best = [4]int{x, y, u, v}
+			}
+			if c := delta - k; delta%2 != 0 && c >= -(d-1) && c <= d-1 && u+backward[at(c)] >= n {
+				return x, y, u, v
+			}
+		}
+
+		for c := -d; c <= d; c += 2 {
+			var rx int
+			if c == -d || (c != d && backward[at(c-1)] < backward[at(c+1)]) {
+				rx = backward[at(c+1)]
+			} else {
+				rx = backward[at(c-1)] + 1
+			}
+			ry := rx - c
+			ru, rv := rx, ry
+			for ru < n && rv < m && a[n-1-ru] == b[m-1-rv] {
+				ru++
+				rv++
+			}
+			backward[at(c)] = ru
+			if k := delta - c; delta%2 == 0 && k >= -d && k <= d && forward[at(k)]+ru >= n {
+				return n - ru, m - rv, n - rx, m - ry
+			}
+		}
+	}
+
+	return best[0], best[1], best[2], best[3]
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+}
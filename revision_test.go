@@ -0,0 +1,109 @@
+package blog
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffText(t *testing.T) {
+	cases := []struct {
+		before, after string
+		want          string
+	}{
+		{"", "", ""},
+		{"a\nb\n", "a\nb\n", " a| b"},
+		{"", "a", "+a"},
+		{"a", "", "-a"},
+		{"a\nb\nc", "a\nc", " a|-b| c"},
+		{"a\nc", "a\nb\nc", " a|+b| c"},
+		{"a\r\nb", "a\nx", " a|-b|+x"},
+		{"a\nb\nc\nd", "b\nx\nd\ne", "-a| b|-c|+x| d|+e"},
+		{"x\na\nb", "a\nb\nx", "-x| a| b|+x"},
+	}
+
+	for _, c := range cases {
+		var lines []string
+		for _, l := range DiffText(c.before, c.after) {
+			lines = append(lines, l.String())
+		}
+		if got := strings.Join(lines, "|"); got != c.want {
+			t.Errorf("DiffText(%q, %q) = %q, want %q", c.before, c.after, got, c.want)
+		}
+	}
+}
+
+// TestDiffTextShortest checks that DiffText keeps as many lines as the
+// longest common subsequence, and that its diffs rebuild both texts.
+func TestDiffTextShortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := text(), text()
+
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] > lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		var before, after []string
+		equal := 0
+		for _, l := range DiffText(strings.Join(a, "\n"), strings.Join(b, "\n")) {
+			if l.Op != DiffInsert {
+				before = append(before, l.Text)
+			}
+			if l.Op != DiffDelete {
+				after = append(after, l.Text)
+			}
+			if l.Op == DiffEqual {
+				equal++
+			}
+		}
+		if fmt.Sprint(before) != fmt.Sprint(a) || fmt.Sprint(after) != fmt.Sprint(b) || equal != lcs[0][0] {
+			t.Fatalf("DiffText(%q, %q) kept %d lines, want %d, and rebuilt %q, %q", a, b, equal, lcs[0][0], before, after)
+		}
+	}
+}
+
+// TestDiffTextLong checks that rewriting a long text is diffed quickly.
+func TestDiffTextLong(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 50000; i++ {
+		a = append(a, fmt.Sprintf("line %d", i))
+		b = append(b, fmt.Sprintf("line %d", i*7%50000))
+	}
+
+	start := time.Now()
+	var after []string
+	for _, l := range DiffText(strings.Join(a, "\n"), strings.Join(b, "\n")) {
+		if l.Op != DiffDelete {
+			after = append(after, l.Text)
+		}
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("DiffText() of long texts took %v", d)
+	}
+	if strings.Join(after, "\n") != strings.Join(b, "\n") {
+		t.Errorf("DiffText() of long texts did not rebuild the new text")
+	}
+}
@@ -0,0 +1,628 @@
+package blog
+
+import (
+	"context"
+	"html"
+	"html/template"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gitlab.com/montebo/security"
+)
+
+// The title, tags, description and text of every entry are indexed for
+// search. Words are folded, stemmed in English and stored in an inverted
+// index along with their positions, and common words such as "the" are
+// left out. Entries are analyzed in their own language, and each word of
+// a query matches both its English stem and the word as written, so that
+// every session finds the same entries. Results are ordered by relevance,
+// which favours words in the title over words in the text, repeated words,
+// and words found in few entries.
+
+// SearchOptions select a page of search results.
+type SearchOptions struct {
+	// Cursor is the Next value of the previous page, or empty for the
+	// first page.
+	Cursor string
+
+	// Limit is the number of results on a page. It defaults to
+	// DefaultListLimit and may not exceed MaxListLimit.
+	Limit int
+}
+
+// SearchResults are a page of the entries matching a search query.
+type SearchResults struct {
+	Hits []*SearchHit `json:"hits"`
+
+	// Total is the number of entries the session may see that match the
+	// query.
+	Total int `json:"total"`
+
+	// Next is the cursor of the following page, or empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// A SearchHit is an entry matching a search query.
+type SearchHit struct {
+	Entry Entry `json:"entry"`
+
+	// Score is the relevance of the entry to the query. It may only be
+	// compared with the scores of other hits of the same search.
+	Score float64 `json:"score"`
+
+	// Snippet is an extract of the entry text around the words that
+	// match the query, which are wrapped in <mark> elements.
+	Snippet template.HTML `json:"snippet"`
+}
+
+// minPrefix is the number of letters a prefix query must have. Shorter
+// prefixes are searched for as words.
+const minPrefix = 2
+
+// fieldGap separates the positions of words in different fields of an
+// entry, so that phrases do not match across fields.
+const fieldGap = 100
+
+// snippetWords is the number of words shown in a search result snippet.
+const snippetWords = 30
+
+// A posting records the occurrences of a term in an entry.
+type posting struct {
+	term string
+	uuid string
+
+	// weight is the number of occurrences, multiplied by the weight of
+	// the field each is in.
+	weight float64
+
+	// positions of the occurrences, in increasing order.
+	positions []int
+}
+
+// A searchField is text of an entry that is indexed, and the weight given
+// to the words in it.
+type searchField struct {
+	text   string
+	weight float64
+}
+
+func searchFields(e Entry) []searchField {
+	return []searchField{
+		{e.Title(), 3},
+		{strings.Join(e.Tags(), " "), 2},
+		{e.Description(), 2},
+		{plainText(e.Html()), 1},
+	}
+}
+
+// searchPostings returns the postings of the terms in an entry, keyed by
+// term. It returns nil for a nil entry.
+func searchPostings(e Entry) map[string]*posting {
+	if e == nil {
+		return nil
+	}
+
+	a := analyzerFor(e.Language())
+	postings := make(map[string]*posting)
+	offset := 0
+	for _, f := range searchFields(e) {
+		tokens := words(f.text)
+		for _, t := range a.tokenize(f.text) {
+			p := postings[t.term]
+			if p == nil {
+				p = &posting{term: t.term, uuid: e.Uuid()}
+				postings[t.term] = p
+			}
+			p.weight += f.weight
+			p.positions = append(p.positions, offset+t.position)
+		}
+		offset += len(tokens) + fieldGap
+	}
+	return postings
+}
+
+// samePosting reports whether two postings of a term in an entry are
+// equal, so that an unchanged index entry need not be written again.
+func samePosting(a, b *posting) bool {
+	if a == nil || b == nil || a.weight != b.weight || len(a.positions) != len(b.positions) {
+		return false
+	}
+	for i := range a.positions {
+		if a.positions[i] != b.positions[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// inlineTags do not separate the words on either side of them.
+var inlineTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "code": true, "em": true, "i": true,
+	"mark": true, "s": true, "small": true, "span": true, "strong": true,
+	"sub": true, "sup": true, "u": true,
+}
+
+// plainText returns the text of an html fragment without its tags, with
+// runs of white space collapsed to a single space.
+func plainText(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		j := strings.IndexByte(s[i:], '>')
+		if j < 0 {
+			break
+		}
+		name := strings.TrimPrefix(s[i+1:i+j], "/")
+		if k := strings.IndexAny(name, " \t\n/"); k >= 0 {
+			name = name[:k]
+		}
+		if !inlineTags[strings.ToLower(name)] {
+			b.WriteByte(' ')
+		}
+		s = s[i+j+1:]
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(b.String())), " ")
+}
+
+// A searchTerm is a part of a search query: a word, a prefix, or a phrase
+// of several words.
+type searchTerm struct {
+	words  []searchWord
+	prefix bool
+}
+
+// A searchWord is a word of a search query and the terms it matches.
+// Entries are indexed with the analyzer for their own language, so a word
+// matches both its English stem and the word as it is written, whatever
+// the language of the person searching.
+type searchWord struct {
+	terms []string
+
+	// position counts the words before the word, including stop words.
+	position int
+}
+
+// queryWords returns the words of query text that are searched for. Stop
+// words are left out, as entries in English do not index them.
+func queryWords(text string) []searchWord {
+	var items []searchWord
+	for _, t := range words(text) {
+		if englishAnalyzer.stopWords[t.term] {
+			continue
+		}
+		w := searchWord{terms: []string{t.term}, position: t.position}
+		if s := englishAnalyzer.stem(t.term); s != t.term {
+			w.terms = append(w.terms, s)
+		}
+		items = append(items, w)
+	}
+	return items
+}
+
+// A searchQuery matches the entries that match every term of any one of
+// its clauses.
+type searchQuery [][]searchTerm
+
+// parseQuery parses a search query. Stop words are ignored outside of
+// phrases, and a query without any other words is empty.
+func parseQuery(query string) searchQuery {
+	var q searchQuery
+	var clause []searchTerm
+	next := func() {
+		if len(clause) > 0 {
+			q = append(q, clause)
+			clause = nil
+		}
+	}
+
+	for query != "" {
+		r, size := utf8.DecodeRuneInString(query)
+		if unicode.IsSpace(r) {
+			query = query[size:]
+			continue
+		}
+
+		if r == '"' {
+			query = query[size:]
+			end := strings.IndexByte(query, '"')
+			if end < 0 {
+				end = len(query)
+			}
+			if w := queryWords(query[:end]); len(w) > 0 {
+				clause = append(clause, searchTerm{words: w})
+			}
+			query = strings.TrimPrefix(query[end:], `"`)
+			continue
+		}
+
+		end := strings.IndexFunc(query, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '"'
+		})
+		if end < 0 {
+			end = len(query)
+		}
+		word := query[:end]
+		query = query[end:]
+
+		switch {
+		case word == "OR" || word == "|":
+			next()
+		case word == "AND":
+		case strings.HasSuffix(word, "*"):
+			clause = append(clause, prefixTerms(strings.TrimRight(word, "*"))...)
+		default:
+			if w := queryWords(word); len(w) > 0 {
+				clause = append(clause, searchTerm{words: w})
+			}
+		}
+	}
+	next()
+
+	return q
+}
+
+// prefixTerms returns the terms of a word ending in "*". The last part of
+// the word is a prefix of the word as it is written; any earlier parts,
+// such as "e" in "e-mai*", must match as words.
+func prefixTerms(word string) []searchTerm {
+	parts := words(word)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	var terms []searchTerm
+	for _, w := range queryWords(word[:parts[len(parts)-1].start]) {
+		terms = append(terms, searchTerm{words: []searchWord{w}})
+	}
+
+	last := parts[len(parts)-1]
+	if utf8.RuneCountInString(last.term) < minPrefix {
+		if w := queryWords(last.term); len(w) > 0 {
+			terms = append(terms, searchTerm{words: w})
+		}
+		return terms
+	}
+	return append(terms, searchTerm{words: []searchWord{{terms: []string{last.term}}}, prefix: true})
+}
+
+// A searchIndex is the inverted index of the entries on a site.
+type searchIndex interface {
+	// postings returns the postings of a term, or of every term starting
+	// with it when prefix is set.
+	postings(term string, prefix bool) ([]posting, error)
+
+	// documents returns the number of entries in the index.
+	documents() (int, error)
+
+	// entries returns the entries with the given uuids, keyed by uuid.
+	// Entries that no longer exist are left out.
+	entries(uuids []string) (map[string]Entry, error)
+}
+
+// search returns the page of entries in an index that match a query and
+// that the session may see with ctx.
+func search(ctx context.Context, index searchIndex, query string, options SearchOptions, session security.Session) (*SearchResults, error) {
+	offset := 0
+	if options.Cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(options.Cursor)
+		if err != nil || offset < 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	hits, matched, err := rank(ctx, index, query, session)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &SearchResults{Hits: []*SearchHit{}, Total: len(hits)}
+	if offset >= len(hits) {
+		return results, nil
+	}
+	results.Hits = hits[offset:]
+	limit := ListOptions{Limit: options.Limit}.limit()
+	if len(results.Hits) > limit {
+		results.Hits = results.Hits[:limit]
+		results.Next = strconv.Itoa(offset + limit)
+	}
+	for _, h := range results.Hits {
+		h.Snippet = snippet(h.Entry, matched[h.Entry.Uuid()])
+	}
+
+	return results, nil
+}
+
+// searchAll returns every entry matching a query, most relevant first.
+func searchAll(ctx context.Context, index searchIndex, query string, session security.Session) ([]Entry, error) {
+	hits, _, err := rank(ctx, index, query, session)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]Entry, len(hits))
+	for i, h := range hits {
+		items[i] = h.Entry
+	}
+	return items, nil
+}
+
+// rank returns the entries in an index that match a query and that the
+// session may see, most relevant first, along with the terms matched in
+// each entry keyed by uuid.
+func rank(ctx context.Context, index searchIndex, query string, session security.Session) ([]*SearchHit, map[string]map[string]bool, error) {
+	q := parseQuery(query)
+	if len(q) == 0 {
+		return nil, nil, nil
+	}
+
+	total, err := index.documents()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scores := make(map[string]float64)
+	matched := make(map[string]map[string]bool)
+	cache := make(map[string][]posting)
+	for _, clause := range q {
+		var docs map[string]float64
+		terms := make(map[string][]string)
+		for _, t := range clause {
+			s, err := t.match(index, cache, total, terms)
+			if err != nil {
+				return nil, nil, err
+			}
+			if docs == nil {
+				docs = s
+			} else {
+				for uuid := range docs {
+					if score, ok := s[uuid]; ok {
+						docs[uuid] += score
+					} else {
+						delete(docs, uuid)
+					}
+				}
+			}
+			if len(docs) == 0 {
+				break
+			}
+		}
+		for uuid, score := range docs {
+			scores[uuid] += score
+			if matched[uuid] == nil {
+				matched[uuid] = make(map[string]bool)
+			}
+			for _, term := range terms[uuid] {
+				matched[uuid][term] = true
+			}
+		}
+	}
+
+	uuids := make([]string, 0, len(scores))
+	for uuid := range scores {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	entries, err := index.entries(uuids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hits []*SearchHit
+	now := time.Now()
+	for _, uuid := range uuids {
+		if e, ok := entries[uuid]; ok && canSee(ctx, e, session, now) {
+			hits = append(hits, &SearchHit{Entry: e, Score: scores[uuid]})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return entryTime(a.Entry).After(entryTime(b.Entry))
+	})
+
+	return hits, matched, nil
+}
+
+// lookup returns the postings of a term, sorted by term and uuid, reading
+// each term from the index only once per search.
+func lookup(index searchIndex, cache map[string][]posting, term string, prefix bool) ([]posting, error) {
+	key := term
+	if prefix {
+		key += "*"
+	}
+	if p, ok := cache[key]; ok {
+		return p, nil
+	}
+
+	p, err := index.postings(term, prefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].term != p[j].term {
+			return p[i].term < p[j].term
+		}
+		return p[i].uuid < p[j].uuid
+	})
+	cache[key] = p
+	return p, nil
+}
+
+// match returns the score of each entry matching a term, and adds the
+// terms it matched in each entry to terms.
+func (t searchTerm) match(index searchIndex, cache map[string][]posting, total int, terms map[string][]string) (map[string]float64, error) {
+	scores := make(map[string]float64)
+
+	if len(t.words) == 1 {
+		for _, term := range t.words[0].terms {
+			postings, err := lookup(index, cache, term, t.prefix)
+			if err != nil {
+				return nil, err
+			}
+			frequency := make(map[string]int)
+			for _, p := range postings {
+				frequency[p.term]++
+			}
+			for _, p := range postings {
+				scores[p.uuid] += termScore(p.weight, frequency[p.term], total)
+				terms[p.uuid] = append(terms[p.uuid], p.term)
+			}
+		}
+		return scores, nil
+	}
+
+	// A phrase matches entries containing each word at the same distance
+	// from the first word as in the query. found holds the postings of
+	// each word by entry, one for each of its terms in the entry.
+	var found []map[string][]posting
+	for _, w := range t.words {
+		byUuid := make(map[string][]posting)
+		for _, term := range w.terms {
+			postings, err := lookup(index, cache, term, false)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range postings {
+				byUuid[p.uuid] = append(byUuid[p.uuid], p)
+			}
+		}
+		found = append(found, byUuid)
+	}
+
+	for uuid, first := range found[0] {
+		if !t.phraseIn(found, uuid, first) {
+			continue
+		}
+		for i := range t.words {
+			for _, p := range found[i][uuid] {
+				scores[uuid] += termScore(p.weight, len(found[i]), total)
+				terms[uuid] = append(terms[uuid], p.term)
+			}
+		}
+	}
+	return scores, nil
+}
+
+// phraseIn reports whether the words of a phrase occur in an entry, given
+// the postings of the first word in the entry.
+func (t searchTerm) phraseIn(found []map[string][]posting, uuid string, first []posting) bool {
+	for _, p := range first {
+		for _, start := range p.positions {
+			if t.phraseAt(found, uuid, start) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// phraseAt reports whether the words of a phrase occur in an entry with
+// the first word at position start.
+func (t searchTerm) phraseAt(found []map[string][]posting, uuid string, start int) bool {
+	for i, w := range t.words[1:] {
+		want := start + w.position - t.words[0].position
+		at := false
+		for _, p := range found[i+1][uuid] {
+			if n := sort.SearchInts(p.positions, want); n < len(p.positions) && p.positions[n] == want {
+				at = true
+				break
+			}
+		}
+		if !at {
+			return false
+		}
+	}
+	return true
+}
+
+// termScore is the relevance of a term to an entry: the weighted number
+// of times it occurs in the entry, dampened so that repetition counts for
+// less and less, times the inverse of the share of entries containing it.
+func termScore(weight float64, entries, total int) float64 {
+	if total < entries {
+		total = entries
+	}
+	return (1 + math.Log(weight)) * math.Log(1+float64(total)/float64(entries))
+}
+
+// snippet returns the part of the text of an entry that has the most of
+// the matched terms, with the words of those terms marked.
+func snippet(e Entry, matched map[string]bool) template.HTML {
+	text := plainText(e.Html())
+	if text == "" {
+		text = e.Description()
+	}
+	tokens := analyzerFor(e.Language()).tokenize(text)
+
+	// Find the window of tokens containing the most matched terms.
+	first, best, count := 0, 0, 0
+	for i, t := range tokens {
+		if matched[t.term] {
+			count++
+		}
+		if i >= snippetWords && matched[tokens[i-snippetWords].term] {
+			count--
+		}
+		if count > best {
+			first, best = i-snippetWords+1, count
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+	last := first + snippetWords
+	if last > len(tokens) {
+		last = len(tokens)
+	}
+
+	start, end := 0, len(text)
+	if first > 0 {
+		start = tokens[first].start
+	}
+	if last < len(tokens) {
+		end = tokens[last-1].end
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+
+	// The overlapping words of Chinese, Japanese and Korean text are
+	// joined into a single mark.
+	var marks [][2]int
+	for _, t := range tokens[first:last] {
+		if !matched[t.term] {
+			continue
+		}
+		if n := len(marks); n > 0 && t.start < marks[n-1][1] {
+			marks[n-1][1] = t.end
+		} else {
+			marks = append(marks, [2]int{t.start, t.end})
+		}
+	}
+	pos := start
+	for _, m := range marks {
+		b.WriteString(template.HTMLEscapeString(text[pos:m[0]]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(text[m[0]:m[1]]) + "</mark>")
+		pos = m[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+
+	return template.HTML(b.String())
+}
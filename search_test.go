@@ -0,0 +1,214 @@
+package blog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	cases := map[string]string{
+		"caresses":        "caress",
+		"ponies":          "poni",
+		"cats":            "cat",
+		"agreed":          "agre",
+		"plastered":       "plaster",
+		"hopping":         "hop",
+		"filing":          "file",
+		"happy":           "happi",
+		"relational":      "relat",
+		"conditional":     "condit",
+		"generalizations": "gener",
+		"oscillators":     "oscil",
+		"connected":       "connect",
+		"connection":      "connect",
+		"controlling":     "control",
+		"go":              "go",
+		"café":            "café",
+		"2021":            "2021",
+	}
+
+	for word, want := range cases {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) returned %q, expected %q", word, got, want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{"Hello, World! 2021", "hello world 2021"},
+		{"Crème brûlée à la CAFÉ", "creme brulee a la cafe"},
+		{"Straße ΣΊΣΥΦΟΣ Ёлка", "strasse σισυφοσ елка"},
+		{"ＦＵＬＬ width ｶﾀｶﾅ", "full width カタ タカ カナ"},
+		{"我喜欢学习中文", "我喜 喜欢 欢学 学习 习中 中文"},
+		{"Go语言编程 and 日本", "go 语言 言编 编程 and 日本"},
+		{"一 个", "一 个"},
+		{"東京タワーへ", "東京 京タ タワ ワー ーへ"},
+		{"한국어 문장", "한국 국어 문장"},
+		{"नमस्ते दुनिया", "नमस्ते दुनिया"},
+	}
+
+	for _, c := range cases {
+		var terms []string
+		for _, w := range words(c.text) {
+			terms = append(terms, w.term)
+		}
+		if got := strings.Join(terms, " "); got != c.want {
+			t.Errorf("words(%q) returned %q, expected %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestAnalyzerFor(t *testing.T) {
+	cases := map[string]*analyzer{
+		"":        englishAnalyzer,
+		"en":      englishAnalyzer,
+		"en-AU":   englishAnalyzer,
+		"en_GB":   englishAnalyzer,
+		"zh-TW":   plainAnalyzer,
+		"zh-Hans": plainAnalyzer,
+		"fr":      plainAnalyzer,
+		"bad tag": englishAnalyzer,
+	}
+
+	for lang, want := range cases {
+		if got := analyzerFor(lang); got != want {
+			t.Errorf("analyzerFor(%q) returned the wrong analyzer", lang)
+		}
+	}
+	if terms := plainAnalyzer.tokenize("The connected Café"); len(terms) != 3 || terms[1].term != "connected" || terms[2].term != "cafe" {
+		t.Errorf("plain analyzer returned %v", terms)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	format := func(q searchQuery) string {
+		var clauses []string
+		for _, clause := range q {
+			var terms []string
+			for _, term := range clause {
+				var words []string
+				for _, w := range term.words {
+					words = append(words, strings.Join(w.terms, "/"))
+				}
+				s := strings.Join(words, " ")
+				if len(words) > 1 {
+					s = `"` + s + `"`
+				}
+				if term.prefix {
+					s += "*"
+				}
+				terms = append(terms, s)
+			}
+			clauses = append(clauses, strings.Join(terms, " "))
+		}
+		return strings.Join(clauses, " | ")
+	}
+
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"Connected networks", "connected/connect networks/network"},
+		{"the cat AND the hat", "cat hat"},
+		{`"state of the art" design`, `"state art" design`},
+		{`"unterminated phrase`, `"unterminated/untermin phrase"`},
+		{"cats OR dogs | birds", "cats/cat | dogs/dog | birds/bird"},
+		{"OR cats OR", "cats/cat"},
+		{"connect*", "connect*"},
+		{"x*", "x"},
+		{"e-mai*", "e mai*"},
+		{"wi-fi", `"wi fi"`},
+		{"the and of", ""},
+		{"東京都 tower", `"東京 京都" tower`},
+		{`"Café Noël"`, `"cafe noel"`},
+	}
+
+	for _, c := range cases {
+		if got := format(parseQuery(c.query)); got != c.want {
+			t.Errorf("parseQuery(%q) returned %q, expected %q", c.query, got, c.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	e := &GaeEntry{}
+	e.SetText("Tomatoes & peppers need *full sun*.")
+	if s := snippet(e, map[string]bool{"sun": true, "tomato": true}); s != "<mark>Tomatoes</mark> &amp; peppers need full <mark>sun</mark>." {
+		t.Errorf("snippet() returned %q", s)
+	}
+
+	e.SetText("我喜欢学习中文，也喜欢日本。")
+	if s := snippet(e, map[string]bool{"学习": true, "习中": true, "日本": true}); s != "我喜欢<mark>学习中</mark>文，也喜欢<mark>日本</mark>。" {
+		t.Errorf("snippet() of Chinese text returned %q", s)
+	}
+
+	var words []string
+	for i := 0; i < 100; i++ {
+		words = append(words, fmt.Sprintf("w%d", i))
+	}
+	words[60] = "needle"
+	e.SetText(strings.Join(words, " "))
+	s := string(snippet(e, map[string]bool{"needl": true}))
+	if !strings.HasPrefix(s, "…w31 ") || !strings.Contains(s, "<mark>needle</mark>") || !strings.HasSuffix(s, "<mark>needle</mark>…") {
+		t.Errorf("snippet() of a long text returned %q", s)
+	}
+	if s := snippet(e, nil); !strings.HasPrefix(string(s), "w0 ") || !strings.HasSuffix(string(s), "w29…") {
+		t.Errorf("snippet() without matches returned %q", s)
+	}
+}
+
+func TestSearchLanguage(t *testing.T) {
+	am := newTestAccessManager()
+	bm := NewMemoryBlogManager(am)
+	editor := &testSession{site: "language.com", personUuid: "p1", authenticated: true, roles: []string{RoleEditor}}
+
+	e := bm.NewEntry()
+	e.SetTitle("Les cafés du quartier")
+	e.SetText("Les meilleurs cafés de la ville.")
+	e.SetDate(*StringToDatePointer("2001/1/1"))
+	e.SetStatus(StatusPublished)
+	e.SetLanguage("xx-invalid-tag")
+	if err := bm.AddEntry(e, editor); err == nil {
+		t.Errorf("AddEntry() with an invalid language should fail")
+	}
+	e.SetLanguage("fr")
+	if err := bm.AddEntry(e, editor); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+	e = bm.NewEntry()
+	e.SetTitle("Running shoes")
+	e.SetText("Shoes for running.")
+	e.SetDate(*StringToDatePointer("2001/1/2"))
+	e.SetStatus(StatusPublished)
+	if err := bm.AddEntry(e, editor); err != nil {
+		t.Fatalf("AddEntry() failed: %v", err)
+	}
+
+	for _, c := range []struct {
+		locale string
+		query  string
+		want   int
+	}{
+		{"fr-FR", "cafés", 1},
+		{"fr-FR", "meilleurs", 1},
+		{"fr-FR", "meilleur", 0},
+		{"en", "cafés", 1},
+		{"en", "meilleurs", 1},
+		{"en", "meilleurs*", 1},
+		{"zh-Hant", "cafés", 1},
+		{"zh-Hant", "running", 1},
+		{"zh-Hant", "runs", 1},
+		{"fr-FR", `"running shoes"`, 1},
+	} {
+		session := &testSession{site: "language.com", locale: c.locale}
+		items, err := bm.SearchEntries(c.query, session)
+		if err != nil || len(items) != c.want {
+			t.Errorf("SearchEntries(%q) in %s returned %d entries, expected %d: %v", c.query, c.locale, len(items), c.want, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gitlab.com/montebo/security"
+)
+
+// maxSlugLength is the longest slug, in characters, that can be chosen with
+// SetSlug.
+const maxSlugLength = 100
+
+// reservedSlugs are paths used by Handler and ManageHandler, so can not be
+// used as slugs.
+var reservedSlugs = []string{"author", "feed", "manage", "search", "tag"}
+
+// checkSlug describes the problem with a chosen slug, or returns an empty
+// string if it may be used. Slugs are lower case letters and digits
+// separated by single dashes.
+func checkSlug(slug string) string {
+	if utf8.RuneCountInString(slug) > maxSlugLength {
+		return "Slug must be at most " + strconv.Itoa(maxSlugLength) + " characters"
+	}
+	if containsString(reservedSlugs, slug) {
+		return "Slug " + slug + " is reserved"
+	}
+	if strings.HasPrefix(slug, "-") || strings.HasSuffix(slug, "-") || strings.Contains(slug, "--") {
+		return "Slug must not start or end with a dash, or contain two dashes in a row"
+	}
+	for _, r := range slug {
+		if r != '-' && !unicode.IsDigit(r) && !(unicode.IsLetter(r) && !unicode.IsUpper(r)) {
+			return "Slug may only contain lower case letters, digits and dashes"
+		}
+	}
+	return ""
+}
+
+// maxSlugSuffix is the largest number appended to a derived slug to make it
+// unique before AddEntry gives up.
+const maxSlugSuffix = 100
+
+// uniqueSlug returns the first of slug, slug-2, slug-3 and so on that
+// reserve claims for an entry. reserve returns false when another entry
+// already has a slug. A slug that was set explicitly is never changed, and
+// ErrSlugConflict is returned if it is taken. Derived slugs that are
+// reserved are treated as taken.
+func uniqueSlug(slug string, explicit bool, reserve func(slug string) (bool, error)) (string, error) {
+	candidate := slug
+	for n := 2; ; n++ {
+		ok := false
+		if !containsString(reservedSlugs, candidate) {
+			var err error
+			if ok, err = reserve(candidate); err != nil {
+				return "", err
+			}
+		}
+		if ok {
+			return candidate, nil
+		}
+		if explicit || n > maxSlugSuffix {
+			return "", &ErrSlugConflict{Slug: slug}
+		}
+		candidate = slug + "-" + strconv.Itoa(n)
+	}
+}
+
+// resolveSlug finds the entry with a slug. When no entry has the slug now,
+// moved returns the uuid of the entry that last gave it up, or an empty
+// string if no entry ever had it, and the entry is returned along with its
+// current slug.
+func resolveSlug(ctx context.Context, bm BlogManager, slug string, session security.Session, moved func(slug string) (string, error)) (Entry, string, error) {
+	entry, err := bm.GetEntryBySlugCachedContext(ctx, slug, session)
+	if err == nil {
+		return entry, "", nil
+	} else if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrDeleted) {
+		return nil, "", err
+	}
+
+	uuid, err := moved(slug)
+	if err != nil {
+		return nil, "", err
+	}
+	if uuid == "" {
+		return nil, "", ErrNotFound
+	}
+	entry, err = bm.GetEntryCachedContext(ctx, uuid, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return entry, entry.Slug(), nil
+}
@@ -0,0 +1,131 @@
+package blog
+
+import (
+	"time"
+
+	"gitlab.com/montebo/security"
+)
+
+// Workflow states of an entry. Only published entries are intended for the
+// public; a scheduled entry becomes published once its date has passed.
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+// Roles that grant access to blog entries. Editors may change every entry
+// and move entries through every workflow state. Authors may only change
+// their own entries, writing drafts and submitting them for review.
+const (
+	RoleEditor = "bk1"
+	RoleAuthor = "bk2"
+)
+
+// Statuses lists every workflow state in workflow order.
+var Statuses = []string{StatusDraft, StatusInReview, StatusScheduled, StatusPublished, StatusArchived}
+
+// transitions lists the states an entry may move to from each state.
+var transitions = map[string][]string{
+	StatusDraft:     {StatusInReview, StatusScheduled, StatusPublished, StatusArchived},
+	StatusInReview:  {StatusDraft, StatusScheduled, StatusPublished},
+	StatusScheduled: {StatusDraft, StatusPublished, StatusArchived},
+	StatusPublished: {StatusDraft, StatusArchived},
+	StatusArchived:  {StatusDraft, StatusPublished},
+}
+
+// authorTransitions lists the transitions an author without the editor role
+// may make.
+var authorTransitions = map[string][]string{
+	StatusDraft:    {StatusInReview},
+	StatusInReview: {StatusDraft},
+}
+
+// ValidStatus reports whether status is a known workflow state.
+func ValidStatus(status string) bool {
+	return containsString(Statuses, status)
+}
+
+// CanTransition reports whether an entry may move from one workflow state to
+// another. Remaining in the same state is always allowed.
+func CanTransition(from, to string) bool {
+	return from == to || containsString(transitions[from], to)
+}
+
+// effectiveStatus returns the status an entry currently has, treating a
+// scheduled entry whose date has passed as published. Entries without a
+// status are drafts.
+func effectiveStatus(status string, date *time.Time) string {
+	if status == "" {
+		return StatusDraft
+	}
+	if status == StatusScheduled && date != nil && !date.After(time.Now()) {
+		return StatusPublished
+	}
+	return status
+}
+
+// checkTransition returns an error if the session may not move an entry from
+// one workflow state to another. New entries have an empty from state, and
+// may be created as drafts by anyone permitted to add entries.
+func checkTransition(from, to string, date *time.Time, session security.Session) error {
+	if !ValidStatus(to) {
+		return invalid("Status", "Unknown entry status: "+to)
+	}
+	if from == to {
+		return nil
+	}
+	if from == "" {
+		from = StatusDraft
+		if to == StatusDraft {
+			return nil
+		}
+	}
+	if !CanTransition(from, to) {
+		return invalid("Status", "Entry status cannot change from "+from+" to "+to)
+	}
+	if to == StatusScheduled && (date == nil || !date.After(time.Now())) {
+		return invalid("Date", "Scheduled entries must have a future date")
+	}
+	if session.HasRole(RoleEditor) {
+		return nil
+	}
+	if containsString(authorTransitions[from], to) && session.HasRole(RoleAuthor) {
+		return nil
+	}
+	return &ErrForbidden{"You do not have permission to change entry status from " + from + " to " + to}
+}
+
+// checkAuthor returns an ErrForbidden unless the session may change entries
+// written by an author.
+func checkAuthor(authorUuid string, session security.Session) error {
+	if session.HasRole(RoleEditor) {
+		return nil
+	}
+	if !session.HasRole(RoleAuthor) {
+		return &ErrForbidden{"You do not have permission to change blog entries"}
+	}
+	if authorUuid != session.PersonUuid() {
+		return &ErrForbidden{"You may only change your own blog entries"}
+	}
+	return nil
+}
+
+// withStatus returns the entries that currently have a workflow state.
+func withStatus(items []Entry, status string) []Entry {
+	var matches []Entry
+	for _, e := range items {
+		if e.Status() == status {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
+
+// isPublic reports whether an entry may be shown to the public: it is
+// published, not deleted, and dated in the past.
+func isPublic(e Entry, now time.Time) bool {
+	return e.Status() == StatusPublished && !e.Deleted() && e.Date() != nil && !e.Date().After(now)
+}
@@ -0,0 +1,238 @@
+package blog
+
+// stem returns the stem of a lower case English word using the Porter
+// stemming algorithm, so that "connect", "connected" and "connection"
+// are all indexed as "connect". Words of two letters or fewer, and words
+// containing anything but the letters a to z, are returned unchanged.
+func stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	p := &porter{b: []byte(word), k: len(word) - 1}
+	p.step1ab()
+	if p.k > 0 {
+		p.step1c()
+		p.step2()
+		p.step3()
+		p.step4()
+		p.step5()
+	}
+	return string(p.b[:p.k+1])
+}
+
+// porter holds a word being stemmed. The stem is b[0..k], and j marks the
+// end of the stem before the suffix most recently matched by ends.
+type porter struct {
+	b    []byte
+	k, j int
+}
+
+// cons reports whether b[i] is a consonant. Y is a consonant unless it
+// follows a consonant.
+func (p *porter) cons(i int) bool {
+	switch p.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !p.cons(i-1)
+	}
+	return true
+}
+
+// m returns the number of vowel and consonant sequences in b[0..j]. With
+// c a run of consonants and v a run of vowels, a word has the form
+// [c](vc){m}[v].
+func (p *porter) m() int {
+	n := 0
+	i := 0
+	for ; i <= p.j && p.cons(i); i++ {
+	}
+	for i <= p.j {
+		for ; i <= p.j && !p.cons(i); i++ {
+		}
+		if i > p.j {
+			break
+		}
+		n++
+		for ; i <= p.j && p.cons(i); i++ {
+		}
+	}
+	return n
+}
+
+// vowelInStem reports whether b[0..j] contains a vowel.
+func (p *porter) vowelInStem() bool {
+	for i := 0; i <= p.j; i++ {
+		if !p.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doublec reports whether b[i-1] and b[i] are the same consonant.
+func (p *porter) doublec(i int) bool {
+	return i > 0 && p.b[i] == p.b[i-1] && p.cons(i)
+}
+
+// cvc reports whether b[i-2..i] is consonant, vowel, consonant, and the
+// last consonant is not w, x or y. This restores an e in words such as
+// "hoping" but not in "snowing".
+func (p *porter) cvc(i int) bool {
+	if i < 2 || !p.cons(i) || p.cons(i-1) || !p.cons(i-2) {
+		return false
+	}
+	switch p.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether b[0..k] ends with s, and if so sets j to the end of
+// the stem before it.
+func (p *porter) ends(s string) bool {
+	if len(s) > p.k+1 || string(p.b[p.k-len(s)+1:p.k+1]) != s {
+		return false
+	}
+	p.j = p.k - len(s)
+	return true
+}
+
+// setTo replaces b[j+1..k] with s.
+func (p *porter) setTo(s string) {
+	p.b = append(p.b[:p.j+1], s...)
+	p.k = p.j + len(s)
+}
+
+// replace replaces b[j+1..k] with s if the stem before it is not empty.
+func (p *porter) replace(s string) {
+	if p.m() > 0 {
+		p.setTo(s)
+	}
+}
+
+// step1ab removes plurals and -ed or -ing.
+func (p *porter) step1ab() {
+	if p.b[p.k] == 's' {
+		if p.ends("sses") {
+			p.k -= 2
+		} else if p.ends("ies") {
+			p.setTo("i")
+		} else if p.b[p.k-1] != 's' {
+			p.k--
+		}
+	}
+	if p.ends("eed") {
+		if p.m() > 0 {
+			p.k--
+		}
+	} else if (p.ends("ed") || p.ends("ing")) && p.vowelInStem() {
+		p.k = p.j
+		if p.ends("at") {
+			p.setTo("ate")
+		} else if p.ends("bl") {
+			p.setTo("ble")
+		} else if p.ends("iz") {
+			p.setTo("ize")
+		} else if p.doublec(p.k) {
+			switch p.b[p.k] {
+			case 'l', 's', 'z':
+			default:
+				p.k--
+			}
+		} else if p.m() == 1 && p.cvc(p.k) {
+			p.setTo("e")
+		}
+	}
+}
+
+// step1c turns a final y into i when there is another vowel in the stem.
+func (p *porter) step1c() {
+	if p.ends("y") && p.vowelInStem() {
+		p.b[p.k] = 'i'
+	}
+}
+
+// porterRules are suffixes and their replacements, tried in order until
+// one matches.
+type porterRules []struct{ suffix, replacement string }
+
+func (p *porter) apply(rules porterRules) {
+	for _, r := range rules {
+		if p.ends(r.suffix) {
+			p.replace(r.replacement)
+			return
+		}
+	}
+}
+
+var porterStep2 = porterRules{
+	{"ational", "ate"}, {"tional", "tion"},
+	{"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"},
+	{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"},
+	{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"},
+	{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+	{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+	{"logi", "log"},
+}
+
+var porterStep3 = porterRules{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"},
+	{"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""},
+	{"ness", ""},
+}
+
+// step2 maps double suffixes to single ones, such as -ization to -ize.
+func (p *porter) step2() {
+	p.apply(porterStep2)
+}
+
+// step3 deals with -ic-, -full, -ness and similar suffixes.
+func (p *porter) step3() {
+	p.apply(porterStep3)
+}
+
+// porterStep4 are the suffixes removed from stems of two or more
+// sequences by step4. -ion is only removed after s or t.
+var porterStep4 = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+// step4 removes -ant, -ence and similar suffixes from longer stems.
+func (p *porter) step4() {
+	for _, s := range porterStep4 {
+		if !p.ends(s) {
+			continue
+		}
+		if s == "ion" && (p.j < 0 || (p.b[p.j] != 's' && p.b[p.j] != 't')) {
+			return
+		}
+		if p.m() > 1 {
+			p.k = p.j
+		}
+		return
+	}
+}
+
+// step5 removes a final -e and changes -ll to -l in longer stems.
+func (p *porter) step5() {
+	p.j = p.k
+	if p.b[p.k] == 'e' {
+		if a := p.m(); a > 1 || (a == 1 && !p.cvc(p.k-1)) {
+			p.k--
+		}
+	}
+	if p.b[p.k] == 'l' && p.doublec(p.k) && p.m() > 1 {
+		p.k--
+	}
+}
@@ -0,0 +1,170 @@
+package blog
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// Text is split into words at anything other than letters, digits and
+// combining marks. Chinese and Japanese are written without spaces between
+// words, so runs of Chinese, Japanese and Korean characters are split into
+// overlapping pairs of characters instead, which lets a search for any
+// word of two or more characters find it. Words are case folded, full
+// width letters are narrowed and accents are removed from Latin, Greek and
+// Cyrillic letters, so that "Café" and "cafe" are the same word.
+
+// An analyzer turns the words of text in a language into the terms they
+// are indexed under.
+type analyzer struct {
+	// stopWords are too common to be worth indexing.
+	stopWords map[string]bool
+
+	// stem returns the stem of a word, or is nil for languages that are
+	// not stemmed.
+	stem func(word string) string
+}
+
+// englishAnalyzer is used for English, and for entries without a
+// language.
+var englishAnalyzer = &analyzer{
+	stopWords: map[string]bool{
+		"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+		"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+		"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+		"on": true, "or": true, "such": true, "that": true, "the": true,
+		"their": true, "then": true, "there": true, "these": true, "they": true,
+		"this": true, "to": true, "was": true, "will": true, "with": true,
+	},
+	stem: stem,
+}
+
+// plainAnalyzer indexes every word of other languages as it is written.
+var plainAnalyzer = &analyzer{}
+
+// analyzerFor returns the analyzer for a BCP 47 language tag such as
+// "en-AU" or "zh-Hant".
+func analyzerFor(lang string) *analyzer {
+	if lang == "" {
+		return englishAnalyzer
+	}
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return englishAnalyzer
+	}
+	if base, _ := tag.Base(); base.String() != "en" {
+		return plainAnalyzer
+	}
+	return englishAnalyzer
+}
+
+// A token is a word of text and the term it is indexed under.
+type token struct {
+	term string
+
+	// position counts the words before the token, including stop words.
+	position int
+
+	// start and end are the byte offsets of the word in the text. The
+	// words of Chinese, Japanese and Korean text overlap.
+	start, end int
+}
+
+// tokenize returns the words of text that are indexed, as terms.
+func (a *analyzer) tokenize(text string) []token {
+	var items []token
+	for _, t := range words(text) {
+		if a.stopWords[t.term] {
+			continue
+		}
+		if a.stem != nil {
+			t.term = a.stem(t.term)
+		}
+		items = append(items, t)
+	}
+	return items
+}
+
+// words splits text into folded words.
+func words(text string) []token {
+	var items []token
+	add := func(start, end int) {
+		items = append(items, token{term: fold(text[start:end]), position: len(items), start: start, end: end})
+	}
+
+	// start is the start of the word being read, or -1 between words. In
+	// a run of ideographic characters, n counts the characters and last is
+	// the start of the previous one.
+	start, last, n := -1, 0, 0
+	flush := func(end int) {
+		if start >= 0 && n <= 1 {
+			add(start, end)
+		}
+		start, n = -1, 0
+	}
+	for i, r := range text {
+		switch {
+		case isIdeographic(r):
+			if n == 0 {
+				flush(i)
+				start = i
+			} else {
+				add(last, i+utf8.RuneLen(r))
+			}
+			last = i
+			n++
+		case start >= 0 && unicode.IsMark(r):
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if n > 0 {
+				flush(i)
+			}
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return items
+}
+
+// isIdeographic reports whether r is a Chinese, Japanese or Korean
+// character, which are indexed in pairs.
+func isIdeographic(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r == 'ー' || r == 'ｰ'
+}
+
+// fold returns the form of a word that is indexed.
+func fold(word string) string {
+	ascii := true
+	for i := 0; i < len(word); i++ {
+		if word[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return strings.ToLower(word)
+	}
+
+	word = norm.NFD.String(width.Fold.String(word))
+	var b strings.Builder
+	accented := false
+	for _, r := range word {
+		if unicode.Is(unicode.Mn, r) && accented {
+			continue
+		}
+		if !unicode.Is(unicode.Mn, r) {
+			accented = unicode.In(r, unicode.Latin, unicode.Greek, unicode.Cyrillic)
+		}
+		b.WriteRune(r)
+	}
+	return cases.Fold().String(norm.NFC.String(b.String()))
+}
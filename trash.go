@@ -0,0 +1,207 @@
+package blog
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/zaddok/log"
+	"gitlab.com/montebo/security"
+)
+
+// DefaultRetention is how long a PurgeJob keeps deleted entries in the
+// trash when it is not given a retention period.
+const DefaultRetention = 30 * 24 * time.Hour
+
+type trashKey struct{}
+
+// validateUpdate returns the error validateEntry returns for an entry,
+// unless the update is made by trashEntry. Moving an entry into or out of
+// the trash changes nothing else about it, so entries saved before they
+// had to be valid can still be deleted and restored.
+func validateUpdate(ctx context.Context, entry Entry) error {
+	if trash, _ := ctx.Value(trashKey{}).(bool); trash {
+		return nil
+	}
+	return validateEntry(entry)
+}
+
+// trashEntry moves an entry into or out of the trash. The entry is read
+// with load, which must return it whether or not the session may see it,
+// and is saved with UpdateEntry so that the change is recorded in the audit
+// log and the entry revisions.
+func trashEntry(ctx context.Context, bm BlogManager, uuid string, deleted bool, session security.Session, load func(uuid string) (Entry, error)) error {
+	if uuid == "" {
+		return ErrNotFound
+	}
+	if session == nil || !session.IsAuthenticated() {
+		return &security.ErrUnauthenticated{session}
+	}
+
+	entry, err := load(uuid)
+	if err != nil {
+		return err
+	}
+	if err := checkAuthor(entry.AuthorUUID(), session); err != nil {
+		return err
+	}
+	if entry.Deleted() == deleted {
+		return nil
+	}
+
+	entry.SetDeleted(deleted)
+	return bm.UpdateEntryContext(context.WithValue(ctx, trashKey{}, true), entry, session)
+}
+
+// checkPurge returns an error unless an entry is in the trash and the
+// session may change it.
+func checkPurge(entry Entry, session security.Session) error {
+	if err := checkAuthor(entry.AuthorUUID(), session); err != nil {
+		return err
+	}
+	if !entry.Deleted() {
+		return invalid("Deleted", "Only deleted entries can be purged")
+	}
+	return nil
+}
+
+// deletedEntries returns the entries in the trash that the session may
+// change, most recently deleted first.
+func deletedEntries(ctx context.Context, bm BlogManager, session security.Session) ([]Entry, error) {
+	if session == nil || !session.IsAuthenticated() {
+		return nil, &security.ErrUnauthenticated{session}
+	}
+
+	items, err := bm.GetEntriesContext(ShowHidden(ctx), session)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []Entry
+	for _, e := range items {
+		if e.Deleted() && checkAuthor(e.AuthorUUID(), session) == nil {
+			deleted = append(deleted, e)
+		}
+	}
+	sort.SliceStable(deleted, func(i, j int) bool {
+		return deletedTime(deleted[j]).Before(deletedTime(deleted[i]))
+	})
+
+	return deleted, nil
+}
+
+// deletedTime returns when an entry was moved to the trash. Entries deleted
+// before the time was recorded use the time they were last saved.
+func deletedTime(e Entry) time.Time {
+	if e.DeletedAt() != nil {
+		return *e.DeletedAt()
+	}
+	if e.Updated() != nil {
+		return *e.Updated()
+	}
+	return time.Time{}
+}
+
+// PurgeExpired permanently removes the entries on the session site that
+// have been in the trash for longer than retention, and returns how many
+// were removed.
+func PurgeExpired(ctx context.Context, bm BlogManager, retention time.Duration, session security.Session) (int, error) {
+	items, err := bm.GetDeletedEntriesContext(ctx, session)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-retention)
+	purged := 0
+	for _, e := range items {
+		if deletedTime(e).After(cutoff) {
+			continue
+		}
+		if err := bm.PurgeEntryContext(ctx, e.Uuid(), session); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// A PurgeJob periodically removes entries that have been in the trash for
+// longer than its retention period.
+type PurgeJob struct {
+	Manager BlogManager
+
+	// Retention is how long deleted entries are kept, DefaultRetention if
+	// it is zero.
+	Retention time.Duration
+
+	// Interval is the time between purges, one hour if it is zero.
+	Interval time.Duration
+
+	// Sessions returns a session with the editor role for every site whose
+	// trash is purged.
+	Sessions func() ([]security.Session, error)
+
+	// Log, if set, receives the number of entries purged and any errors.
+	Log log.Log
+}
+
+func (j *PurgeJob) retention() time.Duration {
+	if j.Retention <= 0 {
+		return DefaultRetention
+	}
+	return j.Retention
+}
+
+func (j *PurgeJob) interval() time.Duration {
+	if j.Interval <= 0 {
+		return time.Hour
+	}
+	return j.Interval
+}
+
+// Run purges expired entries immediately and then after every Interval,
+// until ctx is done.
+func (j *PurgeJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval())
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.Purge(ctx); err != nil && ctx.Err() == nil && j.Log != nil {
+			j.Log.Warning("Blog trash purge failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes expired entries from every site once, and returns how many
+// were removed. A site that fails does not stop the others from being
+// purged; the first error is returned.
+func (j *PurgeJob) Purge(ctx context.Context) (int, error) {
+	sessions, err := j.Sessions()
+	if err != nil {
+		return 0, err
+	}
+
+	var first error
+	total := 0
+	for _, session := range sessions {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := PurgeExpired(ctx, j.Manager, j.retention(), session)
+		total += n
+		if n > 0 && j.Log != nil {
+			j.Log.Info("Purged %d deleted blog entries from %s", n, session.Site())
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return total, first
+}
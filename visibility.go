@@ -0,0 +1,48 @@
+package blog
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/montebo/security"
+)
+
+// Entries that are not public are hidden: drafts and other unpublished
+// entries, entries dated in the future or without a date, and deleted
+// entries. The read methods of every BlogManager only return public
+// entries, unless their context was made by ShowHidden.
+
+type showHiddenKey struct{}
+
+// ShowHidden returns a context that asks the Context read methods of a
+// BlogManager to also return hidden entries. Editors then see every entry
+// and authors see their own hidden entries. Other sessions still only see
+// public entries.
+func ShowHidden(ctx context.Context) context.Context {
+	return context.WithValue(ctx, showHiddenKey{}, true)
+}
+
+// canSee reports whether a read with ctx may return an entry to a session.
+func canSee(ctx context.Context, e Entry, session security.Session, now time.Time) bool {
+	if isPublic(e, now) {
+		return true
+	}
+	if show, _ := ctx.Value(showHiddenKey{}).(bool); !show {
+		return false
+	}
+	return checkAuthor(e.AuthorUUID(), session) == nil
+}
+
+// checkVisible returns the error a read with ctx returns instead of an
+// entry the session may not see. Deleted entries that would otherwise be
+// public are reported with ErrDeleted.
+func checkVisible(ctx context.Context, e Entry, session security.Session) error {
+	now := time.Now()
+	if canSee(ctx, e, session, now) {
+		return nil
+	}
+	if e.Deleted() && e.Status() == StatusPublished && e.Date() != nil && !e.Date().After(now) {
+		return ErrDeleted
+	}
+	return ErrNotFound
+}